@@ -0,0 +1,39 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bit-bom/bom-factory/pkg/config"
+	"github.com/bit-bom/bom-factory/pkg/csv"
+)
+
+// fetchStrategy selects how the files of a repository are downloaded
+type fetchStrategy string
+
+const (
+	fetchClone   fetchStrategy = "clone"   // Git clone of the ref
+	fetchArchive fetchStrategy = "archive" // Source archive of the ref from the host's archive URL template
+)
+
+// parseFetchStrategy parses a fetch strategy name
+func parseFetchStrategy(name string) (fetchStrategy, error) {
+	switch strategy := fetchStrategy(strings.ToLower(name)); strategy {
+	case fetchClone, fetchArchive:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("unknown fetch strategy %q (available: clone, archive)", name)
+	}
+}
+
+// archiveTemplates returns the archive URL templates by host, the configured ones replacing the defaults
+func archiveTemplates(cfg *config.Config) map[string]string {
+	templates := make(map[string]string, len(csv.DefaultArchiveTemplates)+len(cfg.Archives))
+	for host, template := range csv.DefaultArchiveTemplates {
+		templates[host] = template
+	}
+	for host, template := range cfg.Archives {
+		templates[strings.ToLower(host)] = template
+	}
+	return templates
+}
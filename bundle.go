@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bit-bom/bom-factory/pkg/bundle"
+	"github.com/bit-bom/bom-factory/pkg/disk"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// bundleSBOMs packs a directory of SBOMs into a bundle
+func bundleSBOMs(c *cli.Context) error {
+	dir, output := c.String("dir"), c.String("output")
+	if !bundle.IsBundle(output) {
+		return fmt.Errorf("--output must end with %s", bundle.Extension)
+	}
+
+	index, err := bundle.Create(output, dir)
+	if err != nil {
+		return err
+	}
+	var size int64
+	for _, file := range index.Files {
+		size += file.Size
+	}
+	info, err := os.Stat(output)
+	if err != nil {
+		return err
+	}
+	slog.Info("bundle written", "bundle", output, "files", len(index.Files), "size", disk.FormatSize(size),
+		"compressed", disk.FormatSize(info.Size()))
+	return nil
+}
+
+// validateBundle validates the SBOMs of a bundle, returning a message for every invalid one
+func validateBundle(bundlePath string) []string {
+	var failures []string
+	_, err := bundle.Walk(bundlePath, func(file bundle.File, data []byte) error {
+		if !isSBOMFile(file.Path) {
+			return nil
+		}
+		if err := sbom.ValidateSBOMData(file.Path, data); err != nil {
+			failures = append(failures, fmt.Sprintf("%s!%s: %v", bundlePath, file.Path, err))
+		}
+		return nil
+	})
+	if err != nil {
+		failures = append(failures, fmt.Sprintf("%s: %v", bundlePath, err))
+	}
+	return failures
+}
+
+// convertBundleToPURL rewrites a bundle with PURLs added to its SPDX JSON files, leaving other files as they are
+func convertBundleToPURL(bundlePath string) error {
+	return bundle.Rewrite(bundlePath, func(file bundle.File, data []byte) ([]byte, error) {
+		if !isJSONSBOMFile(file.Path) {
+			return data, nil
+		}
+		converted, err := sbom.AddPURLs(data)
+		if errors.Is(err, sbom.ErrNotSPDX) {
+			return data, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file.Path, err)
+		}
+		return converted, nil
+	})
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// checkoutMode selects which files of a repository are checked out for scanning
+type checkoutMode string
+
+const (
+	checkoutFull    checkoutMode = "full"    // Every file
+	checkoutSparse  checkoutMode = "sparse"  // Only package manifests and lock files
+	checkoutCompare checkoutMode = "compare" // Every file, also scanning the manifests alone to compare the SBOMs
+)
+
+// parseCheckoutMode parses a checkout mode name
+func parseCheckoutMode(name string) (checkoutMode, error) {
+	switch mode := checkoutMode(strings.ToLower(name)); mode {
+	case checkoutFull, checkoutSparse, checkoutCompare:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown checkout mode %q (available: full, sparse, compare)", name)
+	}
+}
+
+// manifestPatterns returns the files checked out by sparse checkouts
+func (o sbomOptions) manifestPatterns() []string {
+	if o.Config != nil && len(o.Config.ManifestPatterns) > 0 {
+		return o.Config.ManifestPatterns
+	}
+	return csv.DefaultManifestPatterns
+}
+
+// comparedOutput returns the first output in a format whose components can be read,
+// which the SBOM of the sparse checkout is compared with
+func comparedOutput(outputs []sbom.Output) (sbom.Output, bool) {
+	for _, output := range outputs {
+		if output.Format.Readable() {
+			return output, true
+		}
+	}
+	return sbom.Output{}, false
+}
+
+// sparseComparison compares the SBOM of a full checkout with the SBOM of its manifests alone
+type sparseComparison struct {
+	RepoURL          string   `json:"repo_url"`
+	CommitSHA        string   `json:"commit_sha"`
+	Generator        string   `json:"generator"`
+	Patterns         []string `json:"patterns"`
+	SparseFiles      int      `json:"sparse_files"`
+	FullComponents   int      `json:"full_components"`
+	SparseComponents int      `json:"sparse_components"`
+	Fidelity         float64  `json:"fidelity"` // Share of the components of the full SBOM also found in the sparse SBOM
+	FullScanMS       int64    `json:"full_scan_ms"`
+	SparseScanMS     int64    `json:"sparse_scan_ms"`
+	Missing          []string `json:"missing,omitempty"` // Components only found in the full SBOM
+	Extra            []string `json:"extra,omitempty"`   // Components only found in the sparse SBOM
+}
+
+// compareReportSuffix ends the names of sparse checkout comparisons, which validate-sbom and
+// convert-to-purl skip since they are not SBOMs
+const compareReportSuffix = ".sparse-compare.json"
+
+// compareSparse scans the manifests of a full checkout on their own and writes a comparison of the
+// resulting SBOM with the SBOM of the full checkout next to it, as <org>_<repo>.sparse-compare.json
+func compareSparse(ctx context.Context, repo *csv.RepoData, dir string, size int64, commitSHA, version string,
+	full sbom.Output, fullScan time.Duration, options sbomOptions) error {
+	sparseDir, err := os.MkdirTemp(options.TempDir, "repo-sparse-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(sparseDir)
+
+	patterns := options.manifestPatterns()
+	files, err := csv.CopyManifests(dir, filepath.Join(sparseDir, "src"), patterns)
+	if err != nil {
+		return err
+	}
+	sparse := sbom.Output{Format: full.Format, File: filepath.Join(sparseDir, "sparse"+full.Format.Extension())}
+	scanStart := time.Now()
+	if err := scanSBOM(ctx, repo, filepath.Join(sparseDir, "src"), size, version, []sbom.Output{sparse}, options); err != nil {
+		return fmt.Errorf("failed to scan manifests: %w", err)
+	}
+	sparseScan := time.Since(scanStart)
+
+	fullComponents, err := sbom.Components(full.File)
+	if err != nil {
+		return err
+	}
+	sparseComponents, err := sbom.Components(sparse.File)
+	if err != nil {
+		return err
+	}
+
+	comparison := sparseComparison{
+		RepoURL:          repo.RepoURL,
+		CommitSHA:        commitSHA,
+		Generator:        options.Generator.Name(),
+		Patterns:         patterns,
+		SparseFiles:      files,
+		FullComponents:   len(fullComponents),
+		SparseComponents: len(sparseComponents),
+		Fidelity:         1,
+		FullScanMS:       fullScan.Milliseconds(),
+		SparseScanMS:     sparseScan.Milliseconds(),
+		Missing:          difference(fullComponents, sparseComponents),
+		Extra:            difference(sparseComponents, fullComponents),
+	}
+	if len(fullComponents) > 0 {
+		comparison.Fidelity = float64(len(fullComponents)-len(comparison.Missing)) / float64(len(fullComponents))
+	}
+
+	data, err := json.MarshalIndent(comparison, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode comparison: %w", err)
+	}
+	path := strings.TrimSuffix(compress.TrimExtension(full.File), options.extension(full.Format)) + compareReportSuffix
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write comparison: %w", err)
+	}
+
+	slog.Info("compared sparse checkout", "repo", repo.RepoURL, "fidelity", fmt.Sprintf("%.1f%%", comparison.Fidelity*100),
+		"full_components", comparison.FullComponents, "sparse_components", comparison.SparseComponents,
+		"missing", len(comparison.Missing), "full_scan", fullScan.Round(time.Millisecond).String(),
+		"sparse_scan", sparseScan.Round(time.Millisecond).String(), "report", path)
+	return nil
+}
+
+// difference returns the sorted distinct elements of a that are not in b
+func difference(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, element := range b {
+		inB[element] = true
+	}
+	var result []string
+	for _, element := range a {
+		if !inB[element] {
+			inB[element] = true
+			result = append(result, element)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
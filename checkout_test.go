@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+func TestComparedOutput(t *testing.T) {
+	output := func(format sbom.Format) sbom.Output {
+		return sbom.Output{Format: format, File: "org_repo" + format.Extension()}
+	}
+	tests := []struct {
+		name    string
+		formats []sbom.Format
+		want    sbom.Format
+	}{
+		{name: "default format", formats: []sbom.Format{sbom.DefaultFormat}, want: sbom.DefaultFormat},
+		{name: "readable format after others", formats: []sbom.Format{sbom.FormatSPDXTagValue, sbom.FormatCycloneDXXML, sbom.FormatSPDXJSON}, want: sbom.FormatSPDXJSON},
+		{name: "first readable format", formats: []sbom.Format{sbom.FormatCycloneDXJSON16, sbom.FormatSPDXJSON, sbom.FormatCycloneDXJSON15}, want: sbom.FormatSPDXJSON},
+		{name: "no readable format", formats: []sbom.Format{sbom.FormatSPDXTagValue, sbom.FormatCycloneDXJSON16}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var outputs []sbom.Output
+			for _, format := range test.formats {
+				outputs = append(outputs, output(format))
+			}
+			got, ok := comparedOutput(outputs)
+			if ok != (test.want != "") || got.Format != test.want {
+				t.Errorf("comparedOutput = %v, %t, want %s", got, ok, test.want)
+			}
+			if ok && got.File != output(test.want).File {
+				t.Errorf("comparedOutput file = %s", got.File)
+			}
+		})
+	}
+}
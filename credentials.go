@@ -0,0 +1,55 @@
+package main
+
+import (
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/urfave/cli/v2"
+)
+
+// credentialFlags configure how private repositories are cloned, shared by every command that clones
+var credentialFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "token",
+		Usage:   "Token used for HTTPS clones from and API requests to --token-host",
+		EnvVars: []string{"BOMFACTORY_TOKEN", "GITHUB_TOKEN"},
+	},
+	&cli.StringFlag{
+		Name:  "token-host",
+		Value: csv.DefaultTokenHost,
+		Usage: "Host the token is sent to",
+	},
+	&cli.StringFlag{
+		Name:  "netrc",
+		Value: csv.DefaultNetrcPath(),
+		Usage: "netrc-style credentials file with a login per host, used if it exists",
+	},
+	&cli.BoolFlag{
+		Name:  "ssh",
+		Usage: "Clone over SSH instead of HTTPS",
+	},
+	&cli.StringFlag{
+		Name:  "ssh-key",
+		Usage: "Private key file for SSH clones (defaults to the SSH agent)",
+	},
+	&cli.StringFlag{
+		Name:    "ssh-key-passphrase",
+		Usage:   "Passphrase of the SSH private key",
+		EnvVars: []string{"BOMFACTORY_SSH_KEY_PASSPHRASE"},
+	},
+}
+
+// credentialsFromFlags builds the clone credentials from credentialFlags
+func credentialsFromFlags(c *cli.Context) (*csv.Credentials, error) {
+	// An explicitly passed credentials file must exist
+	netrc, err := csv.LoadNetrc(c.String("netrc"), c.IsSet("netrc"))
+	if err != nil {
+		return nil, err
+	}
+	return &csv.Credentials{
+		Token:            c.String("token"),
+		TokenHost:        c.String("token-host"),
+		Netrc:            netrc,
+		SSH:              c.Bool("ssh"),
+		SSHKey:           c.String("ssh-key"),
+		SSHKeyPassphrase: c.String("ssh-key-passphrase"),
+	}, nil
+}
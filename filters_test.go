@@ -0,0 +1,121 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/urfave/cli/v2"
+)
+
+const presetConfig = `
+presets:
+  critical-go:
+    filters: ["repo_language:=:Go"]
+    order_by: repo_star_count DESC
+    max_results: 50
+    skip: 5
+  any-go:
+    filters: ["repo_language:=:Go"]
+`
+
+// parseFilterFlags runs filterOptionsFromFlags on the flags of the query command
+func parseFilterFlags(t *testing.T, configPath string, args ...string) (csv.FilterOptions, error) {
+	t.Helper()
+	var options csv.FilterOptions
+	var filterErr error
+	app := &cli.App{
+		Flags: []cli.Flag{&cli.StringFlag{Name: "config", Value: configPath}},
+		Commands: []*cli.Command{{
+			Name: "query",
+			Flags: []cli.Flag{
+				&cli.StringSliceFlag{Name: "filter"},
+				&cli.IntFlag{Name: "max-results", Value: 100},
+				&cli.IntFlag{Name: "skip"},
+				&cli.StringFlag{Name: "preset"},
+				&cli.StringFlag{Name: "order-by"},
+			},
+			Action: func(c *cli.Context) error {
+				options, filterErr = filterOptionsFromFlags(c)
+				return nil
+			},
+		}},
+	}
+	if err := app.Run(append([]string{"bomfactory", "query"}, args...)); err != nil {
+		t.Fatal(err)
+	}
+	return options, filterErr
+}
+
+func TestFilterOptionsFromFlags(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "bomfactory.yaml")
+	if err := os.WriteFile(configPath, []byte(presetConfig), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	goRepos := csv.FilterCriteria{Field: "repo_language", Operator: "=", Value: "Go"}
+	starred := csv.FilterCriteria{Field: "repo_star_count", Operator: ">", Value: "100"}
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    csv.FilterOptions
+		wantErr string
+	}{
+		{
+			name: "flags only",
+			args: []string{"--filter", "repo_star_count:>:100", "--skip", "2"},
+			want: csv.FilterOptions{Criteria: []csv.FilterCriteria{starred}, MaxResults: 100, SkipRecords: 2},
+		},
+		{
+			name: "preset",
+			args: []string{"--preset", "critical-go"},
+			want: csv.FilterOptions{Criteria: []csv.FilterCriteria{goRepos}, MaxResults: 50, SkipRecords: 5, OrderBy: "repo_star_count DESC"},
+		},
+		{
+			name: "flags override preset fields",
+			args: []string{"--preset", "critical-go", "--max-results", "10", "--skip", "0", "--order-by", "default_score ASC"},
+			want: csv.FilterOptions{Criteria: []csv.FilterCriteria{goRepos}, MaxResults: 10, OrderBy: "default_score ASC"},
+		},
+		{
+			name: "filters are added to the preset filters",
+			args: []string{"--preset", "critical-go", "--filter", "repo_star_count:>:100"},
+			want: csv.FilterOptions{Criteria: []csv.FilterCriteria{goRepos, starred}, MaxResults: 50, SkipRecords: 5, OrderBy: "repo_star_count DESC"},
+		},
+		{
+			name: "unset preset fields keep the flag defaults",
+			args: []string{"--preset", "any-go"},
+			want: csv.FilterOptions{Criteria: []csv.FilterCriteria{goRepos}, MaxResults: 100},
+		},
+		{name: "unknown preset", args: []string{"--preset", "critical-rust"}, wantErr: `unknown preset "critical-rust"`},
+		{name: "no filter", args: []string{"--max-results", "10"}, wantErr: "at least one --filter or a --preset"},
+		{name: "invalid filter", args: []string{"--filter", "repo_language"}, wantErr: "invalid filter criteria"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := parseFilterFlags(t, configPath, test.args...)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("filterOptionsFromFlags = %v, want an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("filterOptionsFromFlags = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterOptionsFromFlagsWithoutConfig(t *testing.T) {
+	// A missing configuration file that was not set explicitly defines no presets
+	_, err := parseFilterFlags(t, filepath.Join(t.TempDir(), "missing.yaml"), "--preset", "critical-go")
+	if err == nil || !strings.Contains(err.Error(), "unknown preset") {
+		t.Errorf("filterOptionsFromFlags = %v, want an unknown preset error", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/disk"
+)
+
+// freeSpaceCheckInterval is how often free space is checked while workers are paused
+const freeSpaceCheckInterval = 10 * time.Second
+
+// spaceGuard pauses workers while the temporary or output directory is low on free space
+type spaceGuard struct {
+	mu       sync.Mutex
+	minFree  int64
+	dirs     []string
+	interval time.Duration
+}
+
+func newSpaceGuard(minFree int64, dirs ...string) *spaceGuard {
+	for i, dir := range dirs {
+		if dir == "" {
+			dirs[i] = os.TempDir()
+		}
+	}
+	return &spaceGuard{minFree: minFree, dirs: dirs, interval: freeSpaceCheckInterval}
+}
+
+// wait blocks until every directory has at least the minimum free space or ctx is done.
+// Only one worker polls at a time, the others wait for it.
+func (g *spaceGuard) wait(ctx context.Context) error {
+	if g == nil || g.minFree <= 0 {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	paused := false
+	for {
+		dir, free, err := g.lowest()
+		if err != nil {
+			slog.Warn("cannot check free space, continuing", "error", err)
+			return nil
+		}
+		if free >= g.minFree {
+			if paused {
+				slog.Info("free space recovered, resuming workers", "dir", dir, "free", disk.FormatSize(free))
+			}
+			return nil
+		}
+		if !paused {
+			slog.Warn("low on free space, pausing workers", "dir", dir, "free", disk.FormatSize(free), "required", disk.FormatSize(g.minFree))
+			paused = true
+		}
+
+		timer := time.NewTimer(g.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// lowest returns the guarded directory with the least free space
+func (g *spaceGuard) lowest() (string, int64, error) {
+	lowestDir, lowestFree := "", int64(-1)
+	for _, dir := range g.dirs {
+		free, err := disk.Free(dir)
+		if err != nil {
+			return "", 0, err
+		}
+		if lowestFree < 0 || free < lowestFree {
+			lowestDir, lowestFree = dir, free
+		}
+	}
+	return lowestDir, lowestFree, nil
+}
+
+// sizeLookup asks the host of a repository for its size until the GitHub API rate limit is hit,
+// after which the size is only enforced during the clone
+type sizeLookup struct {
+	repoSize    func(ctx context.Context, repoURL, token string) (int64, bool, error) // csv.RepoSize if nil
+	mu          sync.Mutex
+	rateLimited bool
+}
+
+// size returns the size the host reports for a repository, see csv.RepoSize
+func (l *sizeLookup) size(ctx context.Context, repoURL, token string) (int64, bool, error) {
+	l.mu.Lock()
+	rateLimited := l.rateLimited
+	l.mu.Unlock()
+	if rateLimited {
+		return 0, false, nil
+	}
+
+	repoSize := l.repoSize
+	if repoSize == nil {
+		repoSize = csv.RepoSize
+	}
+	size, ok, err := repoSize(ctx, repoURL, token)
+	if errors.Is(err, csv.ErrRateLimited) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if !l.rateLimited {
+			l.rateLimited = true
+			slog.Warn("GitHub API rate limit reached, repository sizes are only checked while cloning from now on",
+				"authenticated", token != "", "error", err)
+		}
+		return 0, false, nil
+	}
+	return size, ok, err
+}
+
+// oversizedReason returns why a repository should be skipped because the size reported by its host
+// exceeds the maximum repository size, or an empty string if it should be cloned
+func oversizedReason(ctx context.Context, repo *csv.RepoData, options sbomOptions) string {
+	if options.MaxRepoSize <= 0 {
+		return ""
+	}
+	size, ok, err := options.sizes.size(ctx, repo.RepoURL, options.Credentials.TokenFor("github.com"))
+	if err != nil {
+		slog.Debug("cannot get repository size before cloning", "repo", repo.RepoURL, "error", err)
+		return ""
+	}
+	if !ok || size <= options.MaxRepoSize {
+		return ""
+	}
+	return fmt.Sprintf("repository is %s, larger than the maximum of %s", disk.FormatSize(size), disk.FormatSize(options.MaxRepoSize))
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/csv"
+)
+
+func TestOversizedReason(t *testing.T) {
+	var requests []string
+	sizes := &sizeLookup{repoSize: func(ctx context.Context, repoURL, token string) (int64, bool, error) {
+		requests = append(requests, repoURL)
+		switch repoURL {
+		case "https://github.com/org/large":
+			return 2 << 20, true, nil
+		case "https://github.com/org/limited":
+			return 0, false, fmt.Errorf("%w: 403", csv.ErrRateLimited)
+		case "https://github.com/org/failing":
+			return 0, false, fmt.Errorf("502 Bad Gateway")
+		default:
+			return 1 << 10, true, nil
+		}
+	}}
+	options := sbomOptions{MaxRepoSize: 1 << 20, sizes: sizes}
+
+	tests := []struct {
+		repoURL string
+		skipped bool
+	}{
+		{"https://github.com/org/small", false},
+		{"https://github.com/org/large", true},
+		{"https://github.com/org/failing", false},
+		{"https://github.com/org/limited", false},
+		// Once the rate limit is hit the API is not asked again
+		{"https://github.com/org/large", false},
+	}
+	for _, test := range tests {
+		reason := oversizedReason(context.Background(), &csv.RepoData{RepoURL: test.repoURL}, options)
+		if (reason != "") != test.skipped {
+			t.Errorf("oversizedReason(%s) = %q, want skipped=%v", test.repoURL, reason, test.skipped)
+		}
+	}
+	if len(requests) != 4 {
+		t.Errorf("sizes requested for %v, want no request after the rate limit", requests)
+	}
+
+	options.MaxRepoSize = 0
+	if reason := oversizedReason(context.Background(), &csv.RepoData{RepoURL: "https://github.com/org/large"}, options); reason != "" {
+		t.Errorf("repository skipped without a maximum size: %s", reason)
+	}
+}
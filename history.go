@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/layout"
+	"github.com/bit-bom/bom-factory/pkg/progress"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// tagRefPrefix turns a tag name into a full reference name that cannot be mistaken for a branch
+const tagRefPrefix = "refs/tags/"
+
+// historyOptions selects the release tags to generate SBOMs for in a history run
+type historyOptions struct {
+	Count int       // Number of most recent release tags, all of them if 0
+	Since time.Time // Only release tags dated since, regardless of date if zero
+}
+
+func (h historyOptions) enabled() bool {
+	return h.Count > 0 || !h.Since.IsZero()
+}
+
+// historyFromFlags returns the history options selected with --history and --since
+func historyFromFlags(c *cli.Context) (historyOptions, error) {
+	var history historyOptions
+	if history.Count = c.Int("history"); history.Count < 0 {
+		return history, fmt.Errorf("--history must not be negative")
+	}
+	if since := c.String("since"); since != "" {
+		var err error
+		if history.Since, err = time.Parse(time.DateOnly, since); err != nil {
+			if history.Since, err = time.Parse(time.RFC3339, since); err != nil {
+				return history, fmt.Errorf("invalid --since %q, expected a date such as 2024-01-31 or an RFC 3339 time", since)
+			}
+		}
+	}
+	if history.enabled() && c.IsSet("ref") {
+		return history, fmt.Errorf("--ref cannot be combined with --history or --since")
+	}
+	return history, nil
+}
+
+// processHistoryTask clones the full history of a repository once and generates an SBOM for each
+// of its release tags. The job of the repository is expanded into one job per release.
+func processHistoryTask(ctx context.Context, db *sql.DB, task *sbomTask, options sbomOptions) progress.Outcome {
+	start := time.Now()
+	tempDir, err := os.MkdirTemp(options.TempDir, "repo-history-")
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, csv.ResolvedRef{}, start, fmt.Errorf("failed to create temporary directory: %w", err))
+	}
+	defer os.RemoveAll(tempDir)
+
+	var cloneDir string
+	err = options.Retry.Do(ctx, func(attempt int) error {
+		// Every attempt clones into a directory of its own
+		cloneDir = filepath.Join(tempDir, strconv.Itoa(attempt))
+		cloneStart := time.Now()
+		_, err := cloneRepo(ctx, task.Repo.RepoURL, cloneDir, options, csv.CloneOptions{
+			MaxSize:     options.MaxRepoSize,
+			Credentials: options.Credentials,
+			History:     true,
+		})
+		options.Metrics.CloneDuration.Observe(time.Since(cloneStart).Seconds())
+		if err != nil {
+			_ = os.RemoveAll(cloneDir)
+		}
+		recordAttempt(ctx, &task.Repo, options, attempt, err)
+		return err
+	})
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, csv.ResolvedRef{}, start, err)
+	}
+
+	size, err := csv.DirSize(cloneDir)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, csv.ResolvedRef{}, start, fmt.Errorf("failed to measure cloned repository: %w", err))
+	}
+	options.Metrics.BytesCloned.Add(float64(size))
+
+	tags, err := csv.ReleaseTags(cloneDir, options.History.Since, options.History.Count)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, csv.ResolvedRef{}, start, err)
+	}
+	if len(tags) == 0 {
+		return skipSBOMTask(db, task, options, csv.ResolvedRef{}, nil, "no release tags selected")
+	}
+
+	names := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		names = append(names, tag.Name)
+	}
+	releaseJobs, err := jobs.Expand(db, task.Job, names)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, csv.ResolvedRef{}, start, err)
+	}
+	slog.Info("generating SBOMs of releases", "repo", task.Repo.RepoURL, "releases", len(tags), "oldest", names[0], "newest", names[len(names)-1])
+
+	outcomes := make(map[progress.Outcome]int)
+	for i, tag := range tags {
+		releaseTask := &sbomTask{Repo: task.Repo, Job: releaseJobs[i]}
+		outcome := processRelease(ctx, db, releaseTask, cloneDir, size, tag, i > 0, options)
+		outcomes[outcome]++
+		if outcome == progress.Interrupted {
+			// The remaining releases are left pending
+			break
+		}
+	}
+
+	switch {
+	case outcomes[progress.Interrupted] > 0:
+		return progress.Interrupted
+	case outcomes[progress.Failed] > 0:
+		return progress.Failed
+	case outcomes[progress.Succeeded] > 0:
+		return progress.Succeeded
+	default:
+		return progress.Skipped
+	}
+}
+
+// processRelease generates the SBOMs of a release tag in a clone of the full history,
+// starting its job first unless it was already started
+func processRelease(ctx context.Context, db *sql.DB, task *sbomTask, dir string, size int64, tag csv.Tag, startJob bool, options sbomOptions) progress.Outcome {
+	ref := csv.ResolvedRef{Name: tag.Name, CommitSHA: tag.CommitSHA}
+	start := time.Now()
+	if ctx.Err() != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, ctx.Err())
+	}
+	if startJob {
+		if err := jobs.Start(db, task.Job.ID); err != nil {
+			slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+		}
+	}
+
+	outputs, err := historyOutputs(&task.Repo, tag.Name, options)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+	if err := claimOutputs(db, task.Repo.RepoURL, outputs, options); err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+	if !options.Force {
+		if outputFiles, upToDate := sbomUpToDate(db, &task.Repo, ref, outputs, options); upToDate {
+			return skipSBOMTask(db, task, options, ref, outputFiles, "up to date")
+		}
+	}
+
+	err = options.Retry.Do(ctx, func(attempt int) error {
+		if attempt > 1 {
+			if err := jobs.Start(db, task.Job.ID); err != nil {
+				slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+			}
+			start = time.Now()
+		}
+		err := csv.Checkout(dir, tag.CommitSHA)
+		if err == nil {
+			err = scanSBOM(ctx, &task.Repo, dir, size, tag.Name, outputs, options)
+		}
+		recordAttempt(ctx, &task.Repo, options, attempt, err)
+		return err
+	})
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+
+	result := jobs.Result{
+		Duration:         time.Since(start),
+		CommitSHA:        tag.CommitSHA,
+		Ref:              tag.Name,
+		Generator:        options.Generator.Name(),
+		GeneratorVersion: options.GeneratorVersion,
+	}
+	for _, output := range outputs {
+		result.OutputPaths = append(result.OutputPaths, output.File)
+	}
+	return succeedSBOMTask(db, task, options, result)
+}
+
+// historyOutputs returns the SBOM files to write for a release of a repository, one per format
+// named by the layout. The flat layout uses a directory per repository, e.g. org_repo/v1.2.3.cdx.json.
+func historyOutputs(repo *csv.RepoData, tag string, options sbomOptions) ([]sbom.Output, error) {
+	outputs := make([]sbom.Output, 0, len(options.Formats))
+	for _, format := range options.Formats {
+		file, err := options.layout().HistoryPath(layout.Fields{RepoURL: repo.RepoURL, Ref: tag, Format: format, Extension: options.extension(format)})
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, options.output(format, file))
+	}
+	return outputs, nil
+}
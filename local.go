@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/disk"
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/layout"
+	"github.com/bit-bom/bom-factory/pkg/metrics"
+	"github.com/bit-bom/bom-factory/pkg/progress"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// scanLocal generates SBOMs of the git checkouts found under --root without cloning them
+func scanLocal(c *cli.Context) error {
+	root, err := filepath.Abs(c.String("root"))
+	if err != nil {
+		return fmt.Errorf("invalid --root: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", c.String("db"))
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	defer db.Close()
+	// Job updates are written from every worker, serialize them on a single connection
+	db.SetMaxOpenConns(1)
+
+	generator, generatorVersion, formats, err := generatorFromFlags(c)
+	if err != nil {
+		return err
+	}
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+	mode, interval, err := progressMode(c)
+	if err != nil {
+		return err
+	}
+	sbomLayout, err := layout.Parse(c.String("layout"))
+	if err != nil {
+		return err
+	}
+	compression, err := compress.Parse(c.String("compress"))
+	if err != nil {
+		return err
+	}
+	var minFreeSpace int64
+	if c.IsSet("min-free-space") {
+		if minFreeSpace, err = disk.ParseSize(c.String("min-free-space")); err != nil {
+			return fmt.Errorf("invalid --min-free-space: %w", err)
+		}
+	}
+
+	options := sbomOptions{
+		Dir:              c.String("dir"),
+		Concurrency:      c.Int("concurrent-scans"),
+		Force:            c.Bool("force"),
+		Manifest:         c.String("manifest"),
+		Generator:        generator,
+		GeneratorVersion: generatorVersion,
+		Formats:          formats,
+		LegacyNames:      !c.IsSet("format"),
+		Timeouts:         timeoutsFromFlags(c, cfg),
+		Retry:            retry.DefaultPolicy,
+		Progress:         mode,
+		ProgressInterval: interval,
+		Metrics:          metrics.New(),
+		MinFreeSpace:     minFreeSpace,
+		Config:           cfg,
+		Layout:           sbomLayout,
+		Compress:         compression,
+	}
+
+	if addr := c.String("metrics-addr"); addr != "" {
+		server, err := options.Metrics.Serve(addr)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
+	checkouts, err := findCheckouts(root)
+	if err != nil {
+		return err
+	}
+	if len(checkouts) == 0 {
+		slog.Info("no git repositories with an origin remote found", "root", root)
+		return nil
+	}
+
+	var tasks []sbomTask
+	if c.Bool("resume") {
+		tasks, err = resumeLocalTasks(db, checkouts)
+		if err != nil {
+			return fmt.Errorf("failed to resume the previous run: %w", err)
+		}
+		if len(tasks) == 0 {
+			slog.Info("no pending or failed jobs in the previous run found under the root", "root", root)
+			return nil
+		}
+		slog.Info("resuming run", "run", tasks[0].Job.RunID, "repositories", len(tasks))
+		return generateSBOMs(c.Context, db, tasks, options)
+	}
+
+	repoURLs := make([]string, 0, len(checkouts))
+	for _, checkout := range checkouts {
+		repoURLs = append(repoURLs, checkout.RepoURL)
+	}
+	tasks, err = newSBOMTasks(db, jobs.CommandScanLocal, localRepoData(db, repoURLs))
+	if err != nil {
+		return fmt.Errorf("failed to record jobs: %w", err)
+	}
+	tasks = localTasks(tasks, checkouts)
+	slog.Info("starting run", "run", tasks[0].Job.RunID, "repositories", len(tasks), "root", root)
+
+	return generateSBOMs(c.Context, db, tasks, options)
+}
+
+// resumeLocalTasks returns the pending and failed jobs of the most recent scan-local run whose repositories are checked out
+func resumeLocalTasks(db *sql.DB, checkouts []csv.LocalRepository) ([]sbomTask, error) {
+	if err := jobs.CreateTable(db); err != nil {
+		return nil, err
+	}
+	runID, err := jobs.LatestRunID(db, jobs.CommandScanLocal)
+	if err != nil {
+		return nil, err
+	}
+	runJobs, err := jobs.Resumable(db, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	repoURLs := make([]string, 0, len(runJobs))
+	for _, job := range runJobs {
+		repoURLs = append(repoURLs, job.RepoURL)
+	}
+	repos := localRepoData(db, repoURLs)
+	tasks := make([]sbomTask, 0, len(runJobs))
+	for i, job := range runJobs {
+		tasks = append(tasks, sbomTask{Repo: repos[i], Job: job})
+	}
+	return localTasks(tasks, checkouts), nil
+}
+
+// localRepoData returns the repos with the given URLs in the same order. The repos table is optional
+// for local scans, without it the repos only have RepoURL set and are scanned without their metadata.
+func localRepoData(db *sql.DB, repoURLs []string) []csv.RepoData {
+	repos, err := csv.GetReposByURL(db, repoURLs)
+	if err == nil {
+		return repos
+	}
+	slog.Debug("repository metadata not available", "error", err)
+	repos = make([]csv.RepoData, 0, len(repoURLs))
+	for _, repoURL := range repoURLs {
+		repos = append(repos, csv.RepoData{RepoURL: repoURL})
+	}
+	return repos
+}
+
+// findCheckouts returns the git checkouts under root by repository URL, skipping those without
+// an origin remote and all but the first checkout of the same repository
+func findCheckouts(root string) ([]csv.LocalRepository, error) {
+	dirs, err := csv.FindRepositories(root)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]string, len(dirs))
+	checkouts := make([]csv.LocalRepository, 0, len(dirs))
+	for _, dir := range dirs {
+		checkout, err := csv.OpenLocal(dir)
+		if err != nil {
+			slog.Warn("skipping repository", "dir", dir, "error", err)
+			continue
+		}
+		// SBOMs are named after the repository, a second checkout would overwrite them
+		if first, ok := seen[checkout.RepoURL]; ok {
+			slog.Warn("skipping repository checked out twice", "dir", dir, "repo", checkout.RepoURL, "scanned", first)
+			continue
+		}
+		seen[checkout.RepoURL] = dir
+		checkouts = append(checkouts, checkout)
+	}
+	return checkouts, nil
+}
+
+// localTasks attaches the checkout of each task's repository, dropping tasks without one
+func localTasks(tasks []sbomTask, checkouts []csv.LocalRepository) []sbomTask {
+	dirs := make(map[string]string, len(checkouts))
+	for _, checkout := range checkouts {
+		dirs[checkout.RepoURL] = checkout.Dir
+	}
+
+	local := make([]sbomTask, 0, len(tasks))
+	for _, task := range tasks {
+		dir, ok := dirs[task.Repo.RepoURL]
+		if !ok {
+			slog.Warn("repository not checked out under the root", "repo", task.Repo.RepoURL)
+			continue
+		}
+		task.Dir = dir
+		local = append(local, task)
+	}
+	return local
+}
+
+// processLocalTask generates the SBOMs of a local checkout in place, recording the checked out
+// branch and commit. Uncommitted changes are scanned but not detected by the up-to-date check.
+func processLocalTask(ctx context.Context, db *sql.DB, task *sbomTask, options sbomOptions) progress.Outcome {
+	start := time.Now()
+	checkout, err := csv.OpenLocal(task.Dir)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, csv.ResolvedRef{}, start, err)
+	}
+	ref := checkout.Head
+
+	outputs, err := sbomOutputs(&task.Repo, ref.Name, true, options)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+	if err := claimOutputs(db, task.Repo.RepoURL, outputs, options); err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+	if !options.Force {
+		if outputFiles, upToDate := sbomUpToDate(db, &task.Repo, ref, outputs, options); upToDate {
+			return skipSBOMTask(db, task, options, ref, outputFiles, "up to date")
+		}
+	}
+
+	size, err := csv.DirSize(task.Dir)
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, fmt.Errorf("failed to measure checkout: %w", err))
+	}
+
+	err = options.Retry.Do(ctx, func(attempt int) error {
+		if attempt > 1 {
+			if err := jobs.Start(db, task.Job.ID); err != nil {
+				slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+			}
+			start = time.Now()
+		}
+		err := scanSBOM(ctx, &task.Repo, task.Dir, size, "", outputs, options)
+		recordAttempt(ctx, &task.Repo, options, attempt, err)
+		return err
+	})
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+
+	result := jobs.Result{
+		Duration:         time.Since(start),
+		CommitSHA:        ref.CommitSHA,
+		Ref:              ref.Name,
+		Generator:        options.Generator.Name(),
+		GeneratorVersion: options.GeneratorVersion,
+	}
+	for _, output := range outputs {
+		result.OutputPaths = append(result.OutputPaths, output.File)
+	}
+	return succeedSBOMTask(db, task, options, result)
+}
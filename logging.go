@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/progress"
+	"github.com/urfave/cli/v2"
+)
+
+// console is shared by the logger and progress displays so log lines do not overwrite a live status line
+var console = progress.NewConsole(os.Stderr)
+
+// progressMode returns the progress mode and log interval selected with the global flags
+func progressMode(c *cli.Context) (progress.Mode, time.Duration, error) {
+	mode, err := progress.ParseMode(c.String("progress"))
+	if err != nil {
+		return "", 0, err
+	}
+	return mode, c.Duration("progress-interval"), nil
+}
+
+// setupLogging installs the default logger, writing to w so that stdout stays reserved for results
+func setupLogging(c *cli.Context, w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.String("log-level"))); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", c.String("log-level"))
+	}
+	handlerOptions := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch strings.ToLower(c.String("log-format")) {
+	case "text":
+		handler = slog.NewTextHandler(w, handlerOptions)
+	case "json":
+		handler = slog.NewJSONHandler(w, handlerOptions)
+	default:
+		return fmt.Errorf("invalid log format %q, expected text or json", c.String("log-format"))
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return nil
+}
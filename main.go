@@ -1,18 +1,32 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
-	"net/url"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"slices"
 	"strings"
-	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/bit-bom/bom-factory/pkg/bundle"
+	"github.com/bit-bom/bom-factory/pkg/compress"
+	"github.com/bit-bom/bom-factory/pkg/config"
 	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/disk"
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/layout"
+	"github.com/bit-bom/bom-factory/pkg/metrics"
+	"github.com/bit-bom/bom-factory/pkg/progress"
+	"github.com/bit-bom/bom-factory/pkg/retry"
 	"github.com/bit-bom/bom-factory/pkg/sbom"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/urfave/cli/v2"
@@ -26,6 +40,40 @@ func main() {
 	app := &cli.App{
 		Name:  "bomfactory",
 		Usage: "Load CSV data into SQLite and query it",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "config",
+				Value:    config.DefaultPath,
+				Usage:    "Path to the configuration file defining presets",
+				EnvVars:  []string{"BOMFACTORY_CONFIG"},
+				Required: false,
+			},
+			&cli.StringFlag{
+				Name:    "log-level",
+				Value:   "info",
+				Usage:   "Minimum level of log messages written to stderr (debug, info, warn, error)",
+				EnvVars: []string{"BOMFACTORY_LOG_LEVEL"},
+			},
+			&cli.StringFlag{
+				Name:    "log-format",
+				Value:   "text",
+				Usage:   "Format of log messages (text, json)",
+				EnvVars: []string{"BOMFACTORY_LOG_FORMAT"},
+			},
+			&cli.StringFlag{
+				Name:  "progress",
+				Value: string(progress.ModeAuto),
+				Usage: "How to report the progress of long runs: auto (live if stdout is a terminal, log lines otherwise), live, log or none",
+			},
+			&cli.DurationFlag{
+				Name:  "progress-interval",
+				Value: 30 * time.Second,
+				Usage: "Interval between progress log lines when no live display is used",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			return setupLogging(c, console)
+		},
 		Commands: []*cli.Command{
 			{
 				Name:    "load",
@@ -95,7 +143,7 @@ func main() {
 						Name:     "filter",
 						Aliases:  []string{"f"},
 						Usage:    "Filter criteria in the format 'field:operator:value' (can be used multiple times)",
-						Required: true,
+						Required: false,
 					},
 					&cli.IntFlag{
 						Name:    "max-results",
@@ -109,14 +157,119 @@ func main() {
 						Usage:   "Number of records to skip",
 						Value:   0,
 					},
+					&cli.StringFlag{
+						Name:     "preset",
+						Aliases:  []string{"p"},
+						Usage:    "Name of a preset from the configuration file (combined with any --filter)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "order-by",
+						Usage:    "Ordering of the results, e.g. 'repo_star_count DESC' (defaults to 'default_score DESC')",
+						Required: false,
+					},
 				},
 				Action: querySQLiteData,
 			},
+			{
+				Name:  "select",
+				Usage: "Manage named, frozen selections of repositories",
+				Subcommands: []*cli.Command{
+					{
+						Name:      "save",
+						Usage:     "Save the repositories matching the filter criteria as a named selection",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "db",
+								Aliases:  []string{"d"},
+								Value:    defaultDBPath,
+								Usage:    "Path to the SQLite database file",
+								Required: false,
+							},
+							&cli.StringSliceFlag{
+								Name:     "filter",
+								Aliases:  []string{"f"},
+								Usage:    "Filter criteria in the format 'field:operator:value' (can be used multiple times)",
+								Required: false,
+							},
+							&cli.IntFlag{
+								Name:    "max-results",
+								Aliases: []string{"m"},
+								Usage:   "Maximum number of results to return",
+								Value:   100,
+							},
+							&cli.IntFlag{
+								Name:    "skip",
+								Aliases: []string{"s"},
+								Usage:   "Number of records to skip",
+								Value:   0,
+							},
+							&cli.StringFlag{
+								Name:     "preset",
+								Aliases:  []string{"p"},
+								Usage:    "Name of a preset from the configuration file (combined with any --filter)",
+								Required: false,
+							},
+							&cli.StringFlag{
+								Name:     "order-by",
+								Usage:    "Ordering of the results, e.g. 'repo_star_count DESC' (defaults to 'default_score DESC')",
+								Required: false,
+							},
+						},
+						Action: saveSelection,
+					},
+					{
+						Name:  "list",
+						Usage: "List saved selections",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "db",
+								Aliases:  []string{"d"},
+								Value:    defaultDBPath,
+								Usage:    "Path to the SQLite database file",
+								Required: false,
+							},
+						},
+						Action: listSelections,
+					},
+					{
+						Name:      "show",
+						Usage:     "Show the repositories of a saved selection",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "db",
+								Aliases:  []string{"d"},
+								Value:    defaultDBPath,
+								Usage:    "Path to the SQLite database file",
+								Required: false,
+							},
+						},
+						Action: showSelection,
+					},
+					{
+						Name:      "diff",
+						Usage:     "Show the repositories added and removed between two saved selections",
+						ArgsUsage: "<from> <to>",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:     "db",
+								Aliases:  []string{"d"},
+								Value:    defaultDBPath,
+								Usage:    "Path to the SQLite database file",
+								Required: false,
+							},
+						},
+						Action: diffSelections,
+					},
+				},
+			},
 			{
 				Name:    "download-sbom",
 				Aliases: []string{"ds"},
 				Usage:   "Download SBOM for repositories matching the filter criteria",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:     "db",
 						Aliases:  []string{"d"},
@@ -128,7 +281,12 @@ func main() {
 						Name:     "filter",
 						Aliases:  []string{"f"},
 						Usage:    "Filter criteria in the format 'field:operator:value' (can be used multiple times)",
-						Required: true,
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "selection",
+						Usage:    "Name of a saved selection to use instead of --filter",
+						Required: false,
 					},
 					&cli.StringFlag{
 						Name:     "dir",
@@ -156,15 +314,262 @@ func main() {
 						Usage:   "Number of records to skip",
 						Value:   0,
 					},
+					&cli.StringFlag{
+						Name:     "preset",
+						Aliases:  []string{"p"},
+						Usage:    "Name of a preset from the configuration file (combined with any --filter)",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "order-by",
+						Usage:    "Ordering of the results, e.g. 'repo_star_count DESC' (defaults to 'default_score DESC')",
+						Required: false,
+					},
 					&cli.IntFlag{
 						Name:    "concurrent-downloads",
 						Aliases: []string{"cd"},
 						Usage:   "Maximum number of concurrent downloads",
 						Value:   2,
 					},
-				},
+					&cli.BoolFlag{
+						Name:  "resume",
+						Usage: "Resume the pending and failed jobs of the previous run",
+					},
+					&cli.StringFlag{
+						Name:     "generator",
+						Aliases:  []string{"g"},
+						Value:    sbom.DefaultGenerator,
+						Usage:    "SBOM generator to use (" + strings.Join(sbom.GeneratorNames(), ", ") + ")",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "catalogers",
+						Usage:    "Cataloger selection for the syft-lib generator, e.g. '-go-module-binary-cataloger' or '+sbom-cataloger'",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "format",
+						Value:    cli.NewStringSlice(string(sbom.DefaultFormat)),
+						Usage:    "SBOM output format(s), one file per format (cyclonedx-json@1.5, cyclonedx-json@1.6, cyclonedx-xml, spdx-json, spdx-tag-value)",
+						Required: false,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Maximum time to generate one SBOM (defaults to the config file's timeouts.default or " + sbom.DefaultTimeout.String() + ")",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout-per-mb",
+						Usage: "Additional generation time per MB of cloned repository",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Regenerate SBOMs even if they are up to date with the remote HEAD, and retry repositories that failed permanently",
+					},
+					&cli.StringFlag{
+						Name:  "manifest",
+						Usage: "Path of the JSON run manifest (defaults to manifest-<run id>.json in the SBOM directory)",
+					},
+					&cli.StringFlag{
+						Name:  "compress",
+						Value: "none",
+						Usage: "Compress the SBOM files (none, gzip, zstd), adding .gz or .zst to their names",
+					},
+					&cli.StringFlag{
+						Name:  "layout",
+						Value: layout.DefaultName,
+						Usage: "Paths of the SBOM files in the SBOM directory: " + strings.Join(layout.Names(), ", ") + ", or a template such as '{host}/{owner}/{repo}/{ref}.{format}'",
+					},
+					&cli.StringFlag{
+						Name:  "max-repo-size",
+						Usage: "Skip repositories larger than this size, e.g. 2GB, checked with the GitHub API before cloning and enforced during the clone",
+					},
+					&cli.StringFlag{
+						Name:  "min-free-space",
+						Usage: "Pause workers while the temporary or SBOM directory has less free space than this, e.g. 10GB",
+					},
+					&cli.StringFlag{
+						Name:  "fetch",
+						Value: string(fetchClone),
+						Usage: "How to download repositories: clone, or archive to download a source archive of the ref using the host's archive URL template",
+					},
+					&cli.StringFlag{
+						Name:  "cache-dir",
+						Usage: "Keep bare mirrors of the repositories in this directory so later runs only fetch new objects",
+					},
+					&cli.StringFlag{
+						Name:  "cache-max-size",
+						Usage: "Evict the least recently used mirrors at the end of a run once the cache is larger than this, e.g. 50GB",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-addr",
+						Usage: "Address to expose Prometheus metrics on at /metrics, e.g. :9090 (disabled by default)",
+					},
+					&cli.IntFlag{
+						Name:  "retries",
+						Value: retry.DefaultPolicy.MaxAttempts - 1,
+						Usage: "Number of times a clone or scan failing with a transient error is retried",
+					},
+					&cli.DurationFlag{
+						Name:  "retry-delay",
+						Value: retry.DefaultPolicy.BaseDelay,
+						Usage: "Delay before the first retry, doubled for every further retry",
+					},
+					&cli.StringFlag{
+						Name:  "ref",
+						Value: csv.RefDefault,
+						Usage: "Git ref to scan: default, latest-tag, latest-semver, or a branch, tag or commit SHA (overridden per repository by refs in the config file)",
+					},
+					&cli.StringFlag{
+						Name:  "checkout",
+						Value: string(checkoutFull),
+						Usage: "Files to check out for scanning: full, sparse (only manifests and lock files) or compare (full, also reporting what a sparse checkout would miss)",
+					},
+					&cli.IntFlag{
+						Name:  "history",
+						Usage: "Generate an SBOM for each of the last N semantic version release tags instead of a single ref",
+					},
+					&cli.StringFlag{
+						Name:  "since",
+						Usage: "Generate an SBOM for each semantic version release tagged since this date (YYYY-MM-DD or RFC 3339), combined with --history if both are set",
+					},
+				}, credentialFlags...),
 				Action: downloadSBOMs,
 			},
+			{
+				Name:  "scan-local",
+				Usage: "Generate SBOMs of the git checkouts under a directory in place, named after their origin remote",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "db",
+						Aliases:  []string{"d"},
+						Value:    defaultDBPath,
+						Usage:    "Path to the SQLite database file recording the jobs",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "root",
+						Usage:    "Directory to search for git checkouts",
+						Required: true,
+					},
+					&cli.StringFlag{
+						Name:     "dir",
+						Aliases:  []string{"o"},
+						Value:    defaultSBOMDir,
+						Usage:    "Directory to save the SBOM files",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:    "concurrent-scans",
+						Aliases: []string{"cs"},
+						Usage:   "Maximum number of concurrent scans",
+						Value:   2,
+					},
+					&cli.BoolFlag{
+						Name:  "resume",
+						Usage: "Scan the pending and failed repositories of the previous run again",
+					},
+					&cli.StringFlag{
+						Name:     "generator",
+						Aliases:  []string{"g"},
+						Value:    sbom.DefaultGenerator,
+						Usage:    "SBOM generator to use (" + strings.Join(sbom.GeneratorNames(), ", ") + ")",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "catalogers",
+						Usage:    "Cataloger selection for the syft-lib generator, e.g. '-go-module-binary-cataloger' or '+sbom-cataloger'",
+						Required: false,
+					},
+					&cli.StringSliceFlag{
+						Name:     "format",
+						Value:    cli.NewStringSlice(string(sbom.DefaultFormat)),
+						Usage:    "SBOM output format(s), one file per format (cyclonedx-json@1.5, cyclonedx-json@1.6, cyclonedx-xml, spdx-json, spdx-tag-value)",
+						Required: false,
+					},
+					&cli.DurationFlag{
+						Name:  "timeout",
+						Usage: "Maximum time to generate one SBOM (defaults to the config file's timeouts.default or " + sbom.DefaultTimeout.String() + ")",
+					},
+					&cli.DurationFlag{
+						Name:  "timeout-per-mb",
+						Usage: "Additional generation time per MB of checkout",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "Regenerate SBOMs even if they are up to date with the checked out commit",
+					},
+					&cli.StringFlag{
+						Name:  "manifest",
+						Usage: "Path of the JSON run manifest (defaults to manifest-<run id>.json in the SBOM directory)",
+					},
+					&cli.StringFlag{
+						Name:  "compress",
+						Value: "none",
+						Usage: "Compress the SBOM files (none, gzip, zstd), adding .gz or .zst to their names",
+					},
+					&cli.StringFlag{
+						Name:  "layout",
+						Value: layout.DefaultName,
+						Usage: "Paths of the SBOM files in the SBOM directory: " + strings.Join(layout.Names(), ", ") + ", or a template such as '{host}/{owner}/{repo}/{ref}.{format}'",
+					},
+					&cli.StringFlag{
+						Name:  "min-free-space",
+						Usage: "Pause workers while the SBOM directory has less free space than this, e.g. 10GB",
+					},
+					&cli.StringFlag{
+						Name:  "metrics-addr",
+						Usage: "Address to expose Prometheus metrics on at /metrics, e.g. :9090 (disabled by default)",
+					},
+				},
+				Action: scanLocal,
+			},
+			{
+				Name:  "shell",
+				Usage: "Start an interactive query shell over the SQLite data",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "db",
+						Aliases:  []string{"d"},
+						Value:    defaultDBPath,
+						Usage:    "Path to the SQLite database file",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:    "max-results",
+						Aliases: []string{"m"},
+						Usage:   "Maximum number of results to return",
+						Value:   100,
+					},
+					&cli.StringFlag{
+						Name:     "dir",
+						Aliases:  []string{"o"},
+						Value:    defaultSBOMDir,
+						Usage:    "Directory to save the SBOM files",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "temp-dir",
+						Aliases:  []string{"t"},
+						Value:    os.TempDir(), // Default to system temp directory
+						Usage:    "Directory to use for temporary files",
+						Required: false,
+					},
+					&cli.IntFlag{
+						Name:    "concurrent-downloads",
+						Aliases: []string{"cd"},
+						Usage:   "Maximum number of concurrent downloads",
+						Value:   2,
+					},
+					&cli.StringFlag{
+						Name:     "generator",
+						Aliases:  []string{"g"},
+						Value:    sbom.DefaultGenerator,
+						Usage:    "SBOM generator to use (" + strings.Join(sbom.GeneratorNames(), ", ") + ")",
+						Required: false,
+					},
+				}, credentialFlags...),
+				Action: runShell,
+			},
 			{
 				Name:    "convert-to-purl",
 				Aliases: []string{"cp"},
@@ -173,13 +578,13 @@ func main() {
 					&cli.StringFlag{
 						Name:     "file",
 						Aliases:  []string{"f"},
-						Usage:    "Path to the SPDX JSON file",
+						Usage:    "Path to the SPDX JSON file, which may be compressed, or a bundle",
 						Required: false,
 					},
 					&cli.StringFlag{
 						Name:     "dir",
 						Aliases:  []string{"d"},
-						Usage:    "Path to the directory containing SPDX JSON files",
+						Usage:    "Path to the directory containing SPDX JSON files and bundles",
 						Required: false,
 					},
 				},
@@ -193,27 +598,78 @@ func main() {
 					&cli.StringFlag{
 						Name:     "file",
 						Aliases:  []string{"f"},
-						Usage:    "Path to the SBOM file",
+						Usage:    "Path to the SBOM file, which may be compressed, or a bundle",
 						Required: false,
 					},
 					&cli.StringFlag{
 						Name:     "dir",
 						Aliases:  []string{"d"},
-						Usage:    "Path to the directory containing SBOM files",
+						Usage:    "Path to the directory containing SBOM files and bundles",
 						Required: false,
 					},
 				},
 				Action: validateSBOM,
 			},
+			{
+				Name:  "bundle",
+				Usage: "Pack a directory of SBOMs into a zstd compressed tar archive starting with an index of its files",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:     "dir",
+						Aliases:  []string{"d"},
+						Value:    defaultSBOMDir,
+						Usage:    "Directory containing the SBOM files",
+						Required: false,
+					},
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Path of the bundle to write, ending with " + bundle.Extension,
+						Required: true,
+					},
+				},
+				Action: bundleSBOMs,
+			},
 		},
 	}
 
-	err := app.Run(os.Args)
+	ctx, stop := interruptContext()
+	err := app.RunContext(ctx, os.Args)
+	stop()
 	if err != nil {
-		log.Fatal(err)
+		slog.Error(err.Error())
+		os.Exit(1)
 	}
 }
 
+// interactive is set while the shell reads commands. Its commands stop on SIGINT themselves,
+// so meanwhile the root context is only canceled by SIGTERM.
+var interactive atomic.Bool
+
+// interruptContext returns a context that is canceled on the first SIGINT or SIGTERM so runs can
+// stop cleanly. A second signal terminates the process immediately.
+func interruptContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case sig := <-signals:
+				if sig == os.Interrupt && interactive.Load() {
+					continue
+				}
+				cancel()
+				return
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
 func loadCSVToSQLite(c *cli.Context) error {
 	dbPath := c.String("db")
 	csvFilePath := c.String("csv")
@@ -273,16 +729,29 @@ func loadCSVToSQLite(c *cli.Context) error {
 		options.MaxRecords = c.Int("end") - options.StartLine
 	}
 
+	mode, interval, err := progressMode(c)
+	if err != nil {
+		return err
+	}
+	// With a record limit the number of records is known, otherwise progress follows the file offset
+	tracker := progress.New("Loading", "records", options.MaxRecords, console, mode, interval)
+	options.Progress = func(fraction float64) {
+		tracker.Add(progress.Succeeded, 1)
+		if options.MaxRecords == 0 {
+			tracker.SetFraction(fraction)
+		}
+	}
+	tracker.Start()
 	err = csv.LoadCSVToSQLite(csvFilePath, db, options)
+	tracker.Stop()
 	if err != nil {
 		return fmt.Errorf("failed to load CSV data into SQLite: %w", err)
 	}
 
 	if c.IsSet("start") || c.IsSet("end") {
-		fmt.Printf("CSV data from %s (lines %d to %d) successfully loaded into SQLite at %s\n",
-			csvFilePath, options.StartLine, c.Int("end"), dbPath)
+		slog.Info("CSV data loaded into SQLite", "csv", csvFilePath, "start", options.StartLine, "end", c.Int("end"), "db", dbPath)
 	} else {
-		fmt.Printf("CSV data from %s successfully loaded into SQLite at %s\n", csvFilePath, dbPath)
+		slog.Info("CSV data loaded into SQLite", "csv", csvFilePath, "db", dbPath)
 	}
 	return nil
 }
@@ -296,7 +765,7 @@ func downloadCSV(c *cli.Context) error {
 		return fmt.Errorf("failed to download CSV file: %w", err)
 	}
 
-	fmt.Printf("CSV file downloaded successfully to %s\n", output)
+	slog.Info("CSV file downloaded", "output", output)
 	return nil
 }
 
@@ -319,7 +788,6 @@ func downloadFile(url, filepath string) error {
 
 func querySQLiteData(c *cli.Context) error {
 	dbPath := c.String("db")
-	filterArgs := c.StringSlice("filter")
 
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
@@ -327,19 +795,9 @@ func querySQLiteData(c *cli.Context) error {
 	}
 	defer db.Close()
 
-	var filterCriteria []csv.FilterCriteria
-	for _, arg := range filterArgs {
-		criterion, err := csv.ParseFilterCriteria(arg)
-		if err != nil {
-			return fmt.Errorf("invalid filter criteria: %w", err)
-		}
-		filterCriteria = append(filterCriteria, criterion)
-	}
-
-	options := csv.FilterOptions{
-		Criteria:    filterCriteria,
-		MaxResults:  c.Int("max-results"),
-		SkipRecords: c.Int("skip"),
+	options, err := filterOptionsFromFlags(c)
+	if err != nil {
+		return err
 	}
 
 	filteredData, err := csv.FilterSQLiteData(db, options)
@@ -357,120 +815,410 @@ func querySQLiteData(c *cli.Context) error {
 	return nil
 }
 
-func downloadSBOMs(c *cli.Context) error {
+func saveSelection(c *cli.Context) error {
 	dbPath := c.String("db")
-	filterArgs := c.StringSlice("filter")
-	dir := c.String("dir")
-	tempBaseDir := c.String("temp-dir")                     // Use the temp-dir flag
-	maxConcurrentDownloads := c.Int("concurrent-downloads") // Get the value from the flag
+	name := c.Args().First()
+	if name == "" || c.NArg() > 1 {
+		return fmt.Errorf("exactly one selection name must be provided")
+	}
 
-	// Open SQLite database
 	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
 		return fmt.Errorf("failed to open sqlite database: %w", err)
 	}
 	defer db.Close()
 
+	options, err := filterOptionsFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	filteredData, err := csv.FilterSQLiteData(db, options)
+	if err != nil {
+		return fmt.Errorf("failed to filter SQLite data: %w", err)
+	}
+
+	selection, err := csv.SaveSelection(db, name, options, filteredData)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("saved selection", "selection", selection.Name, "repositories", len(selection.RepoURLs))
+	return nil
+}
+
+func listSelections(c *cli.Context) error {
+	db, err := sql.Open("sqlite3", c.String("db"))
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	defer db.Close()
+
+	selections, err := csv.ListSelections(db)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tREPOS\tCREATED\tSNAPSHOT\tFILTER")
+	for _, selection := range selections {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n",
+			selection.Name, len(selection.RepoURLs), selection.CreatedAt, selection.Snapshot, selection.Filter)
+	}
+	return w.Flush()
+}
+
+func showSelection(c *cli.Context) error {
+	name := c.Args().First()
+	if name == "" {
+		return fmt.Errorf("a selection name must be provided")
+	}
+
+	db, err := sql.Open("sqlite3", c.String("db"))
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	defer db.Close()
+
+	selection, err := csv.GetSelection(db, name)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Name:     %s\n", selection.Name)
+	fmt.Printf("Created:  %s\n", selection.CreatedAt)
+	fmt.Printf("Snapshot: %s\n", selection.Snapshot)
+	fmt.Printf("Filter:   %s\n", selection.Filter)
+	fmt.Printf("Repos:    %d\n", len(selection.RepoURLs))
+	for _, repoURL := range selection.RepoURLs {
+		fmt.Println(repoURL)
+	}
+	return nil
+}
+
+func diffSelections(c *cli.Context) error {
+	if c.NArg() != 2 {
+		return fmt.Errorf("two selection names must be provided")
+	}
+
+	db, err := sql.Open("sqlite3", c.String("db"))
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	defer db.Close()
+
+	from, err := csv.GetSelection(db, c.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	to, err := csv.GetSelection(db, c.Args().Get(1))
+	if err != nil {
+		return err
+	}
+
+	diff := csv.DiffSelections(from, to)
+	for _, repoURL := range diff.Removed {
+		fmt.Printf("- %s\n", repoURL)
+	}
+	for _, repoURL := range diff.Added {
+		fmt.Printf("+ %s\n", repoURL)
+	}
+	fmt.Printf("%d removed, %d added, %d unchanged\n", len(diff.Removed), len(diff.Added), diff.Common)
+	return nil
+}
+
+// loadConfig reads the configuration file, which is only required to exist when --config is set
+func loadConfig(c *cli.Context) (*config.Config, error) {
+	return config.Load(c.String("config"), c.IsSet("config"))
+}
+
+// filterOptionsFromFlags builds the filter options from the filter, max-results and skip flags
+func filterOptionsFromFlags(c *cli.Context) (csv.FilterOptions, error) {
+	filterArgs := c.StringSlice("filter")
+	maxResults := c.Int("max-results")
+	skip := c.Int("skip")
+	orderBy := c.String("order-by")
+
+	if presetName := c.String("preset"); presetName != "" {
+		cfg, err := loadConfig(c)
+		if err != nil {
+			return csv.FilterOptions{}, err
+		}
+		preset, err := cfg.Preset(presetName)
+		if err != nil {
+			return csv.FilterOptions{}, err
+		}
+
+		// Flags given on the command line take precedence over the preset
+		filterArgs = append(append([]string{}, preset.Filters...), filterArgs...)
+		if !c.IsSet("max-results") && preset.MaxResults > 0 {
+			maxResults = preset.MaxResults
+		}
+		if !c.IsSet("skip") && preset.Skip > 0 {
+			skip = preset.Skip
+		}
+		if !c.IsSet("order-by") && preset.OrderBy != "" {
+			orderBy = preset.OrderBy
+		}
+	}
+
+	if len(filterArgs) == 0 {
+		return csv.FilterOptions{}, fmt.Errorf("at least one --filter or a --preset must be specified")
+	}
+
 	var filterCriteria []csv.FilterCriteria
 	for _, arg := range filterArgs {
 		criterion, err := csv.ParseFilterCriteria(arg)
 		if err != nil {
-			return fmt.Errorf("invalid filter criteria: %w", err)
+			return csv.FilterOptions{}, fmt.Errorf("invalid filter criteria: %w", err)
 		}
 		filterCriteria = append(filterCriteria, criterion)
 	}
 
-	options := csv.FilterOptions{
+	return csv.FilterOptions{
 		Criteria:    filterCriteria,
-		MaxResults:  c.Int("max-results"),
-		SkipRecords: c.Int("skip"),
+		MaxResults:  maxResults,
+		SkipRecords: skip,
+		OrderBy:     orderBy,
+	}, nil
+}
+
+// generatorFromFlags returns the SBOM generator selected with --generator and --catalogers,
+// its version and the output formats selected with --format
+func generatorFromFlags(c *cli.Context) (sbom.Generator, string, []sbom.Format, error) {
+	generator, err := sbom.NewGenerator(c.String("generator"))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if library, ok := generator.(*sbom.SyftLibrary); ok {
+		library.Catalogers = c.StringSlice("catalogers")
+	} else if c.IsSet("catalogers") {
+		return nil, "", nil, fmt.Errorf("--catalogers is only supported by the syft-lib generator")
 	}
+	generatorVersion, err := generator.Version(c.Context)
+	if err != nil {
+		return nil, "", nil, err
+	}
+	formats, err := sbom.ParseFormats(c.StringSlice("format"))
+	if err != nil {
+		return nil, "", nil, err
+	}
+	if err := sbom.CheckFormats(generator, formats); err != nil {
+		return nil, "", nil, err
+	}
+	return generator, generatorVersion, formats, nil
+}
 
-	filteredData, err := csv.FilterSQLiteData(db, options)
+// timeoutsFromFlags returns the generation timeouts of the config file, overridden by --timeout and --timeout-per-mb
+func timeoutsFromFlags(c *cli.Context, cfg *config.Config) sbom.TimeoutPolicy {
+	timeouts := sbom.TimeoutPolicy{
+		Default:   cfg.Timeouts.Default,
+		PerMB:     cfg.Timeouts.PerMB,
+		Languages: cfg.Timeouts.Languages,
+	}
+	if c.IsSet("timeout") {
+		timeouts.Default = c.Duration("timeout")
+	}
+	if c.IsSet("timeout-per-mb") {
+		timeouts.PerMB = c.Duration("timeout-per-mb")
+	}
+	return timeouts
+}
+
+func downloadSBOMs(c *cli.Context) error {
+	dbPath := c.String("db")
+	selectionName := c.String("selection")
+	dir := c.String("dir")
+	tempBaseDir := c.String("temp-dir")                     // Use the temp-dir flag
+	maxConcurrentDownloads := c.Int("concurrent-downloads") // Get the value from the flag
+
+	// Open SQLite database
+	db, err := sql.Open("sqlite3", dbPath)
 	if err != nil {
-		return fmt.Errorf("failed to filter SQLite data: %w", err)
+		return fmt.Errorf("failed to open sqlite database: %w", err)
 	}
+	defer db.Close()
+	// Job updates are written from every worker, serialize them on a single connection
+	db.SetMaxOpenConns(1)
 
-	if len(filteredData) == 0 {
-		fmt.Println("No repositories matching the criteria")
-		return nil
+	generator, generatorVersion, formats, err := generatorFromFlags(c)
+	if err != nil {
+		return err
 	}
 
-	// Ensure the directory exists
-	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
-		return fmt.Errorf("failed to create directory: %w", err)
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
 	}
+	timeouts := timeoutsFromFlags(c, cfg)
 
-	// Create a channel to send download tasks to workers
-	tasks := make(chan *csv.RepoData, len(filteredData))
-	var wg sync.WaitGroup
+	mode, interval, err := progressMode(c)
+	if err != nil {
+		return err
+	}
 
-	// Start worker goroutines
-	for i := 0; i < maxConcurrentDownloads; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for repo := range tasks {
-				// Create a temporary directory for cloning
-				tempDir, err := os.MkdirTemp(tempBaseDir, "repo-clone-")
-				if err != nil {
-					fmt.Printf("Failed to create temporary directory for %s: %v\n", repo.RepoURL, err)
-					continue
-				}
+	credentials, err := credentialsFromFlags(c)
+	if err != nil {
+		return err
+	}
 
-				// Clone the repository
-				err = csv.CloneRepo(repo.RepoURL, tempDir)
-				if err != nil {
-					os.RemoveAll(tempDir)
-					fmt.Printf("Failed to clone repository %s: %v\n", repo.RepoURL, err)
-					continue
-				}
+	var maxRepoSize, minFreeSpace int64
+	if c.IsSet("max-repo-size") {
+		if maxRepoSize, err = disk.ParseSize(c.String("max-repo-size")); err != nil {
+			return fmt.Errorf("invalid --max-repo-size: %w", err)
+		}
+	}
+	if c.IsSet("min-free-space") {
+		if minFreeSpace, err = disk.ParseSize(c.String("min-free-space")); err != nil {
+			return fmt.Errorf("invalid --min-free-space: %w", err)
+		}
+	}
 
-				parsedURL, err := url.Parse(repo.RepoURL)
-				if err != nil {
-					os.RemoveAll(tempDir)
-					fmt.Printf("Failed to parse URL %s: %v\n", repo.RepoURL, err)
-					continue
-				}
+	var cache *csv.Cache
+	if cacheDir := c.String("cache-dir"); cacheDir != "" {
+		var cacheMaxSize int64
+		if c.IsSet("cache-max-size") {
+			if cacheMaxSize, err = disk.ParseSize(c.String("cache-max-size")); err != nil {
+				return fmt.Errorf("invalid --cache-max-size: %w", err)
+			}
+		}
+		if cache, err = csv.NewCache(cacheDir, cacheMaxSize); err != nil {
+			return err
+		}
+	} else if c.IsSet("cache-max-size") {
+		return fmt.Errorf("--cache-max-size requires --cache-dir")
+	}
 
-				pathSegments := strings.Split(parsedURL.Path, "/")
-				if len(pathSegments) < 3 {
-					os.RemoveAll(tempDir)
-					fmt.Printf("Invalid repository URL format: %s\n", repo.RepoURL)
-					continue
-				}
+	if delay := c.Duration("retry-delay"); delay < 0 || delay > retry.DefaultPolicy.MaxDelay {
+		return fmt.Errorf("--retry-delay must be between 0 and %s, the longest delay between retries", retry.DefaultPolicy.MaxDelay)
+	}
 
-				orgName := pathSegments[1]
-				repoName := pathSegments[2]
-				safeOrgName := url.PathEscape(orgName)
-				safeRepoName := url.PathEscape(repoName)
-				fileName := fmt.Sprintf("%s_%s.sbom.json", safeOrgName, safeRepoName)
-				outputFile := filepath.Join(dir, fileName)
-				// Remove the scheme (http:// or https://) from the RepoURL
-				repoURLWithoutScheme := strings.TrimPrefix(repo.RepoURL, "http://")
-				repoURLWithoutScheme = strings.TrimPrefix(repoURLWithoutScheme, "https://")
-				// Generate SBOM using Syft
-				err = sbom.GenerateSBOMWithCycloneDX(tempDir, outputFile, repoURLWithoutScheme)
-				if err != nil {
-					fmt.Printf("Failed to generate SBOM for %s: %v\n", repo.RepoURL, err)
-					os.RemoveAll(tempDir)
-					continue
-				}
+	history, err := historyFromFlags(c)
+	if err != nil {
+		return err
+	}
+	fetch, err := parseFetchStrategy(c.String("fetch"))
+	if err != nil {
+		return err
+	}
+	if fetch == fetchArchive && (history.enabled() || cache != nil) {
+		return fmt.Errorf("--fetch archive cannot be combined with --history, --since or --cache-dir")
+	}
+	checkout, err := parseCheckoutMode(c.String("checkout"))
+	if err != nil {
+		return err
+	}
+	if history.enabled() && checkout != checkoutFull {
+		return fmt.Errorf("--checkout %s cannot be combined with --history or --since", checkout)
+	}
+	if checkout == checkoutCompare && !slices.ContainsFunc(formats, sbom.Format.Readable) {
+		return fmt.Errorf("--checkout compare needs a --format of %s or %s to count components", sbom.FormatCycloneDXJSON15, sbom.FormatSPDXJSON)
+	}
+	sbomLayout, err := layout.Parse(c.String("layout"))
+	if err != nil {
+		return err
+	}
+	compression, err := compress.Parse(c.String("compress"))
+	if err != nil {
+		return err
+	}
+	if history.enabled() && !sbomLayout.HasRef() {
+		return fmt.Errorf("--history and --since require a --layout containing {ref} or {@ref}")
+	}
 
-				fmt.Printf("SBOM for %s generated and saved successfully\n", repo.RepoURL)
-				os.RemoveAll(tempDir)
-			}
-		}()
+	options := sbomOptions{
+		Dir:              dir,
+		TempDir:          tempBaseDir,
+		Concurrency:      maxConcurrentDownloads,
+		Force:            c.Bool("force"),
+		Manifest:         c.String("manifest"),
+		Generator:        generator,
+		GeneratorVersion: generatorVersion,
+		Formats:          formats,
+		LegacyNames:      !c.IsSet("format"),
+		Timeouts:         timeouts,
+		Retry: retry.Policy{
+			MaxAttempts: c.Int("retries") + 1,
+			BaseDelay:   c.Duration("retry-delay"),
+			MaxDelay:    retry.DefaultPolicy.MaxDelay,
+		},
+		Progress:         mode,
+		ProgressInterval: interval,
+		Metrics:          metrics.New(),
+		MaxRepoSize:      maxRepoSize,
+		MinFreeSpace:     minFreeSpace,
+		Credentials:      credentials,
+		Ref:              c.String("ref"),
+		Config:           cfg,
+		History:          history,
+		Checkout:         checkout,
+		Cache:            cache,
+		Fetch:            fetch,
+		ArchiveTemplates: archiveTemplates(cfg),
+		Layout:           sbomLayout,
+		Compress:         compression,
 	}
 
-	// Send download tasks to the workers
-	for i := 0; i < len(filteredData); i++ {
-		tasks <- &filteredData[i]
+	if addr := c.String("metrics-addr"); addr != "" {
+		server, err := options.Metrics.Serve(addr)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
 	}
-	close(tasks) // Close the channel to signal workers that no more tasks are coming
 
-	wg.Wait() // Wait for all workers to complete
-	return nil
+	if c.Bool("resume") {
+		if len(c.StringSlice("filter")) > 0 || c.IsSet("preset") || selectionName != "" {
+			return fmt.Errorf("--resume cannot be combined with --filter, --preset or --selection")
+		}
+		tasks, err := resumeSBOMTasks(db)
+		if err != nil {
+			return fmt.Errorf("failed to resume the previous run: %w", err)
+		}
+		if len(tasks) == 0 {
+			slog.Info("no pending or failed jobs in the previous run")
+			return nil
+		}
+		slog.Info("resuming run", "run", tasks[0].Job.RunID, "repositories", len(tasks))
+		return generateSBOMs(c.Context, db, tasks, options)
+	}
+
+	var filteredData []csv.RepoData
+	if selectionName != "" {
+		if len(c.StringSlice("filter")) > 0 || c.IsSet("preset") {
+			return fmt.Errorf("--selection cannot be combined with --filter or --preset")
+		}
+		selection, err := csv.GetSelection(db, selectionName)
+		if err != nil {
+			return err
+		}
+		filteredData, err = csv.GetReposByURL(db, selection.RepoURLs)
+		if err != nil {
+			return fmt.Errorf("failed to load repositories of selection %s: %w", selectionName, err)
+		}
+	} else {
+		filterOptions, err := filterOptionsFromFlags(c)
+		if err != nil {
+			return err
+		}
+		filteredData, err = csv.FilterSQLiteData(db, filterOptions)
+		if err != nil {
+			return fmt.Errorf("failed to filter SQLite data: %w", err)
+		}
+	}
+
+	if len(filteredData) == 0 {
+		slog.Info("no repositories matching the criteria")
+		return nil
+	}
+
+	tasks, err := newSBOMTasks(db, jobs.CommandDownloadSBOM, filteredData)
+	if err != nil {
+		return fmt.Errorf("failed to record jobs: %w", err)
+	}
+	slog.Info("starting run", "run", tasks[0].Job.RunID, "repositories", len(tasks))
+
+	return generateSBOMs(c.Context, db, tasks, options)
 }
 
 func convertToPURL(c *cli.Context) error {
@@ -482,28 +1230,40 @@ func convertToPURL(c *cli.Context) error {
 	}
 
 	if filePath != "" {
+		if bundle.IsBundle(filePath) {
+			if err := convertBundleToPURL(filePath); err != nil {
+				return fmt.Errorf("failed to convert SPDX to PURLs: %w", err)
+			}
+			slog.Info("converted SPDX files in bundle to include PURLs", "bundle", filePath)
+			return nil
+		}
 		err := sbom.UpdateSPDXWithPURLs(filePath)
 		if err != nil {
 			return fmt.Errorf("failed to convert SPDX to PURLs: %w", err)
 		}
-		fmt.Printf("Successfully converted SPDX file to include PURLs: %s\n", filePath)
+		slog.Info("converted SPDX file to include PURLs", "file", filePath)
 		return nil
 	}
 
 	if dirPath != "" {
-		files, err := os.ReadDir(dirPath)
+		files, bundles, err := sbomFiles(dirPath)
 		if err != nil {
-			return fmt.Errorf("failed to read directory: %w", err)
+			return err
 		}
 
 		var failedFiles []string
-		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
-				filePath := fmt.Sprintf("%s/%s", dirPath, file.Name())
-				err := sbom.UpdateSPDXWithPURLs(filePath)
-				if err != nil {
-					failedFiles = append(failedFiles, fmt.Sprintf("%s: %v", filePath, err))
-				}
+		for _, filePath := range files {
+			if !isJSONSBOMFile(filePath) {
+				continue
+			}
+			err := sbom.UpdateSPDXWithPURLs(filePath)
+			if err != nil && !errors.Is(err, sbom.ErrNotSPDX) {
+				failedFiles = append(failedFiles, fmt.Sprintf("%s: %v", filePath, err))
+			}
+		}
+		for _, bundlePath := range bundles {
+			if err := convertBundleToPURL(bundlePath); err != nil {
+				failedFiles = append(failedFiles, fmt.Sprintf("%s: %v", bundlePath, err))
 			}
 		}
 
@@ -514,7 +1274,7 @@ func convertToPURL(c *cli.Context) error {
 			return fmt.Errorf("conversion failed for %d file(s)", len(failedFiles))
 		}
 
-		fmt.Printf("Successfully converted all SPDX files in directory: %s\n", dirPath)
+		slog.Info("converted all SPDX files in directory", "dir", dirPath)
 		return nil
 	}
 
@@ -532,25 +1292,26 @@ func validateSBOM(c *cli.Context) error {
 	var failedFiles []string
 
 	if filePath != "" {
-		err := sbom.ValidateSBOM(filePath)
-		if err != nil {
+		if bundle.IsBundle(filePath) {
+			failedFiles = validateBundle(filePath)
+		} else if err := sbom.ValidateSBOM(filePath); err != nil {
 			failedFiles = append(failedFiles, fmt.Sprintf("%s: %v", filePath, err))
 		}
 	} else if dirPath != "" {
-		files, err := os.ReadDir(dirPath)
+		files, bundles, err := sbomFiles(dirPath)
 		if err != nil {
-			return fmt.Errorf("failed to read directory: %w", err)
+			return err
 		}
 
-		for _, file := range files {
-			if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
-				filePath := fmt.Sprintf("%s/%s", dirPath, file.Name())
-				err := sbom.ValidateSBOM(filePath)
-				if err != nil {
-					failedFiles = append(failedFiles, fmt.Sprintf("%s: %v", filePath, err))
-				}
+		for _, filePath := range files {
+			err := sbom.ValidateSBOM(filePath)
+			if err != nil {
+				failedFiles = append(failedFiles, fmt.Sprintf("%s: %v", filePath, err))
 			}
 		}
+		for _, bundlePath := range bundles {
+			failedFiles = append(failedFiles, validateBundle(bundlePath)...)
+		}
 	}
 
 	if len(failedFiles) > 0 {
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// outputClaims records which repository writes each SBOM file of a run
+type outputClaims struct {
+	mu     sync.Mutex
+	owners map[string]string
+}
+
+func newOutputClaims() *outputClaims {
+	return &outputClaims{owners: make(map[string]string)}
+}
+
+// claim records repoURL as the writer of path, returning the repository that claimed it
+// first if that was another one
+func (c *outputClaims) claim(path, repoURL string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if owner, ok := c.owners[path]; ok && owner != repoURL {
+		return owner, false
+	}
+	c.owners[path] = repoURL
+	return repoURL, true
+}
+
+// claimOutputs checks that no other repository writes the SBOM files of a repository, in this run or
+// an earlier one, before they are overwritten. Existing files no job recorded are only overwritten
+// with --force.
+func claimOutputs(db *sql.DB, repoURL string, outputs []sbom.Output, options sbomOptions) error {
+	for _, output := range outputs {
+		path, err := filepath.Abs(output.File)
+		if err != nil {
+			return fmt.Errorf("failed to resolve output path: %w", err)
+		}
+		if options.claims != nil {
+			if owner, ok := options.claims.claim(path, repoURL); !ok {
+				return collisionError(output.File, owner)
+			}
+		}
+
+		if _, err := os.Stat(output.File); errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to check output %s: %w", output.File, err)
+		}
+		owner, err := jobs.OutputOwner(db, output.File)
+		if err != nil {
+			return err
+		}
+		switch {
+		case owner == "" && !options.Force:
+			return retry.Classify(retry.ClassPermanent,
+				fmt.Errorf("%s already exists and was not generated by an earlier run, use --force to overwrite it", output.File))
+		case owner != "" && owner != repoURL:
+			return collisionError(output.File, owner)
+		}
+	}
+	return nil
+}
+
+func collisionError(path, owner string) error {
+	return retry.Classify(retry.ClassPermanent,
+		fmt.Errorf("SBOM file %s collides with the SBOM of %s, use a --layout that tells the repositories apart, e.g. with {host}", path, owner))
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+const (
+	repoA = "https://github.com/a_b/c"
+	repoB = "https://github.com/a/b_c"
+)
+
+func TestClaimOutputs(t *testing.T) {
+	dir := t.TempDir()
+	recorded := filepath.Join(dir, "recorded.cdx.json")
+	unknown := filepath.Join(dir, "unknown.cdx.json")
+	for _, file := range []string{recorded, unknown} {
+		if err := os.WriteFile(file, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db := openTestDB(t)
+	recordOutput(t, db, repoA, recorded)
+
+	tests := []struct {
+		name    string
+		repoURL string
+		file    string
+		force   bool
+		wantErr string
+	}{
+		{name: "new file", repoURL: repoB, file: filepath.Join(dir, "new.cdx.json")},
+		{name: "file of the same repository", repoURL: repoA, file: recorded},
+		{name: "file of another repository", repoURL: repoB, file: recorded, wantErr: "collides with the SBOM of " + repoA},
+		{name: "file of another repository with --force", repoURL: repoB, file: recorded, force: true, wantErr: "collides"},
+		{name: "file no job wrote", repoURL: repoA, file: unknown, wantErr: "use --force to overwrite it"},
+		{name: "file no job wrote with --force", repoURL: repoA, file: unknown, force: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			options := sbomOptions{Force: test.force, claims: newOutputClaims()}
+			err := claimOutputs(db, test.repoURL, []sbom.Output{{File: test.file, Format: sbom.DefaultFormat}}, options)
+			checkClaimError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestClaimOutputsInRun(t *testing.T) {
+	db := openTestDB(t)
+	options := sbomOptions{claims: newOutputClaims()}
+	file := filepath.Join(t.TempDir(), "a_b_c.cdx.json")
+	outputs := []sbom.Output{{File: file, Format: sbom.DefaultFormat}}
+
+	checkClaimError(t, claimOutputs(db, repoA, outputs, options), "")
+	// Claiming again, e.g. when a job is retried, is not a collision
+	checkClaimError(t, claimOutputs(db, repoA, outputs, options), "")
+	checkClaimError(t, claimOutputs(db, repoB, outputs, options), "collides with the SBOM of "+repoA)
+
+	// Relative and absolute paths of the same file collide
+	relative, err := filepath.Rel(mustGetwd(t), file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relativeOutputs := []sbom.Output{{File: relative, Format: sbom.DefaultFormat}}
+	checkClaimError(t, claimOutputs(db, repoB, relativeOutputs, options), "collides")
+}
+
+func checkClaimError(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	switch {
+	case wantErr == "" && err != nil:
+		t.Errorf("claimOutputs failed: %v", err)
+	case wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)):
+		t.Errorf("claimOutputs = %v, want an error containing %q", err, wantErr)
+	case wantErr != "" && retry.ClassOf(err) != retry.ClassPermanent:
+		t.Errorf("claimOutputs error is %s, want it permanent so it is not retried", retry.ClassOf(err))
+	}
+}
+
+// recordOutput records a succeeded job of repoURL that wrote file
+func recordOutput(t *testing.T, db *sql.DB, repoURL, file string) {
+	t.Helper()
+	queued, err := jobs.Enqueue(db, jobs.NewRunID(), jobs.CommandDownloadSBOM, []string{repoURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Succeed(db, queued[0].ID, jobs.Result{OutputPaths: []string{file}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustGetwd(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wd
+}
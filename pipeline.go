@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
+	"github.com/bit-bom/bom-factory/pkg/config"
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/layout"
+	"github.com/bit-bom/bom-factory/pkg/manifest"
+	"github.com/bit-bom/bom-factory/pkg/metrics"
+	"github.com/bit-bom/bom-factory/pkg/progress"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// sbomOptions holds the settings used to generate SBOMs for a list of repositories
+type sbomOptions struct {
+	Dir         string // Directory to save the SBOM files
+	TempDir     string // Directory to use for temporary clones
+	Concurrency int    // Maximum number of concurrent downloads
+	Force       bool   // Regenerate SBOMs even if they are up to date
+	Manifest    string // Path of the run manifest, defaults to manifest-<run id>.json in Dir
+
+	Generator        sbom.Generator // Tool used to generate the SBOMs
+	GeneratorVersion string         // Version of the generator tool
+	Formats          []sbom.Format  // Formats to write, one file per format
+	LegacyNames      bool           // Name SBOMs in the default format <name>.sbom.json, as when no format is selected
+	Timeouts         sbom.TimeoutPolicy
+	Retry            retry.Policy // Retries of clone and scan failures classified as transient
+
+	Progress         progress.Mode // How progress is reported
+	ProgressInterval time.Duration // Interval between progress log lines
+	Metrics          *metrics.Metrics
+
+	MaxRepoSize  int64            // Repositories larger than this many bytes are skipped (0 means no limit)
+	MinFreeSpace int64            // Workers pause while the temporary or output directory has less free space
+	Credentials  *csv.Credentials // Credentials for cloning and GitHub API requests, may be nil
+
+	Ref    string         // Ref to scan: default, latest-tag, latest-semver, a branch, tag or commit
+	Config *config.Config // Per-repository ref overrides, may be nil
+
+	History historyOptions // Release tags to generate SBOMs for instead of a single ref
+
+	Checkout checkoutMode // Files checked out for scanning, all of them unless set to sparse
+	Cache    *csv.Cache   // Mirrors to fetch repositories into instead of cloning them, may be nil
+
+	Fetch            fetchStrategy      // How repositories are downloaded, cloned unless set to archive
+	ArchiveTemplates map[string]string  // Archive URL templates by host for the archive strategy
+	Layout           *layout.Layout     // Paths of the SBOM files, the flat layout if nil
+	Compress         compress.Algorithm // Compression of the SBOM files, none if empty
+
+	space  *spaceGuard
+	sizes  *sizeLookup
+	claims *outputClaims
+}
+
+// sbomTask is a repository to process together with its job record
+type sbomTask struct {
+	Repo csv.RepoData
+	Job  jobs.Job
+	Dir  string // Local checkout scanned in place instead of cloning the repository
+}
+
+// newSBOMTasks records a new run of the command with a pending job for every repository
+func newSBOMTasks(db *sql.DB, command string, repos []csv.RepoData) ([]sbomTask, error) {
+	if err := jobs.CreateTable(db); err != nil {
+		return nil, err
+	}
+
+	repoURLs := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		repoURLs = append(repoURLs, repo.RepoURL)
+	}
+
+	runJobs, err := jobs.Enqueue(db, jobs.NewRunID(), command, repoURLs)
+	if err != nil {
+		return nil, err
+	}
+
+	tasks := make([]sbomTask, 0, len(repos))
+	for i, repo := range repos {
+		tasks = append(tasks, sbomTask{Repo: repo, Job: runJobs[i]})
+	}
+	return tasks, nil
+}
+
+// resumeSBOMTasks returns the pending and failed jobs of the most recent download-sbom run
+func resumeSBOMTasks(db *sql.DB) ([]sbomTask, error) {
+	if err := jobs.CreateTable(db); err != nil {
+		return nil, err
+	}
+
+	runID, err := jobs.LatestRunID(db, jobs.CommandDownloadSBOM)
+	if err != nil {
+		return nil, err
+	}
+
+	runJobs, err := jobs.Resumable(db, runID)
+	if err != nil {
+		return nil, err
+	}
+
+	repoURLs := make([]string, 0, len(runJobs))
+	for _, job := range runJobs {
+		repoURLs = append(repoURLs, job.RepoURL)
+	}
+	repos, err := csv.GetReposByURL(db, repoURLs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load repositories of run %s: %w", runID, err)
+	}
+
+	tasks := make([]sbomTask, 0, len(runJobs))
+	for i, job := range runJobs {
+		tasks = append(tasks, sbomTask{Repo: repos[i], Job: job})
+	}
+	return tasks, nil
+}
+
+// generateSBOMs clones every repository and generates its SBOM using a pool of workers,
+// recording the outcome of each task in the sbom_jobs table and writing a manifest of the run.
+// When ctx is cancelled no further tasks are started, in-flight tasks are aborted and
+// recorded as pending so the run can be resumed.
+func generateSBOMs(ctx context.Context, db *sql.DB, sbomTasks []sbomTask, options sbomOptions) error {
+	startedAt := time.Now()
+	if options.Metrics == nil {
+		options.Metrics = metrics.New()
+	}
+
+	// Ensure the directory exists
+	if err := os.MkdirAll(options.Dir, os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	guarded := []string{options.TempDir, options.Dir}
+	if options.Cache != nil {
+		guarded = append(guarded, options.Cache.Dir())
+	}
+	options.space = newSpaceGuard(options.MinFreeSpace, guarded...)
+	options.claims = newOutputClaims()
+	options.sizes = &sizeLookup{}
+
+	tracker := progress.New("SBOMs", "repos", len(sbomTasks), console, options.Progress, options.ProgressInterval)
+	tracker.Start()
+
+	// Create a channel to send download tasks to workers
+	tasks := make(chan *sbomTask, len(sbomTasks))
+	var wg sync.WaitGroup
+
+	// Start worker goroutines
+	for i := 0; i < options.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range tasks {
+				tracker.Begin()
+				tracker.Finish(processSBOMTask(ctx, db, task, options))
+			}
+		}()
+	}
+
+	// Send download tasks to the workers, stopping when the run is interrupted
+	for i := 0; i < len(sbomTasks) && ctx.Err() == nil; i++ {
+		tasks <- &sbomTasks[i]
+	}
+	close(tasks) // Close the channel to signal workers that no more tasks are coming
+
+	wg.Wait() // Wait for all workers to complete
+	tracker.Stop()
+
+	if options.Cache != nil {
+		if err := options.Cache.Evict(); err != nil {
+			slog.Warn("failed to evict mirrors from the cache", "error", err)
+		}
+	}
+
+	if len(sbomTasks) == 0 {
+		return nil
+	}
+	runID := sbomTasks[0].Job.RunID
+	if err := writeManifest(db, runID, startedAt, options); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("run %s was interrupted, continue it with --resume", runID)
+	}
+	return nil
+}
+
+// processSBOMTask generates the SBOMs of a single repository, retrying transient failures,
+// and records the outcome in the sbom_jobs table
+func processSBOMTask(ctx context.Context, db *sql.DB, task *sbomTask, options sbomOptions) progress.Outcome {
+	// Tasks queued before the run was interrupted are left pending
+	if err := options.space.wait(ctx); err != nil || ctx.Err() != nil {
+		return progress.Interrupted
+	}
+
+	options.Metrics.ActiveWorkers.Inc()
+	defer options.Metrics.ActiveWorkers.Dec()
+
+	if err := jobs.Start(db, task.Job.ID); err != nil {
+		slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+	}
+
+	if task.Dir != "" {
+		return processLocalTask(ctx, db, task, options)
+	}
+	if !options.Force && task.Job.Ref == "" {
+		failed, err := jobs.PermanentFailure(db, task.Repo.RepoURL, task.Job.RunID)
+		if err != nil {
+			slog.Error("failed to look up earlier failures", "repo", task.Repo.RepoURL, "error", err)
+		}
+		if failed != nil {
+			reason := fmt.Sprintf("failed in run %s with a %s error, use --force to retry: %s", failed.RunID, failed.ErrorClass, failed.Error)
+			return skipSBOMTask(db, task, options, csv.ResolvedRef{}, nil, reason)
+		}
+	}
+	if options.History.enabled() && task.Job.Ref == "" {
+		return processHistoryTask(ctx, db, task, options)
+	}
+
+	spec, release := options.Config.Ref(task.Repo.RepoURL, options.Ref), task.Job.Ref != ""
+	if release {
+		// A release of an interrupted or failed history run, scanned from a clone of its own
+		spec = tagRefPrefix + task.Job.Ref
+	}
+	var ref csv.ResolvedRef
+	start := time.Now()
+	err := options.Retry.Do(ctx, func(int) error {
+		var err error
+		ref, err = csv.ResolveRef(ctx, task.Repo.RepoURL, spec, options.Credentials)
+		return err
+	})
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, fmt.Errorf("failed to resolve ref %s: %w", spec, err))
+	}
+
+	version := outputRef(spec, ref)
+	var outputs []sbom.Output
+	if release {
+		outputs, err = historyOutputs(&task.Repo, version, options)
+	} else {
+		outputs, err = sbomOutputs(&task.Repo, ref.Name, version == "", options)
+	}
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+	if err := claimOutputs(db, task.Repo.RepoURL, outputs, options); err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+
+	if !options.Force {
+		if outputFiles, upToDate := sbomUpToDate(db, &task.Repo, ref, outputs, options); upToDate {
+			return skipSBOMTask(db, task, options, ref, outputFiles, "up to date")
+		}
+	}
+
+	if reason := oversizedReason(ctx, &task.Repo, options); reason != "" {
+		return skipSBOMTask(db, task, options, ref, nil, reason)
+	}
+
+	var result jobs.Result
+	err = options.Retry.Do(ctx, func(attempt int) error {
+		if attempt > 1 {
+			if err := jobs.Start(db, task.Job.ID); err != nil {
+				slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+			}
+			start = time.Now()
+		}
+		var err error
+		result, err = generateSBOM(ctx, &task.Repo, ref, version, outputs, options)
+		recordAttempt(ctx, &task.Repo, options, attempt, err)
+		return err
+	})
+	if err != nil {
+		return failSBOMTask(ctx, db, task, options, ref, start, err)
+	}
+	result.Duration = time.Since(start)
+	return succeedSBOMTask(db, task, options, result)
+}
+
+// recordAttempt counts a failed attempt of a task and logs it if it is retried
+func recordAttempt(ctx context.Context, repo *csv.RepoData, options sbomOptions, attempt int, err error) {
+	if err == nil {
+		return
+	}
+	if ctx.Err() == nil && !errors.Is(err, csv.ErrTooLarge) {
+		options.Metrics.GeneratorErrors.WithLabelValues(string(retry.ClassOf(err))).Inc()
+	}
+	if retry.ClassOf(err).Retryable() && attempt < options.Retry.MaxAttempts {
+		slog.Warn("attempt failed, retrying", "repo", repo.RepoURL, "attempt", attempt, "class", retry.ClassOf(err), "error", err)
+	}
+}
+
+// succeedSBOMTask records a task whose SBOMs were generated
+func succeedSBOMTask(db *sql.DB, task *sbomTask, options sbomOptions, result jobs.Result) progress.Outcome {
+	slog.Info("SBOM generated", "repo", task.Repo.RepoURL, "generator", result.Generator, "ref", result.Ref, "commit", result.CommitSHA)
+	if err := jobs.Succeed(db, task.Job.ID, result); err != nil {
+		slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+	}
+	options.Metrics.Jobs.WithLabelValues(string(jobs.StatusSucceeded)).Inc()
+	return progress.Succeeded
+}
+
+// failSBOMTask records a task whose ref resolution or SBOM generation failed.
+// Interrupted tasks are left pending and repositories found to be too large are skipped.
+func failSBOMTask(ctx context.Context, db *sql.DB, task *sbomTask, options sbomOptions, ref csv.ResolvedRef, start time.Time, err error) progress.Outcome {
+	if ctx.Err() != nil {
+		slog.Warn("SBOM generation interrupted", "repo", task.Repo.RepoURL)
+		if err := jobs.Interrupt(db, task.Job.ID); err != nil {
+			slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+		}
+		return progress.Interrupted
+	}
+	if errors.Is(err, csv.ErrTooLarge) {
+		return skipSBOMTask(db, task, options, ref, nil, err.Error())
+	}
+
+	slog.Error("failed to generate SBOM", "repo", task.Repo.RepoURL, "class", retry.ClassOf(err), "error", err)
+	record, status := jobs.Fail, jobs.StatusFailed
+	if errors.Is(err, sbom.ErrTimeout) {
+		record, status = jobs.TimeOut, jobs.StatusTimedOut
+	}
+	options.Metrics.Jobs.WithLabelValues(string(status)).Inc()
+	if err := record(db, task.Job.ID, time.Since(start), err); err != nil {
+		slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+	}
+	return progress.Failed
+}
+
+// skipSBOMTask records a repository that is not processed together with the reason
+func skipSBOMTask(db *sql.DB, task *sbomTask, options sbomOptions, ref csv.ResolvedRef, outputFiles []string, reason string) progress.Outcome {
+	slog.Info("skipping repository", "repo", task.Repo.RepoURL, "reason", reason)
+	if err := jobs.Skip(db, task.Job.ID, ref.CommitSHA, ref.Name, outputFiles, reason); err != nil {
+		slog.Error("failed to record job", "repo", task.Repo.RepoURL, "error", err)
+	}
+	options.Metrics.Jobs.WithLabelValues(string(jobs.StatusSkipped)).Inc()
+	return progress.Skipped
+}
+
+// writeManifest writes the manifest of a run and prints its totals to stdout as the result of the command
+func writeManifest(db *sql.DB, runID string, startedAt time.Time, options sbomOptions) error {
+	runJobs, err := jobs.ForRun(db, runID)
+	if err != nil {
+		return err
+	}
+	runManifest := manifest.Build(runID, runJobs, startedAt, time.Now())
+
+	path := options.Manifest
+	if path == "" {
+		path = filepath.Join(options.Dir, manifest.FileName(runID))
+	}
+	if err := runManifest.Write(path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Run %s finished in %s, %s\n", runID, time.Duration(runManifest.DurationMS)*time.Millisecond, runManifest.Totals.Summary())
+	slog.Info("manifest written", "path", path)
+	return nil
+}
+
+// generateSBOM clones a repository at the resolved ref into a temporary directory and generates its SBOM.
+// version is recorded as the source version of the SBOMs if it is not empty.
+func generateSBOM(ctx context.Context, repo *csv.RepoData, ref csv.ResolvedRef, version string, outputs []sbom.Output, options sbomOptions) (jobs.Result, error) {
+	result := jobs.Result{
+		Ref:              ref.Name,
+		Generator:        options.Generator.Name(),
+		GeneratorVersion: options.GeneratorVersion,
+	}
+
+	// Create a temporary directory for cloning
+	tempDir, err := os.MkdirTemp(options.TempDir, "repo-clone-")
+	if err != nil {
+		return result, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	var sparsePatterns []string
+	if options.Checkout == checkoutSparse {
+		sparsePatterns = options.manifestPatterns()
+	}
+
+	// Clone the repository
+	cloneStart := time.Now()
+	result.CommitSHA, err = cloneRepo(ctx, repo.RepoURL, tempDir, options, csv.CloneOptions{
+		MaxSize:     options.MaxRepoSize,
+		Credentials: options.Credentials,
+		Ref:         ref,
+		Sparse:      sparsePatterns,
+	})
+	options.Metrics.CloneDuration.Observe(time.Since(cloneStart).Seconds())
+	if err != nil {
+		return result, err
+	}
+
+	size, err := csv.DirSize(tempDir)
+	if err != nil {
+		return result, fmt.Errorf("failed to measure cloned repository: %w", err)
+	}
+	options.Metrics.BytesCloned.Add(float64(size))
+
+	scanStart := time.Now()
+	if err := scanSBOM(ctx, repo, tempDir, size, version, outputs, options); err != nil {
+		return result, err
+	}
+	if full, ok := comparedOutput(outputs); ok && options.Checkout == checkoutCompare {
+		err := compareSparse(ctx, repo, tempDir, size, result.CommitSHA, version, full, time.Since(scanStart), options)
+		if err != nil {
+			slog.Warn("cannot compare sparse checkout", "repo", repo.RepoURL, "error", err)
+		}
+	}
+	for _, output := range outputs {
+		result.OutputPaths = append(result.OutputPaths, output.File)
+	}
+	return result, nil
+}
+
+// cloneRepo clones a repository into dir, fetching it into its mirror first if a cache is used,
+// or downloads and extracts an archive of the ref with the archive strategy
+func cloneRepo(ctx context.Context, repoURL, dir string, options sbomOptions, cloneOptions csv.CloneOptions) (string, error) {
+	if options.Fetch == fetchArchive {
+		return csv.FetchArchive(ctx, repoURL, dir, options.ArchiveTemplates, cloneOptions)
+	}
+	if options.Cache != nil {
+		return options.Cache.Clone(ctx, repoURL, dir, cloneOptions)
+	}
+	return csv.CloneRepo(ctx, repoURL, dir, cloneOptions)
+}
+
+// scanSBOM generates the SBOMs of a checked out repository of the given size, recording version as
+// the source version if it is not empty. The SBOMs are written to partial files that replace the
+// outputs only once generation succeeded, so a failed or interrupted generation never leaves
+// truncated SBOMs behind.
+func scanSBOM(ctx context.Context, repo *csv.RepoData, dir string, size int64, version string, outputs []sbom.Output, options sbomOptions) error {
+	// Remove the scheme (http:// or https://) from the RepoURL
+	repoURLWithoutScheme := strings.TrimPrefix(repo.RepoURL, "http://")
+	repoURLWithoutScheme = strings.TrimPrefix(repoURLWithoutScheme, "https://")
+
+	timeout := options.Timeouts.Timeout(repo.RepoLanguage, size)
+	scanCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	partials := make([]sbom.Output, 0, len(outputs))
+	for _, output := range outputs {
+		if err := os.MkdirAll(filepath.Dir(output.File), 0o755); err != nil {
+			return fmt.Errorf("failed to create output directory: %w", err)
+		}
+		partials = append(partials, sbom.Output{Format: output.Format, File: output.File + partialSuffix})
+	}
+	defer removePartials(partials)
+
+	scanStart := time.Now()
+	err := options.Generator.Generate(scanCtx, sbom.Request{
+		Directory:     dir,
+		SourceName:    repoURLWithoutScheme,
+		SourceVersion: version,
+		Outputs:       partials,
+		OnWarning: func(warning sbom.Warning) {
+			slog.Warn("problem while scanning", "repo", repo.RepoURL, "location", warning.Location, "message", warning.Message)
+		},
+	})
+	options.Metrics.ScanDuration.WithLabelValues(options.Generator.Name()).Observe(time.Since(scanStart).Seconds())
+	if errors.Is(err, sbom.ErrTimeout) {
+		return fmt.Errorf("%w (budget %s for %.1f MB)", err, timeout, float64(size)/(1<<20))
+	}
+	if err != nil {
+		return err
+	}
+
+	for i, output := range outputs {
+		if options.Compress != compress.None {
+			if err := compress.CompressFile(partials[i].File, output.File, options.Compress); err != nil {
+				return fmt.Errorf("failed to save SBOM: %w", err)
+			}
+			continue
+		}
+		if err := os.Rename(partials[i].File, output.File); err != nil {
+			return fmt.Errorf("failed to save SBOM: %w", err)
+		}
+	}
+	return nil
+}
+
+// partialSuffix is appended to SBOM files while they are being written
+const partialSuffix = ".partial"
+
+// removePartials removes partial SBOM files left by a failed or interrupted generation
+func removePartials(partials []sbom.Output) {
+	for _, partial := range partials {
+		if err := os.Remove(partial.File); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			slog.Warn("failed to remove partial SBOM", "file", partial.File, "error", err)
+		}
+	}
+}
+
+// outputRef returns the ref name recorded in SBOM file names and metadata,
+// empty when the default branch is scanned so its file names stay unchanged
+func outputRef(spec string, ref csv.ResolvedRef) string {
+	if spec == "" || spec == csv.RefDefault {
+		return ""
+	}
+	return ref.Name
+}
+
+// sbomOutputs returns the SBOM files to write for a repository, one per format, named by the layout.
+// The flat layout appends a ref other than the default branch to the file name, e.g. org_repo@v1.2.3.cdx.json.
+func sbomOutputs(repo *csv.RepoData, ref string, defaultRef bool, options sbomOptions) ([]sbom.Output, error) {
+	outputs := make([]sbom.Output, 0, len(options.Formats))
+	for _, format := range options.Formats {
+		fields := layout.Fields{RepoURL: repo.RepoURL, Ref: ref, DefaultRef: defaultRef, Format: format, Extension: options.extension(format)}
+		file, err := options.layout().Path(fields)
+		if err != nil {
+			return nil, err
+		}
+		outputs = append(outputs, options.output(format, file))
+	}
+	return outputs, nil
+}
+
+// output returns the SBOM file at the slash-separated path in the SBOM directory, with the
+// extension of the compression if any
+func (o sbomOptions) output(format sbom.Format, file string) sbom.Output {
+	return sbom.Output{Format: format, File: filepath.Join(o.Dir, filepath.FromSlash(file)) + o.Compress.Extension()}
+}
+
+// extension returns the file extension of SBOMs in the format
+func (o sbomOptions) extension(format sbom.Format) string {
+	if o.LegacyNames && format == sbom.DefaultFormat {
+		return sbom.LegacyExtension
+	}
+	return format.Extension()
+}
+
+// layout returns the layout of the SBOM files
+func (o sbomOptions) layout() *layout.Layout {
+	if o.Layout == nil {
+		return layout.Default
+	}
+	return o.Layout
+}
+
+// sbomUpToDate reports whether the SBOMs of a repository were already generated for the commit
+// the resolved ref currently points to, returning the existing SBOM files
+func sbomUpToDate(db *sql.DB, repo *csv.RepoData, ref csv.ResolvedRef, outputs []sbom.Output, options sbomOptions) ([]string, bool) {
+	previous, err := jobs.LatestSucceeded(db, repo.RepoURL, ref.Name)
+	if err != nil || previous == nil || previous.CommitSHA == "" || previous.Generator != options.Generator.Name() {
+		return nil, false
+	}
+	if previous.CommitSHA != ref.CommitSHA {
+		return nil, false
+	}
+
+	// Every requested file must have been produced by the previous job and still exist
+	produced := make(map[string]bool, len(previous.OutputPaths))
+	for _, path := range previous.OutputPaths {
+		produced[path] = true
+	}
+	outputFiles := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		if !produced[output.File] {
+			return nil, false
+		}
+		if _, err := os.Stat(output.File); err != nil {
+			return nil, false
+		}
+		outputFiles = append(outputFiles, output.File)
+	}
+	return outputFiles, true
+}
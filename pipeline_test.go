@@ -0,0 +1,83 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+func TestSBOMOutputs(t *testing.T) {
+	repo := &csv.RepoData{RepoURL: "https://github.com/org/repo"}
+	tests := []struct {
+		name    string
+		options sbomOptions
+		ref     string
+		want    []string
+		history []string
+	}{
+		{
+			name:    "no format selected",
+			options: sbomOptions{Formats: []sbom.Format{sbom.DefaultFormat}, LegacyNames: true},
+			want:    []string{"org_repo.sbom.json"},
+			history: []string{"org_repo/v1.sbom.json"},
+		},
+		{
+			name:    "no format selected with a ref",
+			options: sbomOptions{Formats: []sbom.Format{sbom.DefaultFormat}, LegacyNames: true},
+			ref:     "v1",
+			want:    []string{"org_repo@v1.sbom.json"},
+		},
+		{
+			name:    "default format selected",
+			options: sbomOptions{Formats: []sbom.Format{sbom.DefaultFormat}},
+			want:    []string{"org_repo.cdx.json"},
+			history: []string{"org_repo/v1.cdx.json"},
+		},
+		{
+			name:    "formats selected",
+			options: sbomOptions{Formats: []sbom.Format{sbom.FormatSPDXJSON, sbom.FormatCycloneDXXML}},
+			want:    []string{"org_repo.spdx.json", "org_repo.cdx.xml"},
+		},
+		{
+			name:    "compressed",
+			options: sbomOptions{Formats: []sbom.Format{sbom.DefaultFormat}, LegacyNames: true, Compress: compress.Zstd},
+			want:    []string{"org_repo.sbom.json.zst"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.options.Dir = "sbom"
+			outputs, err := sbomOutputs(repo, test.ref, test.ref == "", test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := outputFiles(outputs); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("sbomOutputs = %v, want %v", got, test.want)
+			}
+			if test.history == nil {
+				return
+			}
+			outputs, err = historyOutputs(repo, "v1", test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := outputFiles(outputs); !reflect.DeepEqual(got, test.history) {
+				t.Errorf("historyOutputs = %v, want %v", got, test.history)
+			}
+		})
+	}
+}
+
+// outputFiles returns the slash-separated paths of the outputs relative to the SBOM directory
+func outputFiles(outputs []sbom.Output) []string {
+	files := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		rel, _ := filepath.Rel("sbom", output.File)
+		files = append(files, filepath.ToSlash(rel))
+	}
+	return files
+}
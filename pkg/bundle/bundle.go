@@ -0,0 +1,264 @@
+// Package bundle packs SBOM corpora into zstd compressed tar archives that start with an index of their files.
+package bundle
+
+import (
+	"archive/tar"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
+)
+
+// Extension is the file extension of bundles.
+const Extension = ".tar.zst"
+
+// IndexName is the name of the index, the first file of every bundle.
+const IndexName = "index.json"
+
+// Index lists the files of a bundle in the order they are stored.
+type Index struct {
+	Created time.Time `json:"created"`
+	Files   []File    `json:"files"`
+}
+
+// File is a file stored in a bundle.
+type File struct {
+	Path   string `json:"path"`   // Slash-separated path relative to the bundled directory
+	Size   int64  `json:"size"`   // Size of the uncompressed contents
+	SHA256 string `json:"sha256"` // Checksum of the uncompressed contents
+}
+
+// IsBundle reports whether path names a bundle.
+func IsBundle(path string) bool {
+	return strings.HasSuffix(path, Extension)
+}
+
+// Create packs every regular file below dir into a bundle written to path, except for partial SBOMs
+// and bundles, including the one being written, so bundling a directory again does not nest the
+// previous bundle in the new one. Compressed files are stored decompressed, without their compression extension,
+// since the bundle compresses them better as a whole.
+func Create(path, dir string) (*Index, error) {
+	out, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newSpool(filepath.Dir(out))
+	if err != nil {
+		return nil, err
+	}
+	defer s.remove()
+
+	err = filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || strings.HasSuffix(file, ".partial") || IsBundle(file) {
+			return nil
+		}
+		if abs, err := filepath.Abs(file); err != nil || abs == out || abs == s.file.Name() {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		data, _, err := compress.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return s.add(compress.TrimExtension(filepath.ToSlash(rel)), info.ModTime(), data)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to bundle %s: %w", dir, err)
+	}
+	return s.finish(path)
+}
+
+// Walk calls fn with every file of the bundle at path in order, after checking it against the index.
+func Walk(path string, fn func(file File, data []byte) error) (*Index, error) {
+	reader, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	decompressed, _, err := compress.NewReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read bundle %s: %w", path, err)
+	}
+	defer decompressed.Close()
+	archive := tar.NewReader(decompressed)
+
+	header, err := archive.Next()
+	if err != nil || header.Name != IndexName {
+		return nil, fmt.Errorf("%s is not a bundle: it does not start with %s", path, IndexName)
+	}
+	var index Index
+	if err := json.NewDecoder(archive).Decode(&index); err != nil {
+		return nil, fmt.Errorf("failed to read index of bundle %s: %w", path, err)
+	}
+
+	for i := 0; ; i++ {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			if i != len(index.Files) {
+				return nil, fmt.Errorf("bundle %s is truncated: %d of %d files", path, i, len(index.Files))
+			}
+			return &index, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read bundle %s: %w", path, err)
+		}
+		if i >= len(index.Files) || header.Name != index.Files[i].Path {
+			return nil, fmt.Errorf("bundle %s does not match its index at %s", path, header.Name)
+		}
+		data, err := io.ReadAll(archive)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from bundle %s: %w", header.Name, path, err)
+		}
+		if checksum(data) != index.Files[i].SHA256 {
+			return nil, fmt.Errorf("checksum mismatch for %s in bundle %s", header.Name, path)
+		}
+		if err := fn(index.Files[i], data); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Rewrite replaces the bundle at path with one whose files are replaced by what fn returns for them.
+func Rewrite(path string, fn func(file File, data []byte) ([]byte, error)) error {
+	s, err := newSpool(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	defer s.remove()
+
+	_, err = Walk(path, func(file File, data []byte) error {
+		data, err := fn(file, data)
+		if err != nil {
+			return err
+		}
+		return s.add(file.Path, time.Now(), data)
+	})
+	if err != nil {
+		return err
+	}
+	_, err = s.finish(path)
+	return err
+}
+
+// spool collects the files of a bundle in an uncompressed tar file, since the index written before
+// them is only known once every file was read
+type spool struct {
+	file    *os.File
+	archive *tar.Writer
+	index   Index
+	paths   map[string]bool
+}
+
+func newSpool(dir string) (*spool, error) {
+	file, err := os.CreateTemp(dir, ".bundle-*.tar")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	return &spool{file: file, archive: tar.NewWriter(file), paths: make(map[string]bool)}, nil
+}
+
+func (s *spool) add(path string, modTime time.Time, data []byte) error {
+	if path == IndexName || s.paths[path] {
+		return fmt.Errorf("%s would be stored twice in the bundle", path)
+	}
+	s.paths[path] = true
+
+	header := &tar.Header{Typeflag: tar.TypeReg, Name: path, Mode: 0o644, Size: int64(len(data)), ModTime: modTime}
+	if err := s.archive.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := s.archive.Write(data); err != nil {
+		return err
+	}
+	s.index.Files = append(s.index.Files, File{Path: path, Size: int64(len(data)), SHA256: checksum(data)})
+	return nil
+}
+
+// finish writes the bundle to path, the index followed by the spooled files
+func (s *spool) finish(path string) (*Index, error) {
+	if err := s.archive.Close(); err != nil {
+		return nil, err
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	s.index.Created = time.Now().UTC()
+	if s.index.Files == nil {
+		s.index.Files = []File{}
+	}
+	index, err := json.MarshalIndent(s.index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode index: %w", err)
+	}
+
+	err = compress.AtomicWrite(path, 0o644, func(w io.Writer) error {
+		compressed, err := compress.NewWriter(w, compress.Zstd)
+		if err != nil {
+			return err
+		}
+		archive := tar.NewWriter(compressed)
+		header := &tar.Header{Typeflag: tar.TypeReg, Name: IndexName, Mode: 0o644, Size: int64(len(index)), ModTime: s.index.Created}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(index); err != nil {
+			return err
+		}
+
+		spooled := tar.NewReader(s.file)
+		for {
+			header, err := spooled.Next()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if err := archive.WriteHeader(header); err != nil {
+				return err
+			}
+			if _, err := io.Copy(archive, spooled); err != nil {
+				return err
+			}
+		}
+		if err := archive.Close(); err != nil {
+			return err
+		}
+		return compressed.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &s.index, nil
+}
+
+func (s *spool) remove() {
+	_ = s.file.Close()
+	_ = os.Remove(s.file.Name())
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
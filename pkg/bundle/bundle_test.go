@@ -0,0 +1,139 @@
+package bundle
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string][]byte) {
+	t.Helper()
+	for name, data := range files {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func gzipped(t *testing.T, data string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write([]byte(data)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// contents returns the files of the bundle at path by their path in the bundle
+func contents(t *testing.T, path string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	index, err := Walk(path, func(file File, data []byte) error {
+		files[file.Path] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index.Files) != len(files) {
+		t.Errorf("index lists %d files, the bundle holds %d", len(index.Files), len(files))
+	}
+	return files
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"org_a.cdx.json":           []byte(`{"a":1}`),
+		"org_b.spdx.json.gz":       gzipped(t, `{"b":2}`),
+		"org_c/v1.0.0.cdx.json":    []byte(`{"c":3}`),
+		"org_d.cdx.json.partial":   []byte(`{"d"`),
+		"older/previous.tar.zst":   []byte("not read"),
+		"manifest-20240101Z.json":  []byte(`{}`),
+		"org_c/v2.0.0.cdx.json.gz": gzipped(t, `{"c":4}`),
+	})
+	want := map[string]string{
+		"org_a.cdx.json":          `{"a":1}`,
+		"org_b.spdx.json":         `{"b":2}`,
+		"org_c/v1.0.0.cdx.json":   `{"c":3}`,
+		"org_c/v2.0.0.cdx.json":   `{"c":4}`,
+		"manifest-20240101Z.json": `{}`,
+	}
+
+	// The bundle is written into the bundled directory, and bundling it again does not store the first bundle
+	output := filepath.Join(dir, "corpus"+Extension)
+	for i := 0; i < 2; i++ {
+		if _, err := Create(output, dir); err != nil {
+			t.Fatal(err)
+		}
+		if got := contents(t, output); !reflect.DeepEqual(got, want) {
+			t.Errorf("bundle %d holds %v, want %v", i+1, got, want)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".bundle-") {
+			t.Errorf("temporary file %s was left behind", entry.Name())
+		}
+	}
+}
+
+func TestCreateDuplicatePaths(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{
+		"org_a.cdx.json":    []byte(`{}`),
+		"org_a.cdx.json.gz": gzipped(t, `{}`),
+	})
+	_, err := Create(filepath.Join(t.TempDir(), "corpus"+Extension), dir)
+	if err == nil || !strings.Contains(err.Error(), "stored twice") {
+		t.Errorf("Create = %v, want an error for the file stored twice", err)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string][]byte{"a.json": []byte("a"), "b.json": []byte("b")})
+	output := filepath.Join(t.TempDir(), "corpus"+Extension)
+	if _, err := Create(output, dir); err != nil {
+		t.Fatal(err)
+	}
+	err := Rewrite(output, func(file File, data []byte) ([]byte, error) {
+		if file.Path == "a.json" {
+			return []byte("rewritten"), nil
+		}
+		return data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.json": "rewritten", "b.json": "b"}
+	if got := contents(t, output); !reflect.DeepEqual(got, want) {
+		t.Errorf("rewritten bundle holds %v, want %v", got, want)
+	}
+}
+
+func TestWalkNotABundle(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "corpus"+Extension)
+	if err := os.WriteFile(file, []byte("not a bundle"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Walk(file, func(File, []byte) error { return nil }); err == nil {
+		t.Error("Walk of a file that is not a bundle succeeded")
+	}
+}
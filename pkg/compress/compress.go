@@ -0,0 +1,208 @@
+// Package compress reads and writes gzip and zstd compressed files.
+package compress
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Algorithm is a compression algorithm.
+type Algorithm string
+
+const (
+	None Algorithm = ""     // No compression
+	Gzip Algorithm = "gzip" // gzip, readable by any tool
+	Zstd Algorithm = "zstd" // Zstandard, smaller and faster than gzip
+)
+
+// Algorithms lists the supported compression algorithms.
+var Algorithms = []Algorithm{Gzip, Zstd}
+
+// Parse parses the name of a compression algorithm. An empty name and "none" select no compression.
+func Parse(name string) (Algorithm, error) {
+	switch algorithm := Algorithm(strings.ToLower(name)); algorithm {
+	case None, "none":
+		return None, nil
+	case Gzip, Zstd:
+		return algorithm, nil
+	default:
+		return None, fmt.Errorf("unknown compression %q (available: none, gzip, zstd)", name)
+	}
+}
+
+// Extension returns the file extension of files compressed with the algorithm.
+func (a Algorithm) Extension() string {
+	switch a {
+	case Gzip:
+		return ".gz"
+	case Zstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+// TrimExtension removes the extension of a compressed file from name.
+func TrimExtension(name string) string {
+	for _, algorithm := range Algorithms {
+		if trimmed, ok := strings.CutSuffix(name, algorithm.Extension()); ok {
+			return trimmed
+		}
+	}
+	return name
+}
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Detect returns the algorithm data starting with the given bytes was compressed with, or None.
+func Detect(header []byte) Algorithm {
+	switch {
+	case bytes.HasPrefix(header, zstdMagic):
+		return Zstd
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	default:
+		return None
+	}
+}
+
+// NewReader returns a reader of the decompressed contents of r, detecting the compression
+// from the first bytes. Uncompressed data is returned as it is.
+func NewReader(r io.Reader) (io.ReadCloser, Algorithm, error) {
+	buffered := bufio.NewReader(r)
+	header, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, None, err
+	}
+
+	switch algorithm := Detect(header); algorithm {
+	case Gzip:
+		reader, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, None, fmt.Errorf("failed to read gzip data: %w", err)
+		}
+		return reader, algorithm, nil
+	case Zstd:
+		decoder, err := zstd.NewReader(buffered)
+		if err != nil {
+			return nil, None, fmt.Errorf("failed to read zstd data: %w", err)
+		}
+		return decoder.IOReadCloser(), algorithm, nil
+	default:
+		return io.NopCloser(buffered), None, nil
+	}
+}
+
+// NewWriter returns a writer compressing to w. Closing it flushes the compressed data but does not close w.
+func NewWriter(w io.Writer, algorithm Algorithm) (io.WriteCloser, error) {
+	switch algorithm {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// ReadFile returns the decompressed contents of a file together with the algorithm it was compressed with.
+func ReadFile(path string) ([]byte, Algorithm, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, None, err
+	}
+	defer file.Close()
+
+	reader, algorithm, err := NewReader(file)
+	if err != nil {
+		return nil, None, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, None, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return data, algorithm, nil
+}
+
+// WriteFile writes data compressed with the algorithm to path, replacing it atomically.
+func WriteFile(path string, data []byte, algorithm Algorithm, perm os.FileMode) error {
+	return AtomicWrite(path, perm, func(w io.Writer) error {
+		writer, err := NewWriter(w, algorithm)
+		if err != nil {
+			return err
+		}
+		if _, err := writer.Write(data); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+}
+
+// CompressFile writes the contents of src compressed with the algorithm to dst, replacing dst atomically.
+func CompressFile(src, dst string, algorithm Algorithm) error {
+	source, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+
+	return AtomicWrite(dst, info.Mode().Perm(), func(w io.Writer) error {
+		writer, err := NewWriter(w, algorithm)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(writer, source); err != nil {
+			return err
+		}
+		return writer.Close()
+	})
+}
+
+// AtomicWrite calls write with a temporary file next to path and renames it to path once write succeeded.
+func AtomicWrite(path string, perm os.FileMode, write func(io.Writer) error) error {
+	temp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	defer os.Remove(temp.Name())
+
+	if err := write(temp); err != nil {
+		_ = temp.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Chmod(temp.Name(), perm); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(temp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
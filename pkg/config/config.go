@@ -0,0 +1,114 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPath is the configuration file used when --config is not set
+const DefaultPath = "bomfactory.yaml"
+
+// Config represents the bomfactory configuration file
+type Config struct {
+	Presets  map[string]Preset `yaml:"presets"`
+	Timeouts Timeouts          `yaml:"timeouts"`
+	Refs     map[string]string `yaml:"refs"` // Git ref to scan by repository URL, overriding --ref
+
+	ManifestPatterns []string          `yaml:"manifest_patterns"` // Files checked out by sparse checkouts, replacing the defaults
+	Archives         map[string]string `yaml:"archives"`          // Archive URL templates by host for --fetch archive, "*" for any host
+}
+
+// Preset is a named combination of query options
+type Preset struct {
+	Filters    []string `yaml:"filters"`     // Filter criteria in the format 'field:operator:value'
+	OrderBy    string   `yaml:"order_by"`    // Ordering, e.g. "repo_star_count DESC"
+	MaxResults int      `yaml:"max_results"` // Maximum number of results (0 means use the flag value)
+	Skip       int      `yaml:"skip"`        // Number of records to skip
+}
+
+// Timeouts configures how long a single SBOM generation may take
+type Timeouts struct {
+	Default   time.Duration            `yaml:"default"`   // Timeout for repositories without a language specific timeout
+	PerMB     time.Duration            `yaml:"per_mb"`    // Additional time per MB of cloned repository
+	Languages map[string]time.Duration `yaml:"languages"` // Timeouts by repository language, e.g. Java: 10m, lower cased on load
+}
+
+// Load reads the configuration file at path.
+// A missing file yields an empty configuration unless required is true.
+func Load(path string, required bool) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	languages, err := lowerKeys(cfg.Timeouts.Languages)
+	if err != nil {
+		return nil, fmt.Errorf("invalid language timeouts in config file %s: %w", path, err)
+	}
+	cfg.Timeouts.Languages = languages
+
+	return &cfg, nil
+}
+
+// lowerKeys returns the timeouts with lower case language names, so languages are looked up
+// regardless of case. Names that differ only in case are rejected since either could win.
+func lowerKeys(timeouts map[string]time.Duration) (map[string]time.Duration, error) {
+	if timeouts == nil {
+		return nil, nil
+	}
+	lowered := make(map[string]time.Duration, len(timeouts))
+	for name, timeout := range timeouts {
+		key := strings.ToLower(name)
+		if _, ok := lowered[key]; ok {
+			return nil, fmt.Errorf("language %q is configured more than once with different case", name)
+		}
+		lowered[key] = timeout
+	}
+	return lowered, nil
+}
+
+// Ref returns the ref configured for a repository, or fallback if there is none.
+// URLs match regardless of case, a trailing slash or a .git suffix.
+func (c *Config) Ref(repoURL, fallback string) string {
+	if c == nil {
+		return fallback
+	}
+	key := normalizeRepoURL(repoURL)
+	for configured, ref := range c.Refs {
+		if normalizeRepoURL(configured) == key {
+			return ref
+		}
+	}
+	return fallback
+}
+
+func normalizeRepoURL(repoURL string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(strings.ToLower(repoURL), "/"), ".git")
+}
+
+// Preset returns the preset with the given name
+func (c *Config) Preset(name string) (Preset, error) {
+	preset, ok := c.Presets[name]
+	if !ok {
+		names := make([]string, 0, len(c.Presets))
+		for presetName := range c.Presets {
+			names = append(names, presetName)
+		}
+		sort.Strings(names)
+		return Preset{}, fmt.Errorf("unknown preset %q (available: %v)", name, names)
+	}
+	return preset, nil
+}
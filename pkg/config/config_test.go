@@ -0,0 +1,140 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig writes a configuration file and returns its path
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), DefaultPath)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadTimeouts(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Timeouts
+		wantErr string
+	}{
+		{
+			name: "durations",
+			content: `
+timeouts:
+  default: 5m
+  per_mb: 1.5s
+  languages:
+    Java: 10m
+    go: 90s
+`,
+			want: Timeouts{
+				Default:   5 * time.Minute,
+				PerMB:     1500 * time.Millisecond,
+				Languages: map[string]time.Duration{"java": 10 * time.Minute, "go": 90 * time.Second},
+			},
+		},
+		{name: "no timeouts", content: "presets: {}\n"},
+		{name: "invalid duration", content: "timeouts:\n  default: five minutes\n", wantErr: "failed to parse config file"},
+		{
+			name:    "languages differing in case",
+			content: "timeouts:\n  languages:\n    Java: 10m\n    JAVA: 20m\n",
+			wantErr: "configured more than once",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := Load(writeConfig(t, test.content), true)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("Load = %v, want an error containing %q", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(cfg.Timeouts, test.want) {
+				t.Errorf("Timeouts = %+v, want %+v", cfg.Timeouts, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultPath)
+	cfg, err := Load(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(cfg, &Config{}) {
+		t.Errorf("Load of a missing optional file = %+v, want an empty config", cfg)
+	}
+	if _, err := Load(path, true); err == nil {
+		t.Error("Load of a missing required file succeeded")
+	}
+}
+
+func TestPreset(t *testing.T) {
+	cfg, err := Load(writeConfig(t, `
+presets:
+  critical-go:
+    filters:
+      - repo_language:=:Go
+      - default_score:>:0.8
+    order_by: repo_star_count DESC
+    max_results: 50
+  popular:
+    filters: ["repo_star_count:>:1000"]
+    skip: 10
+`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		want    Preset
+		wantErr string
+	}{
+		{
+			name: "critical-go",
+			want: Preset{
+				Filters:    []string{"repo_language:=:Go", "default_score:>:0.8"},
+				OrderBy:    "repo_star_count DESC",
+				MaxResults: 50,
+			},
+		},
+		{name: "popular", want: Preset{Filters: []string{"repo_star_count:>:1000"}, Skip: 10}},
+		{name: "Popular", wantErr: `unknown preset "Popular" (available: [critical-go popular])`},
+		{name: "", wantErr: "unknown preset"},
+	}
+	for _, test := range tests {
+		got, err := cfg.Preset(test.name)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("Preset(%q) = %v, want an error containing %q", test.name, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Preset(%q) = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	// A configuration without presets names none as available
+	if _, err := (&Config{}).Preset("critical-go"); err == nil || !strings.Contains(err.Error(), "available: []") {
+		t.Errorf("Preset of an empty config = %v", err)
+	}
+}
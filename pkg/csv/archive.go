@@ -0,0 +1,242 @@
+package csv
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// DefaultArchiveTemplates are the archive URL templates of well known hosts, see ArchiveURL
+var DefaultArchiveTemplates = map[string]string{
+	"github.com":    "https://codeload.github.com/{owner}/{repo}/tar.gz/{sha}",
+	"gitlab.com":    "https://gitlab.com/{path}/-/archive/{sha}/{repo}-{sha}.tar.gz",
+	"bitbucket.org": "https://bitbucket.org/{path}/get/{sha}.tar.gz",
+	"codeberg.org":  "https://codeberg.org/{path}/archive/{sha}.tar.gz",
+}
+
+// AnyHost is the key of the archive URL template used for hosts without a template of their own
+const AnyHost = "*"
+
+// defaultMaxArchiveSize limits the extracted size of archives when no maximum repository size is set
+const defaultMaxArchiveSize = 20 << 30
+
+// maxArchiveEntries limits the number of entries extracted from an archive
+var maxArchiveEntries = 1_000_000
+
+// ArchiveURL fills in the archive URL template for the host of a repository.
+// Templates may refer to {host}, {path} (the repository path, e.g. group/subgroup/repo), {owner}
+// (the path segment before the repository name), {repo}, {ref} (the resolved ref name) and {sha}.
+func ArchiveURL(templates map[string]string, repoURL string, ref ResolvedRef) (string, error) {
+	parsedURL, err := url.Parse(repoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %s: %w", repoURL, err)
+	}
+	host := strings.ToLower(parsedURL.Hostname())
+	template, ok := templates[host]
+	if !ok {
+		if template, ok = templates[AnyHost]; !ok {
+			return "", retry.Classify(retry.ClassPermanent, fmt.Errorf("no archive URL template for host %q", host))
+		}
+	}
+
+	repoPath := strings.TrimSuffix(strings.Trim(parsedURL.Path, "/"), ".git")
+	segments := strings.Split(repoPath, "/")
+	owner := ""
+	if len(segments) > 1 {
+		owner = segments[len(segments)-2]
+	}
+	return strings.NewReplacer(
+		"{host}", host,
+		"{path}", repoPath,
+		"{owner}", url.PathEscape(owner),
+		"{repo}", url.PathEscape(segments[len(segments)-1]),
+		"{ref}", url.PathEscape(ref.Name),
+		"{sha}", ref.CommitSHA,
+	).Replace(template), nil
+}
+
+// FetchArchive downloads the .tar.gz archive of the resolved ref from the URL given by the host's template
+// and extracts it to dir, as an alternative to CloneRepo that transfers no history. The top-level
+// directory of the archive is stripped. With options.Sparse set only matching files are extracted.
+// The repository host's token is sent along if the archive is served by that host or one of its subdomains.
+func FetchArchive(ctx context.Context, repoURL, dir string, templates map[string]string, options CloneOptions) (string, error) {
+	if options.Ref.CommitSHA == "" {
+		return "", fmt.Errorf("archives can only be fetched for a resolved ref")
+	}
+	archiveURL, err := ArchiveURL(templates, repoURL, options.Ref)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, archiveURL, http.NoBody)
+	if err != nil {
+		return "", retry.Classify(retry.ClassPermanent, fmt.Errorf("invalid archive URL %s: %w", archiveURL, err))
+	}
+	if token := archiveToken(repoURL, req.URL, options.Credentials); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	slog.Debug("downloading archive", "url", archiveURL)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", retry.Classify(retry.ClassTransient, fmt.Errorf("failed to download archive: %w", err))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", retry.Classify(httpErrorClass(resp.StatusCode),
+			fmt.Errorf("failed to download archive %s: %s", archiveURL, resp.Status))
+	}
+
+	maxSize := options.MaxSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxArchiveSize
+	}
+	var match func(string) bool
+	if len(options.Sparse) > 0 {
+		match = func(name string) bool { return MatchManifest(options.Sparse, name) }
+	}
+	if err := ExtractArchive(resp.Body, dir, maxSize, match); err != nil {
+		if ctx.Err() != nil {
+			return "", ctx.Err()
+		}
+		return "", err
+	}
+	return options.Ref.CommitSHA, nil
+}
+
+// archiveToken returns the token of the repository host if the archive is served by it or one of its subdomains
+func archiveToken(repoURL string, archiveURL *url.URL, credentials *Credentials) string {
+	parsedURL, err := url.Parse(repoURL)
+	if err != nil || archiveURL.Scheme != "https" {
+		return ""
+	}
+	repoHost, archiveHost := strings.ToLower(parsedURL.Hostname()), strings.ToLower(archiveURL.Hostname())
+	if archiveHost != repoHost && !strings.HasSuffix(archiveHost, "."+repoHost) {
+		return ""
+	}
+	return credentials.TokenFor(repoHost)
+}
+
+// httpErrorClass classifies the status of a failed HTTP request
+func httpErrorClass(status int) retry.Class {
+	switch {
+	case status == http.StatusNotFound || status == http.StatusGone:
+		return retry.ClassNotFound
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return retry.ClassAuth
+	case status == http.StatusTooManyRequests || status == http.StatusRequestTimeout || status >= 500:
+		return retry.ClassTransient
+	default:
+		return retry.ClassPermanent
+	}
+}
+
+// ExtractArchive extracts a .tar.gz archive to dir, stripping its top-level directory. Only regular
+// files and directories are extracted, so links cannot point outside of dir, and entries whose path
+// would leave dir fail the extraction. Extraction stops with ErrTooLarge once more than maxSize bytes
+// were written. If match is not nil only the files it matches are extracted.
+func ExtractArchive(r io.Reader, dir string, maxSize int64, match func(string) bool) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return retry.Classify(retry.ClassPermanent, fmt.Errorf("failed to read archive: %w", err))
+	}
+	defer gz.Close()
+
+	budget := &budgetReader{remaining: maxSize}
+	archive := tar.NewReader(gz)
+	for entries := 0; ; entries++ {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return retry.Classify(retry.ClassTransient, fmt.Errorf("failed to read archive: %w", err))
+		}
+		if entries >= maxArchiveEntries {
+			return retry.Classify(retry.ClassPermanent, fmt.Errorf("archive has more than %d entries", maxArchiveEntries))
+		}
+
+		if !filepath.IsLocal(filepath.FromSlash(header.Name)) {
+			return retry.Classify(retry.ClassPermanent, fmt.Errorf("archive entry %q leaves the extraction directory", header.Name))
+		}
+		name := stripTopLevel(header.Name)
+		if name == "" {
+			continue
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if match == nil {
+				if err := os.MkdirAll(filepath.Join(dir, filepath.FromSlash(name)), 0o755); err != nil {
+					return err
+				}
+			}
+		case tar.TypeReg:
+			if match != nil && !match(name) {
+				continue
+			}
+			mode := fs.FileMode(0o644)
+			if header.FileInfo().Mode()&0o111 != 0 {
+				mode = 0o755
+			}
+			budget.r = archive
+			if err := writeFile(dir, name, budget, mode); err != nil {
+				if errors.Is(err, errBudgetExceeded) {
+					return retry.Classify(retry.ClassPermanent,
+						fmt.Errorf("%w: the archive extracts to more than %d bytes", ErrTooLarge, maxSize))
+				}
+				return fmt.Errorf("failed to extract %s: %w", name, err)
+			}
+		default:
+			// Links, devices and other special files are not needed for scanning
+			slog.Debug("skipping archive entry", "name", header.Name, "type", string(header.Typeflag))
+		}
+	}
+}
+
+// stripTopLevel removes the top-level directory from a slash separated archive path
+func stripTopLevel(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	_, rest, found := strings.Cut(name, "/")
+	if !found {
+		return ""
+	}
+	return rest
+}
+
+var errBudgetExceeded = errors.New("size budget exceeded")
+
+// budgetReader reads from r until a budget shared by several reads is used up
+type budgetReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (b *budgetReader) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		// Only fail if there is more to read
+		var probe [1]byte
+		if n, _ := b.r.Read(probe[:]); n > 0 {
+			return 0, errBudgetExceeded
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+	n, err := b.r.Read(p)
+	b.remaining -= int64(n)
+	return n, err
+}
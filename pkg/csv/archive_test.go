@@ -0,0 +1,431 @@
+package csv
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// archiveEntry is an entry of a test archive
+type archiveEntry struct {
+	name     string
+	typeflag byte
+	body     string
+	linkname string
+	mode     int64
+}
+
+func file(name, body string) archiveEntry {
+	return archiveEntry{name: name, typeflag: tar.TypeReg, body: body}
+}
+
+// tarGz returns a .tar.gz archive of the entries
+func tarGz(t *testing.T, entries ...archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for _, entry := range entries {
+		mode := entry.mode
+		if mode == 0 {
+			mode = 0o644
+		}
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.linkname, Mode: mode, Size: int64(len(entry.body))}
+		if entry.typeflag != tar.TypeReg {
+			header.Size = 0
+		}
+		if err := archive.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Size > 0 {
+			if _, err := archive.Write([]byte(entry.body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// extracted returns the contents of the files below dir by slash-separated path
+func extracted(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			t.Errorf("extracted %s of type %s", path, entry.Type())
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestExtractArchive(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		maxSize int64
+		match   func(string) bool
+		want    map[string]string
+		wantErr string
+		tooBig  bool
+	}{
+		{
+			name: "strips the top-level directory",
+			entries: []archiveEntry{
+				{name: "repo-abc/", typeflag: tar.TypeDir},
+				file("repo-abc/go.mod", "module example"),
+				{name: "repo-abc/cmd/", typeflag: tar.TypeDir},
+				file("repo-abc/cmd/main.go", "package main"),
+				file("README", "outside the top-level directory"),
+			},
+			want: map[string]string{"go.mod": "module example", "cmd/main.go": "package main"},
+		},
+		{
+			name:    "parent directory",
+			entries: []archiveEntry{file("repo/../../etc/passwd", "root")},
+			wantErr: "leaves the extraction directory",
+		},
+		{
+			name:    "parent directory of a later entry",
+			entries: []archiveEntry{file("repo/go.mod", "module example"), file("../repo/go.sum", "")},
+			wantErr: "leaves the extraction directory",
+		},
+		{
+			name:    "absolute path",
+			entries: []archiveEntry{file("/etc/passwd", "root")},
+			wantErr: "leaves the extraction directory",
+		},
+		{
+			name:    "parent directory that stays inside",
+			entries: []archiveEntry{file("repo/sub/../go.mod", "module example")},
+			want:    map[string]string{"go.mod": "module example"},
+		},
+		{
+			name: "symbolic links are skipped",
+			entries: []archiveEntry{
+				{name: "repo/passwd", typeflag: tar.TypeSymlink, linkname: "/etc/passwd"},
+				{name: "repo/up", typeflag: tar.TypeSymlink, linkname: "../.."},
+				file("repo/go.mod", "module example"),
+			},
+			want: map[string]string{"go.mod": "module example"},
+		},
+		{
+			name: "hard links are skipped",
+			entries: []archiveEntry{
+				{name: "repo/passwd", typeflag: tar.TypeLink, linkname: "/etc/passwd"},
+				{name: "repo/copy", typeflag: tar.TypeLink, linkname: "repo/go.mod"},
+				file("repo/go.mod", "module example"),
+			},
+			want: map[string]string{"go.mod": "module example"},
+		},
+		{
+			name: "devices and fifos are skipped",
+			entries: []archiveEntry{
+				{name: "repo/null", typeflag: tar.TypeChar},
+				{name: "repo/fifo", typeflag: tar.TypeFifo},
+			},
+			want: map[string]string{},
+		},
+		{
+			name:    "files within the size budget",
+			entries: []archiveEntry{file("repo/a", "12345"), file("repo/b", "67890")},
+			maxSize: 10,
+			want:    map[string]string{"a": "12345", "b": "67890"},
+		},
+		{
+			name:    "files exceeding the size budget together",
+			entries: []archiveEntry{file("repo/a", "123456"), file("repo/b", "789012")},
+			maxSize: 10,
+			tooBig:  true,
+		},
+		{
+			name:    "file exceeding the size budget",
+			entries: []archiveEntry{file("repo/a", strings.Repeat("x", 11))},
+			maxSize: 10,
+			tooBig:  true,
+		},
+		{
+			name: "sparse",
+			entries: []archiveEntry{
+				{name: "repo/", typeflag: tar.TypeDir},
+				{name: "repo/docs/", typeflag: tar.TypeDir},
+				file("repo/docs/index.md", "docs"),
+				file("repo/web/package-lock.json", "{}"),
+				file("repo/go.mod", "module example"),
+			},
+			match: func(name string) bool { return MatchManifest(DefaultManifestPatterns, name) },
+			want:  map[string]string{"web/package-lock.json": "{}", "go.mod": "module example"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			maxSize := test.maxSize
+			if maxSize == 0 {
+				maxSize = defaultMaxArchiveSize
+			}
+			err := ExtractArchive(bytes.NewReader(tarGz(t, test.entries...)), dir, maxSize, test.match)
+			switch {
+			case test.tooBig:
+				if !errors.Is(err, ErrTooLarge) {
+					t.Fatalf("ExtractArchive = %v, want ErrTooLarge", err)
+				}
+			case test.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("ExtractArchive = %v, want an error containing %q", err, test.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			}
+			if err != nil {
+				if retry.ClassOf(err) != retry.ClassPermanent {
+					t.Errorf("ExtractArchive error is %s, want permanent", retry.ClassOf(err))
+				}
+				return
+			}
+			if got := extracted(t, dir); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("extracted %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractArchiveExecutable(t *testing.T) {
+	dir := t.TempDir()
+	archive := tarGz(t, archiveEntry{name: "repo/gradlew", typeflag: tar.TypeReg, body: "#!/bin/sh", mode: 0o775}, file("repo/go.mod", ""))
+	if err := ExtractArchive(bytes.NewReader(archive), dir, defaultMaxArchiveSize, nil); err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]fs.FileMode{"gradlew": 0o755, "go.mod": 0o644} {
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != want {
+			t.Errorf("%s has mode %s, want %s", name, info.Mode().Perm(), want)
+		}
+	}
+}
+
+func TestExtractArchiveEntryBudget(t *testing.T) {
+	defer func(limit int) { maxArchiveEntries = limit }(maxArchiveEntries)
+	maxArchiveEntries = 3
+
+	entries := []archiveEntry{file("repo/a", ""), file("repo/b", ""), file("repo/c", "")}
+	if err := ExtractArchive(bytes.NewReader(tarGz(t, entries...)), t.TempDir(), defaultMaxArchiveSize, nil); err != nil {
+		t.Fatalf("archive with %d entries: %v", len(entries), err)
+	}
+	entries = append(entries, archiveEntry{name: "repo/d/", typeflag: tar.TypeDir})
+	err := ExtractArchive(bytes.NewReader(tarGz(t, entries...)), t.TempDir(), defaultMaxArchiveSize, nil)
+	if err == nil || !strings.Contains(err.Error(), "more than 3 entries") {
+		t.Errorf("archive with %d entries: %v, want an error", len(entries), err)
+	}
+}
+
+func TestExtractArchiveNotGzip(t *testing.T) {
+	err := ExtractArchive(strings.NewReader("<html>not found</html>"), t.TempDir(), defaultMaxArchiveSize, nil)
+	if err == nil || retry.ClassOf(err) != retry.ClassPermanent {
+		t.Errorf("ExtractArchive = %v, want a permanent error", err)
+	}
+}
+
+const testCommit = "0123456789abcdef0123456789abcdef01234567"
+
+// archiveServer serves an archive of go.mod at /org/repo/<testCommit>.tar.gz and responds to
+// /org/<status>/ with that status, recording the Authorization header of every request
+func archiveServer(t *testing.T, newServer func(http.Handler) *httptest.Server) (*httptest.Server, *[]string) {
+	t.Helper()
+	var authorizations []string
+	archive := tarGz(t, file("repo-"+testCommit+"/go.mod", "module example"))
+	server := newServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorizations = append(authorizations, r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/org/repo/" + testCommit + ".tar.gz":
+			_, _ = w.Write(archive)
+		case "/org/unauthorized/" + testCommit + ".tar.gz":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "/org/unavailable/" + testCommit + ".tar.gz":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, &authorizations
+}
+
+func TestFetchArchive(t *testing.T) {
+	server, authorizations := archiveServer(t, httptest.NewServer)
+	templates := map[string]string{AnyHost: server.URL + "/{owner}/{repo}/{sha}.tar.gz"}
+	credentials := &Credentials{Token: "secret", TokenHost: "127.0.0.1"}
+
+	tests := []struct {
+		repo      string
+		wantClass retry.Class
+	}{
+		{repo: "repo"},
+		{repo: "missing", wantClass: retry.ClassNotFound},
+		{repo: "unauthorized", wantClass: retry.ClassAuth},
+		{repo: "unavailable", wantClass: retry.ClassTransient},
+	}
+	for _, test := range tests {
+		t.Run(test.repo, func(t *testing.T) {
+			dir := t.TempDir()
+			options := CloneOptions{Ref: ResolvedRef{Name: "main", CommitSHA: testCommit}, Credentials: credentials}
+			commitSHA, err := FetchArchive(context.Background(), "https://127.0.0.1/org/"+test.repo, dir, templates, options)
+			if test.wantClass != "" {
+				if err == nil || retry.ClassOf(err) != test.wantClass {
+					t.Fatalf("FetchArchive = %v, want a %s error", err, test.wantClass)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if commitSHA != testCommit {
+				t.Errorf("FetchArchive returned commit %s, want %s", commitSHA, testCommit)
+			}
+			if got := extracted(t, dir); !reflect.DeepEqual(got, map[string]string{"go.mod": "module example"}) {
+				t.Errorf("extracted %v", got)
+			}
+		})
+	}
+
+	// The token is never sent over plain HTTP
+	for _, authorization := range *authorizations {
+		if authorization != "" {
+			t.Errorf("archive requested over HTTP with Authorization %q", authorization)
+		}
+	}
+
+	if _, err := FetchArchive(context.Background(), "https://127.0.0.1/org/repo", t.TempDir(), templates, CloneOptions{}); err == nil {
+		t.Error("FetchArchive of an unresolved ref succeeded")
+	}
+}
+
+func TestFetchArchiveToken(t *testing.T) {
+	server, authorizations := archiveServer(t, httptest.NewTLSServer)
+	defer func(client *http.Client) { http.DefaultClient = client }(http.DefaultClient)
+	http.DefaultClient = server.Client()
+	templates := map[string]string{AnyHost: server.URL + "/{owner}/{repo}/{sha}.tar.gz"}
+	credentials := &Credentials{Token: "secret", TokenHost: "127.0.0.1"}
+	options := CloneOptions{Ref: ResolvedRef{Name: "main", CommitSHA: testCommit}, Credentials: credentials}
+
+	// The archive is served by the host of the repository, which gets its token
+	if _, err := FetchArchive(context.Background(), "https://127.0.0.1/org/repo", t.TempDir(), templates, options); err != nil {
+		t.Fatal(err)
+	}
+	// The archive of a repository on another host must not receive the token of that host
+	credentials.TokenHost = "github.com"
+	if _, err := FetchArchive(context.Background(), "https://github.com/org/repo", t.TempDir(), templates, options); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"Bearer secret", ""}
+	if !reflect.DeepEqual(*authorizations, want) {
+		t.Errorf("Authorization headers %q, want %q", *authorizations, want)
+	}
+}
+
+func TestArchiveToken(t *testing.T) {
+	credentials := &Credentials{
+		Token:     "github-token",
+		TokenHost: "github.com",
+		Netrc:     map[string]Login{"gitlab.example.com": {User: "ci", Password: "gitlab-password"}},
+	}
+	tests := []struct {
+		name       string
+		repoURL    string
+		archiveURL string
+		want       string
+	}{
+		{"same host", "https://github.com/org/repo", "https://github.com/org/repo/archive/x.tar.gz", "github-token"},
+		{"subdomain", "https://github.com/org/repo", "https://codeload.github.com/org/repo/tar.gz/x", "github-token"},
+		{"host case", "https://GitHub.com/org/repo", "https://CODELOAD.github.com/org/repo/tar.gz/x", "github-token"},
+		{"plain HTTP", "https://github.com/org/repo", "http://codeload.github.com/org/repo/tar.gz/x", ""},
+		{"other host", "https://github.com/org/repo", "https://archives.example.com/org/repo.tar.gz", ""},
+		{"suffix without a dot", "https://github.com/org/repo", "https://evilgithub.com/org/repo.tar.gz", ""},
+		{"host as a subdomain of another", "https://github.com/org/repo", "https://github.com.example.com/x.tar.gz", ""},
+		{"parent domain", "https://git.github.com/org/repo", "https://github.com/org/repo.tar.gz", ""},
+		{"netrc login", "https://gitlab.example.com/group/repo", "https://gitlab.example.com/group/repo/-/archive/x.tar.gz", "gitlab-password"},
+		{"host without a token", "https://codeberg.org/org/repo", "https://codeberg.org/org/repo/archive/x.tar.gz", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			archiveURL, err := url.Parse(test.archiveURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := archiveToken(test.repoURL, archiveURL, credentials); got != test.want {
+				t.Errorf("archiveToken = %q, want %q", got, test.want)
+			}
+		})
+	}
+	if got := archiveToken("https://github.com/org/repo", &url.URL{Scheme: "https", Host: "github.com"}, nil); got != "" {
+		t.Errorf("archiveToken without credentials = %q", got)
+	}
+}
+
+func TestArchiveURL(t *testing.T) {
+	ref := ResolvedRef{Name: "release/v1", CommitSHA: testCommit}
+	tests := []struct {
+		repoURL string
+		want    string
+	}{
+		{"https://github.com/org/repo", "https://codeload.github.com/org/repo/tar.gz/" + testCommit},
+		{"https://github.com/org/repo.git", "https://codeload.github.com/org/repo/tar.gz/" + testCommit},
+		{"https://gitlab.com/group/sub/repo", "https://gitlab.com/group/sub/repo/-/archive/" + testCommit + "/repo-" + testCommit + ".tar.gz"},
+		{"https://git.example.com/org/repo", "https://mirror.example.com/org/repo/release%2Fv1.tar.gz"},
+	}
+	templates := map[string]string{AnyHost: "https://mirror.example.com/{path}/{ref}.tar.gz"}
+	for host, template := range DefaultArchiveTemplates {
+		templates[host] = template
+	}
+	for _, test := range tests {
+		got, err := ArchiveURL(templates, test.repoURL, ref)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("ArchiveURL(%q) = %q, want %q", test.repoURL, got, test.want)
+		}
+	}
+	if _, err := ArchiveURL(DefaultArchiveTemplates, "https://git.example.com/org/repo", ref); retry.ClassOf(err) != retry.ClassPermanent {
+		t.Errorf("ArchiveURL without a template = %v, want a permanent error", err)
+	}
+}
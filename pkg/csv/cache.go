@@ -0,0 +1,373 @@
+package csv
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// mirrorRefSpecs are the references kept by the mirrors of a cache
+var mirrorRefSpecs = []config.RefSpec{
+	"+refs/heads/*:refs/heads/*",
+	"+refs/tags/*:refs/tags/*",
+}
+
+// mirrorHeadRef records in a mirror the commit the HEAD of the remote pointed to when it was last fetched
+const mirrorHeadRef plumbing.ReferenceName = "refs/remotes/origin/HEAD"
+
+var mirrorHeadRefSpec = config.RefSpec("+HEAD:" + mirrorHeadRef)
+
+// worktreesDir is the directory of a mirror holding the metadata of its worktrees
+const worktreesDir = "worktrees"
+
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// maxMirrorNameLength limits the readable part of mirror directory names
+const maxMirrorNameLength = 100
+
+// Cache keeps bare mirrors of repositories across runs so that refreshing a repository
+// only fetches the objects added since it was last cloned
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// NewCache returns a cache of mirrors in dir, creating it if needed. Evict removes the least
+// recently used mirrors once the cache grows beyond maxSize bytes (0 means no limit).
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve cache directory: %w", err)
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return &Cache{dir: dir, maxSize: maxSize, locks: make(map[string]*sync.Mutex)}, nil
+}
+
+// Dir returns the directory of the cache
+func (c *Cache) Dir() string {
+	return c.dir
+}
+
+// Clone brings the mirror of a repository up to date, creating it on first use, and checks out the
+// requested ref into dir like CloneRepo. The checkout is a worktree of the mirror with its own HEAD
+// and index, sharing the history of the mirror instead of copying it; with options.History set
+// nothing is checked out until Checkout is called.
+func (c *Cache) Clone(ctx context.Context, repoURL, dir string, options CloneOptions) (string, error) {
+	commitSHA, err := c.addWorktree(ctx, repoURL, dir, options)
+	if err != nil {
+		return "", err
+	}
+	if options.History {
+		return commitSHA, nil
+	}
+
+	repo, err := openRepository(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to open worktree: %w", err)
+	}
+	if len(options.Sparse) > 0 {
+		err = checkoutSparse(repo, dir, commitSHA, options.Sparse)
+	} else {
+		err = checkoutCommit(repo, commitSHA)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to check out %s: %w", options.Ref.Name, err)
+	}
+	return commitSHA, nil
+}
+
+// addWorktree updates the mirror of a repository and links dir to it as a new worktree at the
+// requested commit, or at the remote HEAD recorded by the update. Checkouts only hold the lock
+// of the mirror while it is updated.
+func (c *Cache) addWorktree(ctx context.Context, repoURL, dir string, options CloneOptions) (string, error) {
+	key := mirrorKey(repoURL)
+	lock := c.lock(key)
+	lock.Lock()
+	defer lock.Unlock()
+
+	mirror := c.mirrorPath(key)
+	if err := c.update(ctx, repoURL, mirror, options); err != nil {
+		return "", err
+	}
+	// The modification time of a mirror records when it was last used, for eviction
+	now := time.Now()
+	if err := os.Chtimes(mirror, now, now); err != nil {
+		slog.Debug("cannot record use of mirror", "mirror", mirror, "error", err)
+	}
+
+	commitSHA := options.Ref.CommitSHA
+	if commitSHA == "" {
+		head, err := mirrorHead(mirror)
+		if err != nil {
+			return "", err
+		}
+		commitSHA = head
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("failed to create worktree: %w", err)
+	}
+	if err := linkWorktree(mirror, dir, commitSHA); err != nil {
+		return "", fmt.Errorf("failed to link worktree to mirror: %w", err)
+	}
+	return commitSHA, nil
+}
+
+// mirrorHead returns the commit the remote HEAD pointed to when the mirror was last fetched
+func mirrorHead(mirror string) (string, error) {
+	repo, err := git.PlainOpen(mirror)
+	if err != nil {
+		return "", fmt.Errorf("failed to open mirror: %w", err)
+	}
+	ref, err := repo.Reference(mirrorHeadRef, true)
+	if err != nil {
+		return "", retry.Classify(retry.ClassNotFound, fmt.Errorf("the remote does not advertise a HEAD: %w", err))
+	}
+	return ref.Hash().String(), nil
+}
+
+// linkWorktree registers dir as a worktree of mirror the way git worktree does: the metadata below
+// <mirror>/worktrees holds the HEAD and index of the checkout and refers back to the mirror through
+// commondir for objects and references. Metadata of worktrees that were removed is pruned first.
+func linkWorktree(mirror, dir, commitSHA string) error {
+	worktrees := filepath.Join(mirror, worktreesDir)
+	if err := pruneWorktrees(worktrees); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(worktrees, 0o755); err != nil {
+		return err
+	}
+	metadata, err := os.MkdirTemp(worktrees, unsafeNameChars.ReplaceAllString(filepath.Base(dir), "_")+"-")
+	if err != nil {
+		return err
+	}
+
+	gitDir := filepath.Join(dir, git.GitDirName)
+	for name, content := range map[string]string{
+		"HEAD":      commitSHA,
+		"commondir": filepath.Join("..", ".."),
+		"gitdir":    gitDir,
+	} {
+		if err := os.WriteFile(filepath.Join(metadata, name), []byte(content+"\n"), 0o644); err != nil {
+			return err
+		}
+	}
+	return os.WriteFile(gitDir, []byte("gitdir: "+metadata+"\n"), 0o644)
+}
+
+// pruneWorktrees removes the metadata of worktrees whose checkout no longer exists
+func pruneWorktrees(worktrees string) error {
+	entries, err := os.ReadDir(worktrees)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		metadata := filepath.Join(worktrees, entry.Name())
+		gitDir, err := os.ReadFile(filepath.Join(metadata, "gitdir"))
+		if err == nil {
+			if _, err = os.Stat(strings.TrimSpace(string(gitDir))); err == nil {
+				continue
+			}
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		if err := os.RemoveAll(metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openRepository opens a clone or a worktree of a cached mirror
+func openRepository(dir string) (*git.Repository, error) {
+	return git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+}
+
+// update fetches the branches and tags of a repository into its mirror, creating the mirror if
+// it does not exist or cannot be read. New mirrors that fail or grow too large are removed.
+func (c *Cache) update(ctx context.Context, repoURL, mirror string, options CloneOptions) error {
+	endpoint, auth, err := options.Credentials.endpoint(repoURL)
+	if err != nil {
+		return retry.Classify(retry.ClassAuth, err)
+	}
+
+	created := false
+	repo, err := git.PlainOpen(mirror)
+	if err != nil {
+		if !errors.Is(err, git.ErrRepositoryNotExists) {
+			slog.Warn("replacing unreadable mirror", "mirror", mirror, "error", err)
+		}
+		if err := os.RemoveAll(mirror); err != nil {
+			return fmt.Errorf("failed to remove mirror: %w", err)
+		}
+		if repo, err = git.PlainInit(mirror, true); err != nil {
+			return fmt.Errorf("failed to create mirror: %w", err)
+		}
+		created = true
+	}
+	removeNew := func() {
+		if created {
+			_ = os.RemoveAll(mirror)
+		}
+	}
+
+	fetchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	tooLarge := make(chan int64, 1)
+	if options.MaxSize > 0 && created {
+		go watchSize(fetchCtx, mirror, options.MaxSize, tooLarge, cancel)
+	}
+
+	// The endpoint is not stored in the mirror since it may carry credentials
+	remote := git.NewRemote(repo.Storer, &config.RemoteConfig{
+		Name:  git.DefaultRemoteName,
+		URLs:  []string{endpoint},
+		Fetch: mirrorRefSpecs,
+	})
+	fetch := func(refSpecs []config.RefSpec) error {
+		err := remote.FetchContext(fetchCtx, &git.FetchOptions{
+			Auth:     auth,
+			RefSpecs: refSpecs,
+			Tags:     git.AllTags,
+			Force:    true,
+			Prune:    true,
+		})
+		if errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return nil
+		}
+		return err
+	}
+	err = fetch(append([]config.RefSpec{mirrorHeadRefSpec}, mirrorRefSpecs...))
+	if errors.Is(err, git.NoMatchingRefSpecError{}) {
+		// Remotes without a HEAD are mirrored without one, checking them out needs a ref
+		if err = fetch(mirrorRefSpecs); err == nil {
+			err = repo.Storer.RemoveReference(mirrorHeadRef)
+		}
+	}
+	select {
+	case size := <-tooLarge:
+		removeNew()
+		return tooLargeError(size, options.MaxSize)
+	default:
+	}
+	if err != nil {
+		removeNew()
+		return fmt.Errorf("failed to fetch repository: %w", classifyGitError(err))
+	}
+
+	if options.MaxSize > 0 {
+		if size, err := DirSize(mirror); err == nil && size > options.MaxSize {
+			_ = os.RemoveAll(mirror)
+			return tooLargeError(size, options.MaxSize)
+		}
+	}
+	return nil
+}
+
+// Evict removes the least recently used mirrors until the cache fits its maximum size.
+// It must not be called while clones are in progress.
+func (c *Cache) Evict() error {
+	if c.maxSize <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if err != nil {
+		return fmt.Errorf("failed to list cache: %w", err)
+	}
+
+	type mirror struct {
+		path string
+		size int64
+		used time.Time
+	}
+	var mirrors []mirror
+	var total int64
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to inspect cache: %w", err)
+		}
+		path := filepath.Join(c.dir, entry.Name())
+		size, err := DirSize(path)
+		if err != nil {
+			return fmt.Errorf("failed to measure mirror %s: %w", path, err)
+		}
+		mirrors = append(mirrors, mirror{path: path, size: size, used: info.ModTime()})
+		total += size
+	}
+
+	sort.Slice(mirrors, func(i, j int) bool { return mirrors[i].used.Before(mirrors[j].used) })
+	for _, m := range mirrors {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.RemoveAll(m.path); err != nil {
+			return fmt.Errorf("failed to evict mirror %s: %w", m.path, err)
+		}
+		total -= m.size
+		slog.Info("evicted mirror from cache", "mirror", m.path, "size", m.size, "last_used", m.used.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func (c *Cache) lock(key string) *sync.Mutex {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	lock, ok := c.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		c.locks[key] = lock
+	}
+	return lock
+}
+
+// mirrorPath returns the directory of the mirror of a repository, named after its key
+// followed by a hash of the key that keeps names distinct after unsafe characters are replaced
+func (c *Cache) mirrorPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := strings.Trim(unsafeNameChars.ReplaceAllString(key, "_"), "_")
+	if len(name) > maxMirrorNameLength {
+		name = name[len(name)-maxMirrorNameLength:]
+	}
+	return filepath.Join(c.dir, fmt.Sprintf("%s-%x.git", name, sum[:6]))
+}
+
+// mirrorKey returns the canonical form of a repository URL that mirrors are keyed by, so that
+// URLs differing only in scheme, credentials, host case, a trailing slash or a .git suffix share a mirror
+func mirrorKey(repoURL string) string {
+	parsedURL, err := url.Parse(repoURL)
+	if err != nil {
+		return strings.TrimSuffix(strings.TrimSuffix(repoURL, "/"), ".git")
+	}
+	key := strings.ToLower(parsedURL.Host) + "/" + strings.Trim(parsedURL.Path, "/")
+	return strings.TrimSuffix(key, ".git")
+}
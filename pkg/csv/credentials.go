@@ -0,0 +1,162 @@
+package csv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	gitssh "github.com/go-git/go-git/v5/plumbing/transport/ssh"
+)
+
+// DefaultTokenHost is the host the token is sent to unless another host is configured
+const DefaultTokenHost = "github.com"
+
+// Credentials holds the secrets used to clone private repositories
+type Credentials struct {
+	Token            string           // Token sent to TokenHost over HTTPS
+	TokenHost        string           // Host the token is sent to, defaults to DefaultTokenHost
+	Netrc            map[string]Login // Logins by host, from a netrc file
+	SSH              bool             // Clone over SSH instead of HTTPS
+	SSHKey           string           // Private key file for SSH, the SSH agent is used if empty
+	SSHKeyPassphrase string           // Passphrase of the private key
+}
+
+// Login is a user name and password for a host
+type Login struct {
+	User     string
+	Password string
+}
+
+// defaultNetrcHost is the key of the netrc "default" entry used for hosts without an entry of their own
+const defaultNetrcHost = ""
+
+// LoadNetrc reads the logins of a netrc file. A missing file yields no logins unless required is set.
+func LoadNetrc(path string, required bool) (map[string]Login, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open credentials file: %w", err)
+	}
+	defer file.Close()
+
+	logins := make(map[string]Login)
+	var host string
+	var login Login
+	inEntry := false
+	flush := func() {
+		if inEntry {
+			logins[host] = login
+		}
+	}
+
+	scanner := bufio.NewScanner(file)
+	scanner.Split(bufio.ScanWords)
+	for scanner.Scan() {
+		switch word := scanner.Text(); word {
+		case "machine", "default":
+			flush()
+			host, login, inEntry = defaultNetrcHost, Login{}, true
+			if word == "machine" && scanner.Scan() {
+				host = strings.ToLower(scanner.Text())
+			}
+		case "login":
+			if scanner.Scan() {
+				login.User = scanner.Text()
+			}
+		case "password":
+			if scanner.Scan() {
+				login.Password = scanner.Text()
+			}
+		case "macdef":
+			// Macros run until an empty line, which a word scanner cannot see, so stop here
+			flush()
+			return logins, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read credentials file: %w", err)
+	}
+	flush()
+	return logins, nil
+}
+
+// DefaultNetrcPath returns the netrc file named by $NETRC or ~/.netrc
+func DefaultNetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ".netrc"
+	}
+	return filepath.Join(home, ".netrc")
+}
+
+// TokenFor returns the token or password to use for API requests to host, or an empty string
+func (c *Credentials) TokenFor(host string) string {
+	if c == nil {
+		return ""
+	}
+	if login, ok := c.Netrc[strings.ToLower(host)]; ok {
+		return login.Password
+	}
+	tokenHost := c.TokenHost
+	if tokenHost == "" {
+		tokenHost = DefaultTokenHost
+	}
+	if strings.EqualFold(host, tokenHost) {
+		return c.Token
+	}
+	return ""
+}
+
+// endpoint returns the URL to clone a repository from and the authentication to use for it
+func (c *Credentials) endpoint(repoURL string) (string, transport.AuthMethod, error) {
+	if c == nil {
+		return repoURL, nil, nil
+	}
+
+	parsedURL, err := url.Parse(repoURL)
+	if err != nil || (parsedURL.Scheme != "https" && parsedURL.Scheme != "ssh") {
+		// Local paths, file:// and plain http:// URLs are used as given
+		return repoURL, nil, nil
+	}
+
+	if c.SSH || parsedURL.Scheme == "ssh" {
+		sshURL := repoURL
+		if parsedURL.Scheme == "https" {
+			sshURL = fmt.Sprintf("ssh://git@%s%s", parsedURL.Host, parsedURL.Path)
+		}
+		if c.SSHKey == "" {
+			// go-git falls back to the SSH agent
+			return sshURL, nil, nil
+		}
+		auth, err := gitssh.NewPublicKeysFromFile("git", c.SSHKey, c.SSHKeyPassphrase)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to load SSH key %s: %w", c.SSHKey, err)
+		}
+		return sshURL, auth, nil
+	}
+
+	host := strings.ToLower(parsedURL.Hostname())
+	if login, ok := c.Netrc[host]; ok {
+		return repoURL, &githttp.BasicAuth{Username: login.User, Password: login.Password}, nil
+	}
+	if token := c.TokenFor(host); token != "" {
+		// GitHub and most other hosts accept a token as the password with any user name
+		return repoURL, &githttp.BasicAuth{Username: "x-access-token", Password: token}, nil
+	}
+	if login, ok := c.Netrc[defaultNetrcHost]; ok {
+		return repoURL, &githttp.BasicAuth{Username: login.User, Password: login.Password}, nil
+	}
+	return repoURL, nil, nil
+}
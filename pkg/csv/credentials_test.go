@@ -0,0 +1,147 @@
+package csv
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+func TestLoadNetrc(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    map[string]Login
+	}{
+		{
+			name:    "one line per machine",
+			content: "machine GitHub.com login octocat password secret\nmachine gitlab.example.com login bot password other\n",
+			want: map[string]Login{
+				"github.com":         {User: "octocat", Password: "secret"},
+				"gitlab.example.com": {User: "bot", Password: "other"},
+			},
+		},
+		{
+			name:    "multiple lines and default",
+			content: "machine github.com\n  login octocat\n  password secret\ndefault login anonymous password guest\n",
+			want: map[string]Login{
+				"github.com":     {User: "octocat", Password: "secret"},
+				defaultNetrcHost: {User: "anonymous", Password: "guest"},
+			},
+		},
+		{
+			name:    "macros end the file",
+			content: "machine github.com login octocat password secret\nmacdef init\nmachine evil.example.com login x password y\n",
+			want:    map[string]Login{"github.com": {User: "octocat", Password: "secret"}},
+		},
+		{
+			name:    "empty",
+			content: "",
+			want:    map[string]Login{},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".netrc")
+			if err := os.WriteFile(path, []byte(test.content), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			got, err := LoadNetrc(path, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("LoadNetrc = %v, want %v", got, test.want)
+			}
+		})
+	}
+
+	missing := filepath.Join(t.TempDir(), ".netrc")
+	if logins, err := LoadNetrc(missing, false); err != nil || logins != nil {
+		t.Errorf("LoadNetrc of a missing optional file = %v, %v, want no logins", logins, err)
+	}
+	if _, err := LoadNetrc(missing, true); err == nil {
+		t.Error("LoadNetrc of a missing required file succeeded")
+	}
+}
+
+func TestTokenFor(t *testing.T) {
+	netrc := map[string]Login{
+		"gitlab.example.com": {User: "bot", Password: "netrc-secret"},
+		defaultNetrcHost:     {User: "anonymous", Password: "guest"},
+	}
+	tests := []struct {
+		name        string
+		credentials *Credentials
+		host        string
+		want        string
+	}{
+		{"no credentials", nil, "github.com", ""},
+		{"default token host", &Credentials{Token: "secret"}, "github.com", "secret"},
+		{"token host case", &Credentials{Token: "secret"}, "GitHub.com", "secret"},
+		{"token not sent to other hosts", &Credentials{Token: "secret"}, "gitlab.example.com", ""},
+		{"token not sent to subdomains", &Credentials{Token: "secret"}, "evil.github.com", ""},
+		{"token not sent to lookalike hosts", &Credentials{Token: "secret"}, "github.com.example.com", ""},
+		{"configured token host", &Credentials{Token: "secret", TokenHost: "ghe.example.com"}, "ghe.example.com", "secret"},
+		{"configured token host only", &Credentials{Token: "secret", TokenHost: "ghe.example.com"}, "github.com", ""},
+		{"netrc host", &Credentials{Token: "secret", Netrc: netrc}, "GitLab.example.com", "netrc-secret"},
+		// The netrc default entry is for git, API tokens are only sent to hosts named explicitly
+		{"netrc default not used", &Credentials{Netrc: netrc}, "api.example.com", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.credentials.TokenFor(test.host); got != test.want {
+				t.Errorf("TokenFor(%q) = %q, want %q", test.host, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEndpoint(t *testing.T) {
+	netrc := map[string]Login{"gitlab.example.com": {User: "bot", Password: "netrc-secret"}}
+	withDefault := map[string]Login{defaultNetrcHost: {User: "anonymous", Password: "guest"}}
+	tokenAuth := &githttp.BasicAuth{Username: "x-access-token", Password: "secret"}
+	tests := []struct {
+		name        string
+		credentials *Credentials
+		repoURL     string
+		wantURL     string
+		wantAuth    transport.AuthMethod
+	}{
+		{"no credentials", nil, "https://github.com/acme/widget", "https://github.com/acme/widget", nil},
+		{"token", &Credentials{Token: "secret"}, "https://github.com/acme/widget", "https://github.com/acme/widget", tokenAuth},
+		{"token host case", &Credentials{Token: "secret"}, "https://GITHUB.COM/acme/widget", "https://GITHUB.COM/acme/widget", tokenAuth},
+		{"token not sent to other hosts", &Credentials{Token: "secret"}, "https://gitlab.example.com/acme/widget", "https://gitlab.example.com/acme/widget", nil},
+		{"token not sent over plain HTTP", &Credentials{Token: "secret"}, "http://github.com/acme/widget", "http://github.com/acme/widget", nil},
+		{"token not sent to local paths", &Credentials{Token: "secret"}, "file:///srv/git/widget", "file:///srv/git/widget", nil},
+		{"netrc host", &Credentials{Token: "secret", Netrc: netrc}, "https://gitlab.example.com/acme/widget", "https://gitlab.example.com/acme/widget",
+			&githttp.BasicAuth{Username: "bot", Password: "netrc-secret"}},
+		{"token before netrc default", &Credentials{Token: "secret", Netrc: withDefault}, "https://github.com/acme/widget", "https://github.com/acme/widget", tokenAuth},
+		{"netrc default", &Credentials{Token: "secret", Netrc: withDefault}, "https://gitlab.example.com/acme/widget", "https://gitlab.example.com/acme/widget",
+			&githttp.BasicAuth{Username: "anonymous", Password: "guest"}},
+		{"ssh", &Credentials{Token: "secret", SSH: true}, "https://github.com/acme/widget", "ssh://git@github.com/acme/widget", nil},
+		{"ssh remote", &Credentials{Token: "secret"}, "ssh://git@github.com/acme/widget", "ssh://git@github.com/acme/widget", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			gotURL, gotAuth, err := test.credentials.endpoint(test.repoURL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if gotURL != test.wantURL {
+				t.Errorf("endpoint URL = %s, want %s", gotURL, test.wantURL)
+			}
+			if !reflect.DeepEqual(gotAuth, test.wantAuth) {
+				t.Errorf("endpoint auth = %v, want %v", gotAuth, test.wantAuth)
+			}
+		})
+	}
+
+	credentials := &Credentials{SSH: true, SSHKey: filepath.Join(t.TempDir(), "id_ed25519")}
+	if _, _, err := credentials.endpoint("https://github.com/acme/widget"); err == nil {
+		t.Error("endpoint with a missing SSH key succeeded")
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"database/sql"
 	"encoding/csv"
 	"fmt"
+	"log/slog"
 	"os"
 	"reflect"
+	"regexp"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -18,6 +20,9 @@ var ctx = context.Background()
 type LoadOptions struct {
 	StartLine  int // Line number to start loading from (0-based, excluding header)
 	MaxRecords int // Maximum number of records to load (0 means load all)
+
+	// Progress is called after every loaded record with the fraction of the file read so far
+	Progress func(fraction float64)
 }
 
 // LoadCSVToSQLite loads CSV data into SQLite
@@ -29,6 +34,11 @@ func LoadCSVToSQLite(filePath string, db *sql.DB, options LoadOptions) error {
 	}
 	defer file.Close()
 
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat file: %w", err)
+	}
+
 	reader := csv.NewReader(file)
 
 	header, err := reader.Read()
@@ -121,6 +131,9 @@ func LoadCSVToSQLite(filePath string, db *sql.DB, options LoadOptions) error {
 			return fmt.Errorf("failed to insert record into sqlite: %w", err)
 		}
 		loadedRecords++
+		if options.Progress != nil && info.Size() > 0 {
+			options.Progress(float64(reader.InputOffset()) / float64(info.Size()))
+		}
 	}
 
 	return nil
@@ -142,6 +155,20 @@ const (
 	OperatorNotIn              Operator = "NOT IN"
 )
 
+// Operators lists all supported filter operators
+var Operators = []Operator{
+	OperatorEqual,
+	OperatorGreaterThan,
+	OperatorLessThan,
+	OperatorGreaterThanOrEqual,
+	OperatorLessThanOrEqual,
+	OperatorNotEqual,
+	OperatorLike,
+	OperatorNotLike,
+	OperatorIn,
+	OperatorNotIn,
+}
+
 // FilterCriteria defines the criteria for filtering rows
 type FilterCriteria struct {
 	Field    string
@@ -163,6 +190,31 @@ func ParseFilterCriteria(criteriaStr string) (FilterCriteria, error) {
 	}, nil
 }
 
+// RepoColumns returns the column names of the repos table in schema order
+func RepoColumns(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("PRAGMA table_info(repos)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repos schema: %w", err)
+	}
+	defer rows.Close()
+
+	var columns []string
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return nil, fmt.Errorf("failed to scan column: %w", err)
+		}
+		columns = append(columns, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read columns: %w", err)
+	}
+
+	return columns, nil
+}
+
 // HandleNullString handles sql.NullString.
 func HandleNullString(ns sql.NullString) string {
 	if ns.Valid {
@@ -223,13 +275,27 @@ func HandleNullValue(value interface{}) interface{} {
 type FilterOptions struct {
 	Criteria    []FilterCriteria
 	MaxResults  int
-	SkipRecords int // Number of records to skip
+	SkipRecords int    // Number of records to skip
+	OrderBy     string // ORDER BY clause, defaults to "default_score DESC"
+}
+
+var orderByTermRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\s+(?i:ASC|DESC))?$`)
+
+// ParseOrderBy validates an ordering such as "repo_star_count DESC, repo_url" and returns it normalized
+func ParseOrderBy(orderBy string) (string, error) {
+	terms := strings.Split(orderBy, ",")
+	for i, term := range terms {
+		term = strings.Join(strings.Fields(term), " ")
+		if !orderByTermRegexp.MatchString(term) {
+			return "", fmt.Errorf("invalid order by term: %q", term)
+		}
+		terms[i] = term
+	}
+	return strings.Join(terms, ", "), nil
 }
 
 // FilterSQLiteData filters data in SQLite based on multiple criteria and returns a slice of RepoData structs
 func FilterSQLiteData(db *sql.DB, options FilterOptions) ([]RepoData, error) {
-	var filteredRecords []RepoData
-
 	// Build query
 	query := "SELECT * FROM repos WHERE "
 	args := []interface{}{}
@@ -241,23 +307,80 @@ func FilterSQLiteData(db *sql.DB, options FilterOptions) ([]RepoData, error) {
 		args = append(args, criterion.Value)
 	}
 
-	// Add ORDER BY clause for Criticality Score (default_score) in descending order
-	query += " ORDER BY default_score DESC"
-
-	// Add LIMIT and OFFSET clauses
-	if options.MaxResults > 0 {
-		query += fmt.Sprintf(" LIMIT %d", options.MaxResults)
+	// Add ORDER BY clause, defaulting to Criticality Score (default_score) in descending order
+	orderBy := "default_score DESC"
+	if options.OrderBy != "" {
+		var err error
+		orderBy, err = ParseOrderBy(options.OrderBy)
+		if err != nil {
+			return nil, err
+		}
 	}
-	if options.SkipRecords > 0 {
-		query += fmt.Sprintf(" OFFSET %d", options.SkipRecords)
+	query += " ORDER BY " + orderBy
+
+	// Add LIMIT and OFFSET clauses, a negative limit returns all rows
+	if options.MaxResults > 0 || options.SkipRecords > 0 {
+		limit := -1
+		if options.MaxResults > 0 {
+			limit = options.MaxResults
+		}
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, limit, options.SkipRecords)
 	}
-	fmt.Println(query)
+	slog.Debug("filtering repositories", "query", query, "args", args)
 	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query sqlite: %w", err)
 	}
 	defer rows.Close()
 
+	return scanRepoRows(rows)
+}
+
+// maxQueryParams is the number of parameters older SQLite versions accept in a statement
+const maxQueryParams = 999
+
+// GetReposByURL returns the repos with the given URLs in the same order.
+// URLs that are no longer present in the repos table are returned with only RepoURL set.
+func GetReposByURL(db *sql.DB, repoURLs []string) ([]RepoData, error) {
+	byURL := make(map[string]RepoData, len(repoURLs))
+	for start := 0; start < len(repoURLs); start += maxQueryParams {
+		batch := repoURLs[start:min(start+maxQueryParams, len(repoURLs))]
+		args := make([]interface{}, len(batch))
+		for i, repoURL := range batch {
+			args[i] = repoURL
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		rows, err := db.Query("SELECT * FROM repos WHERE repo_url IN ("+placeholders+")", args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to query sqlite: %w", err)
+		}
+		found, err := scanRepoRows(rows)
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, repo := range found {
+			byURL[repo.RepoURL] = repo
+		}
+	}
+
+	repos := make([]RepoData, 0, len(repoURLs))
+	for _, repoURL := range repoURLs {
+		repo, ok := byURL[repoURL]
+		if !ok {
+			repo = RepoData{RepoURL: repoURL}
+		}
+		repos = append(repos, repo)
+	}
+
+	return repos, nil
+}
+
+// scanRepoRows converts rows of the repos table into RepoData structs
+func scanRepoRows(rows *sql.Rows) ([]RepoData, error) {
+	var filteredRecords []RepoData
+
 	columns, err := rows.Columns()
 	if err != nil {
 		return nil, fmt.Errorf("failed to get columns: %w", err)
@@ -326,5 +449,9 @@ func FilterSQLiteData(db *sql.DB, options FilterOptions) ([]RepoData, error) {
 		filteredRecords = append(filteredRecords, repo)
 	}
 
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rows: %w", err)
+	}
+
 	return filteredRecords, nil
 }
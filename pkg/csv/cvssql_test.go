@@ -0,0 +1,85 @@
+package csv
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"testing"
+)
+
+func TestFilterSQLiteData(t *testing.T) {
+	db := openReposDB(t, 5)
+	goRepos := []FilterCriteria{{Field: "repo_language", Operator: OperatorEqual, Value: "Go"}}
+	tests := []struct {
+		name    string
+		options FilterOptions
+		want    []string // Repositories in the order they are returned
+	}{
+		{
+			name:    "all",
+			options: FilterOptions{Criteria: goRepos},
+			want:    []string{repoURL(4), repoURL(3), repoURL(2), repoURL(1), repoURL(0)},
+		},
+		{
+			name:    "limit",
+			options: FilterOptions{Criteria: goRepos, MaxResults: 2},
+			want:    []string{repoURL(4), repoURL(3)},
+		},
+		{
+			name:    "skip without limit",
+			options: FilterOptions{Criteria: goRepos, SkipRecords: 3},
+			want:    []string{repoURL(1), repoURL(0)},
+		},
+		{
+			name:    "limit and skip",
+			options: FilterOptions{Criteria: goRepos, MaxResults: 2, SkipRecords: 1, OrderBy: "repo_url"},
+			want:    []string{repoURL(1), repoURL(2)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repos, err := FilterSQLiteData(db, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, repo := range repos {
+				got = append(got, repo.RepoURL)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("FilterSQLiteData = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFilterSQLiteDataLogsParameters(t *testing.T) {
+	db := openReposDB(t, 1)
+	var log bytes.Buffer
+	defer slog.SetDefault(slog.Default())
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&log, &slog.HandlerOptions{Level: slog.LevelDebug})))
+
+	options := FilterOptions{
+		Criteria:    []FilterCriteria{{Field: "repo_language", Operator: OperatorEqual, Value: "Go"}},
+		MaxResults:  10,
+		SkipRecords: 2,
+	}
+	if _, err := FilterSQLiteData(db, options); err != nil {
+		t.Fatal(err)
+	}
+	var record struct {
+		Query string
+		Args  []any
+	}
+	if err := json.Unmarshal(log.Bytes(), &record); err != nil {
+		t.Fatal(err)
+	}
+	wantQuery := "SELECT * FROM repos WHERE repo_language = ? ORDER BY default_score DESC LIMIT ? OFFSET ?"
+	if record.Query != wantQuery {
+		t.Errorf("logged query %q, want %q", record.Query, wantQuery)
+	}
+	if want := []any{"Go", 10.0, 2.0}; !reflect.DeepEqual(record.Args, want) {
+		t.Errorf("logged parameters %v, want %v", record.Args, want)
+	}
+}
@@ -0,0 +1,64 @@
+package csv
+
+import (
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// classifyGitError annotates an error returned by go-git with its retry class
+func classifyGitError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return retry.Classify(gitErrorClass(err), err)
+}
+
+func gitErrorClass(err error) retry.Class {
+	if class := retry.ClassOf(err); class != retry.ClassUnknown {
+		return class
+	}
+
+	switch {
+	case errors.Is(err, transport.ErrRepositoryNotFound):
+		return retry.ClassNotFound
+	case errors.Is(err, transport.ErrAuthenticationRequired),
+		errors.Is(err, transport.ErrAuthorizationFailed),
+		errors.Is(err, transport.ErrInvalidAuthMethod):
+		return retry.ClassAuth
+	case errors.Is(err, transport.ErrEmptyRemoteRepository):
+		return retry.ClassPermanent
+	}
+
+	var httpErr *githttp.Err
+	if errors.As(err, &httpErr) {
+		switch code := httpErr.StatusCode(); {
+		case code == http.StatusNotFound, code == http.StatusGone:
+			return retry.ClassNotFound
+		case code == http.StatusUnauthorized, code == http.StatusForbidden:
+			return retry.ClassAuth
+		case code == http.StatusTooManyRequests, code >= http.StatusInternalServerError:
+			return retry.ClassTransient
+		default:
+			return retry.ClassPermanent
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return retry.ClassTransient
+	}
+
+	return retry.ClassUnknown
+}
@@ -3,14 +3,24 @@ package csv
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/google/go-github/v63/github"
 	"golang.org/x/oauth2"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
 )
 
 // DownloadSBOMFromGitHub downloads the SBOM for a repository from GitHub
@@ -88,19 +98,238 @@ func SaveSBOMToFile(sbomContent, dir, repoName string) error {
 	return nil
 }
 
-// CloneRepo clones a Git repository using HTTP to a specified directory without history
-func CloneRepo(repoURL, dir string) error {
-	// Convert HTTPS URL to HTTP
-	httpURL := strings.Replace(repoURL, "https://", "http://", 1)
+// ErrTooLarge is returned when a repository exceeds the configured maximum size
+var ErrTooLarge = errors.New("repository is too large")
+
+// sizeCheckInterval is how often the size of a clone in progress is measured
+const sizeCheckInterval = 500 * time.Millisecond
+
+// CloneOptions defines options for cloning a repository
+type CloneOptions struct {
+	MaxSize     int64        // Maximum size in bytes of the clone on disk (0 means no limit)
+	Credentials *Credentials // Credentials for private repositories, may be nil
+	Ref         ResolvedRef  // Reference to check out, the remote HEAD if empty
+	History     bool         // Clone the full history and all tags without checking out, ignoring Ref
+	Sparse      []string     // Only check out files matching these manifest patterns, see MatchManifest
+}
+
+// CloneRepo clones a Git repository over HTTPS or SSH to a specified directory without history
+// and returns the SHA of the cloned commit. Errors are classified with the retry package.
+// The clone is aborted when ctx is done or when it grows beyond options.MaxSize.
+func CloneRepo(ctx context.Context, repoURL, dir string, options CloneOptions) (string, error) {
+	cloneCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	tooLarge := make(chan int64, 1)
+	if options.MaxSize > 0 {
+		go watchSize(cloneCtx, dir, options.MaxSize, tooLarge, cancel)
+	}
+
+	endpoint, auth, err := options.Credentials.endpoint(repoURL)
+	if err != nil {
+		return "", retry.Classify(retry.ClassAuth, err)
+	}
 
-	// Clone the repository with depth 1 (shallow clone)
-	_, err := git.PlainClone(dir, false, &git.CloneOptions{
-		URL:   httpURL,
+	cloneOptions := &git.CloneOptions{
+		URL:   endpoint,
+		Auth:  auth,
 		Depth: 1, // Shallow clone
+	}
+	switch {
+	case options.History:
+		cloneOptions.Depth = 0
+		cloneOptions.NoCheckout = true
+	case options.pinned():
+		// Used when the server does not let fetchCommit fetch the commit alone
+		cloneOptions.Depth = 0
+		cloneOptions.NoCheckout = true
+	case options.Ref.Reference != "":
+		cloneOptions.ReferenceName = options.Ref.Reference
+		cloneOptions.SingleBranch = true
+	}
+	if len(options.Sparse) > 0 && !options.History {
+		cloneOptions.NoCheckout = true
+	}
+
+	var repo *git.Repository
+	if options.pinned() {
+		repo, err = fetchCommit(cloneCtx, dir, endpoint, auth, options.Ref.CommitSHA)
+		if err != nil && cloneCtx.Err() == nil {
+			slog.Debug("cannot fetch the commit alone, cloning the full history", "repo", repoURL, "commit", options.Ref.CommitSHA, "error", err)
+			repo = nil
+			err = os.RemoveAll(filepath.Join(dir, git.GitDirName))
+		}
+	}
+	if repo == nil && err == nil {
+		repo, err = git.PlainCloneContext(cloneCtx, dir, false, cloneOptions)
+	}
+	if err == nil && cloneOptions.NoCheckout && !options.History {
+		err = checkoutRef(repo, dir, options)
+	}
+	select {
+	case size := <-tooLarge:
+		return "", tooLargeError(size, options.MaxSize)
+	default:
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to clone repository: %w", classifyGitError(err))
+	}
+	// Clones finishing between two checks are measured once more
+	if options.MaxSize > 0 {
+		if size, err := DirSize(dir); err == nil && size > options.MaxSize {
+			return "", tooLargeError(size, options.MaxSize)
+		}
+	}
+
+	if options.pinned() {
+		return options.Ref.CommitSHA, nil
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve HEAD of cloned repository: %w", err)
+	}
+
+	return head.Hash().String(), nil
+}
+
+// pinnedRef is the reference fetchCommit stores a fetched commit under
+const pinnedRef = "refs/bomfactory/pinned"
+
+// fetchCommit creates a repository at dir and fetches a single commit into it, without its history.
+// This requires the server to allow fetching commits by SHA, as GitHub, GitLab and Bitbucket do.
+func fetchCommit(ctx context.Context, dir, endpoint string, auth transport.AuthMethod, commitSHA string) (*git.Repository, error) {
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		return nil, err
+	}
+	remote, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{endpoint}})
+	if err != nil {
+		return nil, err
+	}
+	err = remote.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(commitSHA + ":" + pinnedRef)},
+		Depth:    1,
+		Auth:     auth,
+		Tags:     git.NoTags,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to clone repository: %w", err)
+		return nil, err
+	}
+	return repo, nil
+}
+
+// pinned reports whether a commit rather than a branch or tag is cloned
+func (o CloneOptions) pinned() bool {
+	return o.Ref.IsCommit() && o.Ref.CommitSHA != "" && !o.History
+}
+
+// checkoutRef checks out the cloned commit of a repository cloned without checkout,
+// only writing the files matching the sparse patterns if there are any
+func checkoutRef(repo *git.Repository, dir string, options CloneOptions) error {
+	commitSHA := options.Ref.CommitSHA
+	if !options.pinned() {
+		head, err := repo.Head()
+		if err != nil {
+			return fmt.Errorf("failed to resolve HEAD of cloned repository: %w", err)
+		}
+		commitSHA = head.Hash().String()
 	}
+	if len(options.Sparse) == 0 {
+		return checkoutCommit(repo, commitSHA)
+	}
+	return checkoutSparse(repo, dir, commitSHA, options.Sparse)
+}
 
+// checkoutCommit checks out a commit of a repository cloned without checkout
+func checkoutCommit(repo *git.Repository, commitSHA string) error {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	// Force replaces the files of a previous checkout
+	if err := worktree.Checkout(&git.CheckoutOptions{Hash: plumbing.NewHash(commitSHA), Force: true}); err != nil {
+		return retry.Classify(retry.ClassNotFound, fmt.Errorf("commit %s: %w", commitSHA, err))
+	}
 	return nil
 }
+
+func tooLargeError(size, maxSize int64) error {
+	return retry.Classify(retry.ClassPermanent,
+		fmt.Errorf("%w: the clone reached %d bytes, the limit is %d bytes", ErrTooLarge, size, maxSize))
+}
+
+// watchSize cancels a clone in progress once the size of dir exceeds maxSize, reporting the size on tooLarge
+func watchSize(ctx context.Context, dir string, maxSize int64, tooLarge chan<- int64, cancel context.CancelFunc) {
+	ticker := time.NewTicker(sizeCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			size, err := DirSize(dir)
+			if err == nil && size > maxSize {
+				tooLarge <- size
+				cancel()
+				return
+			}
+		}
+	}
+}
+
+// DirSize returns the total size in bytes of the files below a directory
+func DirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// githubAPIURL is the base URL of the GitHub API used by RepoSize
+var githubAPIURL = "https://api.github.com/"
+
+// ErrRateLimited is returned by RepoSize once the GitHub API rate limit is exhausted
+var ErrRateLimited = errors.New("GitHub API rate limit exceeded")
+
+// RepoSize returns the size in bytes GitHub reports for a repository, without cloning it.
+// ok is false if the repository is not hosted on GitHub. An empty token makes an unauthenticated request.
+func RepoSize(ctx context.Context, repoURL, token string) (size int64, ok bool, err error) {
+	parsedURL, err := url.Parse(repoURL)
+	if err != nil || !strings.EqualFold(parsedURL.Host, "github.com") {
+		return 0, false, nil
+	}
+	parts := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(parts) != 2 {
+		return 0, false, nil
+	}
+
+	client := github.NewClient(nil)
+	if client.BaseURL, err = url.Parse(githubAPIURL); err != nil {
+		return 0, false, err
+	}
+	if token != "" {
+		client = client.WithAuthToken(token)
+	}
+	repo, _, err := client.Repositories.Get(ctx, parts[0], strings.TrimSuffix(parts[1], ".git"))
+	var rateLimitErr *github.RateLimitError
+	var abuseRateLimitErr *github.AbuseRateLimitError
+	if errors.As(err, &rateLimitErr) || errors.As(err, &abuseRateLimitErr) {
+		return 0, false, fmt.Errorf("%w: %w", ErrRateLimited, err)
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to get repository from GitHub: %w", err)
+	}
+	// GitHub reports the size in kilobytes
+	return int64(repo.GetSize()) * 1024, true, nil
+}
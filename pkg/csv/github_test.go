@@ -0,0 +1,171 @@
+package csv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+func TestRepoSize(t *testing.T) {
+	var authorization string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/repos/org/repo":
+			_, _ = w.Write([]byte(`{"name": "repo", "size": 2048}`))
+		case "/repos/org/limited":
+			w.Header().Set("X-RateLimit-Limit", "60")
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", "4102444800")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"message": "API rate limit exceeded for 192.0.2.1."}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer func(apiURL string) { githubAPIURL = apiURL }(githubAPIURL)
+	githubAPIURL = server.URL + "/"
+	ctx := context.Background()
+
+	size, ok, err := RepoSize(ctx, "https://github.com/org/repo.git", "secret")
+	if err != nil || !ok || size != 2048*1024 {
+		t.Errorf("RepoSize = %d, %v, %v, want 2 MiB", size, ok, err)
+	}
+	if authorization != "Bearer secret" {
+		t.Errorf("Authorization header %q, want the token", authorization)
+	}
+
+	if _, _, err := RepoSize(ctx, "https://github.com/org/limited", ""); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("RepoSize of a rate limited request = %v, want ErrRateLimited", err)
+	}
+	if _, _, err := RepoSize(ctx, "https://github.com/org/missing", ""); err == nil || errors.Is(err, ErrRateLimited) {
+		t.Errorf("RepoSize of a missing repository = %v, want another error", err)
+	}
+
+	for _, repoURL := range []string{"https://gitlab.com/org/repo", "https://github.com/org", "https://github.com/org/repo/tree/main"} {
+		if _, ok, err := RepoSize(ctx, repoURL, ""); ok || err != nil {
+			t.Errorf("RepoSize(%s) = %v, %v, want no size and no request", repoURL, ok, err)
+		}
+	}
+}
+
+func TestCloneRepoPinnedCommit(t *testing.T) {
+	origin := t.TempDir()
+	first := commitFile(t, origin, "version", "1")
+	second := commitFile(t, origin, "version", "2")
+	commitFile(t, origin, "version", "3")
+	// Like GitHub, let clients fetch commits no branch points to
+	fetchable := t.TempDir()
+	for _, commit := range []string{"1", "2", "3"} {
+		commitFile(t, fetchable, "version", commit)
+	}
+	repo, err := git.PlainOpen(fetchable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := repo.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Raw.Section("uploadpack").SetOption("allowReachableSHA1InWant", "true")
+	if err := repo.SetConfig(cfg); err != nil {
+		t.Fatal(err)
+	}
+	fetchableLog := commitLog(t, fetchable)
+
+	tests := []struct {
+		name    string
+		origin  string
+		commit  string
+		sparse  []string
+		want    string
+		commits int
+	}{
+		{name: "fetched alone", origin: fetchable, commit: fetchableLog[1], want: "2", commits: 1},
+		{name: "fetched alone sparse", origin: fetchable, commit: fetchableLog[1], sparse: []string{"version"}, want: "2", commits: 1},
+		{name: "server refusing to fetch a commit alone", origin: origin, commit: second, want: "2", commits: 3},
+		{name: "first commit", origin: origin, commit: first, want: "1", commits: 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "clone")
+			options := CloneOptions{Ref: ResolvedRef{Name: test.commit, CommitSHA: test.commit}, Sparse: test.sparse}
+			commitSHA, err := CloneRepo(context.Background(), "file://"+test.origin, dir, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if commitSHA != test.commit {
+				t.Errorf("CloneRepo returned %s, want %s", commitSHA, test.commit)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "version"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != test.want {
+				t.Errorf("checked out version %q, want %q", data, test.want)
+			}
+			if got := countCommits(t, dir); got != test.commits {
+				t.Errorf("clone holds %d commits, want %d", got, test.commits)
+			}
+		})
+	}
+
+	// A commit the server does not have fails the shallow fetch and the full clone
+	missing := "0123456789abcdef0123456789abcdef01234567"
+	options := CloneOptions{Ref: ResolvedRef{Name: missing, CommitSHA: missing}}
+	if _, err := CloneRepo(context.Background(), "file://"+fetchable, filepath.Join(t.TempDir(), "clone"), options); err == nil {
+		t.Error("CloneRepo of a missing commit succeeded")
+	}
+}
+
+// commitLog returns the SHAs of the commits of the repository at dir, starting at HEAD
+func commitLog(t *testing.T, dir string) []string {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := repo.Log(&git.LogOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var log []string
+	err = commits.ForEach(func(commit *object.Commit) error {
+		log = append(log, commit.Hash.String())
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+// countCommits returns the number of commits stored in the repository at dir
+func countCommits(t *testing.T, dir string) int {
+	t.Helper()
+	repo, err := git.PlainOpen(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	commits, err := repo.CommitObjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	err = commits.ForEach(func(*object.Commit) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
@@ -0,0 +1,98 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+)
+
+// Tag is a release tag of a cloned repository
+type Tag struct {
+	Name      string
+	CommitSHA string    // Commit the tag points to
+	Date      time.Time // Date of an annotated tag, or of its commit for a lightweight tag
+}
+
+// ReleaseTags returns the semantic version release tags of a repository cloned with
+// CloneOptions.History, from the oldest to the newest version. Only tags dated since
+// are returned if it is not zero, and only the newest limit tags if limit is positive.
+func ReleaseTags(dir string, since time.Time, limit int) ([]Tag, error) {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	iter, err := repo.Tags()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tags: %w", err)
+	}
+	found := make(map[string]Tag)
+	var names []string
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		tag, err := releaseTag(repo, ref)
+		if err != nil {
+			// Tags of trees or blobs are not releases
+			slog.Debug("ignoring tag", "tag", ref.Name().Short(), "error", err)
+			return nil
+		}
+		if tag.Date.Before(since) {
+			return nil
+		}
+		found[tag.Name] = tag
+		names = append(names, tag.Name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	names = versionOrder(names, true)
+	if limit > 0 && len(names) > limit {
+		names = names[len(names)-limit:]
+	}
+	tags := make([]Tag, 0, len(names))
+	for _, name := range names {
+		tags = append(tags, found[name])
+	}
+	return tags, nil
+}
+
+// releaseTag returns the commit and date of a tag, peeling annotated tags
+func releaseTag(repo *git.Repository, ref *plumbing.Reference) (Tag, error) {
+	tag := Tag{Name: ref.Name().Short()}
+	hash := ref.Hash()
+	annotated, err := repo.TagObject(hash)
+	if err == nil {
+		commit, err := annotated.Commit()
+		if err != nil {
+			return tag, err
+		}
+		tag.CommitSHA, tag.Date = commit.Hash.String(), annotated.Tagger.When
+		return tag, nil
+	}
+	if !errors.Is(err, plumbing.ErrObjectNotFound) {
+		return tag, err
+	}
+
+	var commit *object.Commit
+	if commit, err = repo.CommitObject(hash); err != nil {
+		return tag, err
+	}
+	tag.CommitSHA, tag.Date = commit.Hash.String(), commit.Committer.When
+	return tag, nil
+}
+
+// Checkout checks out a commit in a repository cloned with CloneOptions.History,
+// replacing the files of any previous checkout
+func Checkout(dir, commitSHA string) error {
+	repo, err := openRepository(dir)
+	if err != nil {
+		return fmt.Errorf("failed to open repository: %w", err)
+	}
+	return checkoutCommit(repo, commitSHA)
+}
@@ -0,0 +1,138 @@
+package csv
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+// LocalRepository is a git checkout found on disk
+type LocalRepository struct {
+	Dir     string      // Root of the working tree
+	RepoURL string      // Canonical URL of the origin remote
+	Head    ResolvedRef // Checked out branch, or the commit of a detached HEAD
+}
+
+// FindRepositories returns the working trees of the git repositories under root, in walk order.
+// Repositories nested in other working trees, such as submodules, are not returned.
+// Directories below root that cannot be read are logged and left out.
+func FindRepositories(root string) ([]string, error) {
+	var dirs []string
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return skipUnreadable(root, path, err)
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if entry.Name() == git.GitDirName {
+			return filepath.SkipDir
+		}
+		// Submodules and worktrees have a .git file pointing to the repository instead of a directory
+		if _, err := os.Lstat(filepath.Join(path, git.GitDirName)); err == nil {
+			dirs = append(dirs, path)
+			return filepath.SkipDir
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return skipUnreadable(root, path, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s for repositories: %w", root, err)
+	}
+	return dirs, nil
+}
+
+// skipUnreadable logs a directory below root that cannot be read and skips it,
+// so one unreadable directory does not abort the search
+func skipUnreadable(root, path string, err error) error {
+	if path == root {
+		return err
+	}
+	slog.Warn("skipping unreadable directory", "dir", path, "error", err)
+	return filepath.SkipDir
+}
+
+// OpenLocal reads the origin remote and the checked out HEAD of the working tree in dir
+func OpenLocal(dir string) (LocalRepository, error) {
+	// Worktrees created with git worktree add keep their remotes in the common directory of the repository
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{EnableDotGitCommonDir: true})
+	if err != nil {
+		return LocalRepository{}, fmt.Errorf("failed to open repository: %w", err)
+	}
+
+	remote, err := repo.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return LocalRepository{}, fmt.Errorf("failed to read %s remote: %w", git.DefaultRemoteName, err)
+	}
+	urls := remote.Config().URLs
+	if len(urls) == 0 {
+		return LocalRepository{}, fmt.Errorf("%s remote has no URL", git.DefaultRemoteName)
+	}
+	repoURL, err := CanonicalRepoURL(urls[0], dir)
+	if err != nil {
+		return LocalRepository{}, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return LocalRepository{}, fmt.Errorf("failed to read HEAD: %w", err)
+	}
+	ref := ResolvedRef{Name: head.Hash().String(), CommitSHA: head.Hash().String()}
+	if head.Name() != plumbing.HEAD {
+		ref.Name, ref.Reference = head.Name().Short(), head.Name()
+	}
+
+	return LocalRepository{Dir: dir, RepoURL: repoURL, Head: ref}, nil
+}
+
+// scpLikeURL matches remotes in the scp syntax of git, such as git@github.com:org/repo.git
+var scpLikeURL = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// CanonicalRepoURL converts a git remote URL into the https repository URL the repos table uses,
+// so that checkouts cloned over ssh or with credentials in the URL share the names of their SBOMs.
+// Remotes on the local filesystem are returned as file URLs, with relative paths resolved against
+// dir, the working tree the remote belongs to, as git does.
+func CanonicalRepoURL(remoteURL, dir string) (string, error) {
+	var host, repoPath string
+	if match := scpLikeURL.FindStringSubmatch(remoteURL); match != nil && !strings.Contains(remoteURL, "://") {
+		host, repoPath = match[1], match[2]
+	} else {
+		parsed, err := url.Parse(remoteURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse remote URL: %w", err)
+		}
+		switch parsed.Scheme {
+		case "https", "http", "ssh", "git", "git+ssh":
+			host, repoPath = parsed.Hostname(), parsed.Path
+		case "file":
+			return "file://" + strings.TrimSuffix(strings.TrimSuffix(parsed.Path, "/"), ".git"), nil
+		case "":
+			if !filepath.IsAbs(remoteURL) {
+				remoteURL = filepath.Join(dir, remoteURL)
+			}
+			abs, err := filepath.Abs(remoteURL)
+			if err != nil {
+				return "", fmt.Errorf("failed to resolve remote path: %w", err)
+			}
+			return "file://" + strings.TrimSuffix(filepath.ToSlash(abs), ".git"), nil
+		default:
+			return "", fmt.Errorf("unsupported remote URL scheme %q", parsed.Scheme)
+		}
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if host == "" || repoPath == "" {
+		return "", fmt.Errorf("invalid remote URL %s", remoteURL)
+	}
+	return "https://" + strings.ToLower(host) + "/" + repoPath, nil
+}
@@ -0,0 +1,145 @@
+package csv
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+)
+
+func TestCanonicalRepoURL(t *testing.T) {
+	dir := filepath.FromSlash("/work/checkouts/widget")
+	tests := []struct {
+		remote string
+		want   string
+	}{
+		{"https://github.com/acme/widget.git", "https://github.com/acme/widget"},
+		{"https://token@GitHub.com/acme/widget/", "https://github.com/acme/widget"},
+		{"git@github.com:acme/widget.git", "https://github.com/acme/widget"},
+		{"ssh://git@gitlab.example.com:2222/group/sub/widget.git", "https://gitlab.example.com/group/sub/widget"},
+		{"file:///srv/git/widget.git", "file:///srv/git/widget"},
+		{"/srv/git/widget.git", "file:///srv/git/widget"},
+		// Relative paths are relative to the checkout, not to the working directory of the process
+		{"../upstream.git", "file:///work/checkouts/upstream"},
+		{"mirrors/widget", "file:///work/checkouts/widget/mirrors/widget"},
+	}
+	for _, test := range tests {
+		got, err := CanonicalRepoURL(test.remote, dir)
+		if err != nil {
+			t.Errorf("CanonicalRepoURL(%q) failed: %v", test.remote, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("CanonicalRepoURL(%q) = %s, want %s", test.remote, got, test.want)
+		}
+	}
+
+	for _, remote := range []string{"svn://example.com/widget", "https://github.com/", "git@github.com:"} {
+		if got, err := CanonicalRepoURL(remote, dir); err == nil {
+			t.Errorf("CanonicalRepoURL(%q) = %s, want an error", remote, got)
+		}
+	}
+}
+
+func TestOpenLocalRelativeOrigin(t *testing.T) {
+	root := t.TempDir()
+	checkout := filepath.Join(root, "checkouts", "widget")
+	commitFile(t, checkout, "go.mod", "module widget")
+	repo, err := git.PlainOpen(checkout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{"../upstream.git"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The source name must not depend on where the scan was started
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	local, err := OpenLocal(checkout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "file://" + filepath.ToSlash(filepath.Join(root, "checkouts", "upstream"))
+	if local.RepoURL != want {
+		t.Errorf("OpenLocal read origin %s, want %s", local.RepoURL, want)
+	}
+	if local.Head.Name != "master" {
+		t.Errorf("OpenLocal read HEAD %s, want master", local.Head.Name)
+	}
+}
+
+func TestFindRepositories(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a", "nested/b", "a/vendor/c"} {
+		commitFile(t, filepath.Join(root, filepath.FromSlash(dir)), "go.mod", "module "+dir)
+	}
+	// Submodules and worktrees are found by their .git file
+	if err := os.MkdirAll(filepath.Join(root, "worktree"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "worktree", git.GitDirName), []byte("gitdir: ../a/.git/worktrees/w\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	unreadable := filepath.Join(root, "private")
+	commitFile(t, filepath.Join(unreadable, "d"), "go.mod", "module d")
+	if err := os.Chmod(unreadable, 0); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chmod(unreadable, 0o755) })
+
+	dirs, err := FindRepositories(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(root, "a"), filepath.Join(root, "nested", "b"), filepath.Join(root, "worktree")}
+	if _, err := os.ReadDir(unreadable); err == nil {
+		// Permissions are not enforced, e.g. for root
+		want = append(want[:2], filepath.Join(unreadable, "d"), want[2])
+	}
+	if !reflect.DeepEqual(dirs, want) {
+		t.Errorf("FindRepositories = %v, want %v", dirs, want)
+	}
+
+	if _, err := FindRepositories(filepath.Join(root, "missing")); err == nil {
+		t.Error("searching a missing directory succeeded")
+	}
+}
+
+func TestOpenLocalWorktree(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	main := filepath.Join(root, "main")
+	commitFile(t, main, "go.mod", "module widget")
+	repo, err := git.PlainOpen(main)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{"https://github.com/org/widget.git"}}); err != nil {
+		t.Fatal(err)
+	}
+	worktree := filepath.Join(root, "feature")
+	if output, err := exec.Command("git", "-C", main, "worktree", "add", "-b", "feature", worktree).CombinedOutput(); err != nil {
+		t.Fatalf("git worktree add failed: %v\n%s", err, output)
+	}
+
+	local, err := OpenLocal(worktree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if local.RepoURL != "https://github.com/org/widget" || local.Head.Name != "feature" || local.Dir != worktree {
+		t.Errorf("OpenLocal = %+v, want the origin of the repository and the feature branch", local)
+	}
+}
@@ -0,0 +1,222 @@
+package csv
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/blang/semver/v4"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/storage/memory"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// Ref specifications understood by ResolveRef besides branch, tag and commit names
+const (
+	RefDefault      = "default"       // The branch the remote HEAD points to
+	RefLatestTag    = "latest-tag"    // The greatest tag in version order, including pre-releases
+	RefLatestSemver = "latest-semver" // The greatest tag that is a semantic version release
+)
+
+// peeledSuffix marks the advertised reference of the commit an annotated tag points to
+const peeledSuffix = "^{}"
+
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// ResolvedRef is the git reference a ref specification resolved to on the remote
+type ResolvedRef struct {
+	Name      string                 // Short name such as "main" or "v1.2.3", or the commit SHA
+	Reference plumbing.ReferenceName // Full reference name, empty for a pinned commit
+	CommitSHA string                 // Commit the reference points to
+}
+
+// IsCommit reports whether the ref is a pinned commit rather than a branch or tag
+func (r ResolvedRef) IsCommit() bool {
+	return r.Reference == ""
+}
+
+// ResolveRef resolves a ref specification against the references advertised by the remote:
+// "default", "latest-tag", "latest-semver", a branch or tag name, or a full commit SHA
+func ResolveRef(ctx context.Context, repoURL, spec string, credentials *Credentials) (ResolvedRef, error) {
+	if spec == "" {
+		spec = RefDefault
+	}
+	if commitPattern.MatchString(spec) {
+		return ResolvedRef{Name: spec, CommitSHA: spec}, nil
+	}
+
+	refs, err := listRefs(ctx, repoURL, credentials)
+	if err != nil {
+		return ResolvedRef{}, err
+	}
+
+	switch spec {
+	case RefDefault:
+		return resolveHead(refs)
+	case RefLatestTag, RefLatestSemver:
+		tag, ok := latestTag(refs, spec == RefLatestSemver)
+		if !ok {
+			return ResolvedRef{}, retry.Classify(retry.ClassNotFound, fmt.Errorf("no tag found for %s", spec))
+		}
+		return resolved(refs, plumbing.NewTagReferenceName(tag)), nil
+	}
+
+	for _, name := range []plumbing.ReferenceName{
+		plumbing.ReferenceName(spec),
+		plumbing.NewBranchReferenceName(spec),
+		plumbing.NewTagReferenceName(spec),
+	} {
+		if _, ok := refs[name]; ok {
+			return resolved(refs, name), nil
+		}
+	}
+	return ResolvedRef{}, retry.Classify(retry.ClassNotFound, fmt.Errorf("reference %s not found on the remote", spec))
+}
+
+// listRefs returns the references advertised by the remote by name, including peeled tags
+func listRefs(ctx context.Context, repoURL string, credentials *Credentials) (map[plumbing.ReferenceName]*plumbing.Reference, error) {
+	endpoint, auth, err := credentials.endpoint(repoURL)
+	if err != nil {
+		return nil, retry.Classify(retry.ClassAuth, err)
+	}
+
+	remote := git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{endpoint},
+	})
+
+	list, err := remote.ListContext(ctx, &git.ListOptions{Auth: auth, PeelingOption: git.AppendPeeled})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list remote references: %w", classifyGitError(err))
+	}
+
+	refs := make(map[plumbing.ReferenceName]*plumbing.Reference, len(list))
+	for _, ref := range list {
+		refs[ref.Name()] = ref
+	}
+	return refs, nil
+}
+
+// resolveHead follows the remote HEAD, usually a symbolic reference to the default branch
+func resolveHead(refs map[plumbing.ReferenceName]*plumbing.Reference) (ResolvedRef, error) {
+	head, ok := refs[plumbing.HEAD]
+	if !ok {
+		return ResolvedRef{}, fmt.Errorf("remote has no HEAD reference")
+	}
+	name := plumbing.HEAD
+	for i := 0; head.Type() == plumbing.SymbolicReference && i < 10; i++ {
+		target, ok := refs[head.Target()]
+		if !ok {
+			return ResolvedRef{}, fmt.Errorf("remote HEAD points to unknown reference %s", head.Target())
+		}
+		name, head = head.Target(), target
+	}
+
+	// Servers that do not advertise the HEAD target are matched by commit
+	if name == plumbing.HEAD {
+		for _, ref := range refs {
+			if ref.Name().IsBranch() && ref.Hash() == head.Hash() {
+				name = ref.Name()
+				break
+			}
+		}
+	}
+	return ResolvedRef{Name: name.Short(), Reference: name, CommitSHA: head.Hash().String()}, nil
+}
+
+// resolved returns the reference together with its commit, peeling annotated tags
+func resolved(refs map[plumbing.ReferenceName]*plumbing.Reference, name plumbing.ReferenceName) ResolvedRef {
+	hash := refs[name].Hash()
+	if peeled, ok := refs[name+peeledSuffix]; ok {
+		hash = peeled.Hash()
+	}
+	return ResolvedRef{Name: name.Short(), Reference: name, CommitSHA: hash.String()}
+}
+
+// latestTag returns the greatest tag name, only considering semantic version releases if releasesOnly is set
+func latestTag(refs map[plumbing.ReferenceName]*plumbing.Reference, releasesOnly bool) (string, bool) {
+	var names []string
+	for name := range refs {
+		if name.IsTag() && !strings.HasSuffix(string(name), peeledSuffix) {
+			names = append(names, name.Short())
+		}
+	}
+	tags := versionOrder(names, releasesOnly)
+	if len(tags) == 0 {
+		return "", false
+	}
+	return tags[len(tags)-1], true
+}
+
+// versionOrder sorts tag names from the lowest to the greatest version,
+// dropping tags that are not semantic version releases if releasesOnly is set
+func versionOrder(names []string, releasesOnly bool) []string {
+	var tags []string
+	versions := make(map[string]semver.Version)
+	for _, tag := range names {
+		version, err := semver.ParseTolerant(tag)
+		if err == nil {
+			versions[tag] = version
+		}
+		if releasesOnly && (err != nil || len(version.Pre) > 0) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		vi, iok := versions[tags[i]]
+		vj, jok := versions[tags[j]]
+		if iok && jok && samePreRelease(vi, vj) {
+			// Semantic versioning compares "rc10" and "rc2" as strings, tags such as v2.0.0-rc10 expect numbers
+			return naturalLess(tags[i], tags[j])
+		}
+		if iok && jok && !vi.EQ(vj) {
+			return vi.LT(vj)
+		}
+		if iok != jok {
+			// Tags that are versions sort after tags that are not
+			return jok
+		}
+		return naturalLess(tags[i], tags[j])
+	})
+	return tags
+}
+
+// samePreRelease reports whether two versions are pre-releases of the same release
+func samePreRelease(a, b semver.Version) bool {
+	return len(a.Pre) > 0 && len(b.Pre) > 0 && a.Major == b.Major && a.Minor == b.Minor && a.Patch == b.Patch
+}
+
+var chunkPattern = regexp.MustCompile(`\d+|\D+`)
+
+// naturalLess compares strings treating runs of digits as numbers, so "v1.10" sorts after "v1.9"
+func naturalLess(a, b string) bool {
+	chunksA, chunksB := chunkPattern.FindAllString(a, -1), chunkPattern.FindAllString(b, -1)
+	for i := 0; i < len(chunksA) && i < len(chunksB); i++ {
+		if chunksA[i] == chunksB[i] {
+			continue
+		}
+		if isDigits(chunksA[i]) && isDigits(chunksB[i]) {
+			// Numbers of any length compare by their digits without leading zeros
+			numberA, numberB := strings.TrimLeft(chunksA[i], "0"), strings.TrimLeft(chunksB[i], "0")
+			if len(numberA) != len(numberB) {
+				return len(numberA) < len(numberB)
+			}
+			if numberA != numberB {
+				return numberA < numberB
+			}
+		}
+		return chunksA[i] < chunksB[i]
+	}
+	return len(chunksA) < len(chunksB)
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
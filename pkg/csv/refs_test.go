@@ -0,0 +1,150 @@
+package csv
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+func TestResolveRefKeepsHTTPS(t *testing.T) {
+	// A plain HTTP server sees a request only if the remote is queried over HTTP instead of HTTPS
+	var plainRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		plainRequests.Add(1)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	repoURL := strings.Replace(server.URL, "http://", "https://", 1) + "/acme/widget"
+
+	for _, credentials := range []*Credentials{nil, {Token: "secret", TokenHost: "127.0.0.1"}} {
+		if _, err := ResolveRef(context.Background(), repoURL, RefDefault, credentials); err == nil {
+			t.Error("ResolveRef succeeded against a server that does not speak HTTPS")
+		}
+	}
+	if n := plainRequests.Load(); n > 0 {
+		t.Errorf("%s was queried over plain HTTP %d times", repoURL, n)
+	}
+}
+
+func TestVersionOrder(t *testing.T) {
+	names := []string{"v1.10.0", "nightly", "v1.9.0", "v2.0.0-rc1", "v2.0.0-rc10", "v2.0.0-rc2", "1.2", "v1.2.0", "release-3", "release-10", "v2.0.0"}
+	tests := []struct {
+		name         string
+		releasesOnly bool
+		want         []string
+	}{
+		{
+			name: "all tags",
+			// Versions sort after other tags, equal versions and pre-releases of the same number naturally
+			want: []string{"nightly", "release-3", "release-10", "1.2", "v1.2.0", "v1.9.0", "v1.10.0", "v2.0.0-rc1", "v2.0.0-rc2", "v2.0.0-rc10", "v2.0.0"},
+		},
+		{
+			name:         "releases only",
+			releasesOnly: true,
+			want:         []string{"1.2", "v1.2.0", "v1.9.0", "v1.10.0", "v2.0.0"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := versionOrder(names, test.releasesOnly); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("versionOrder = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"v1.9", "v1.10", true},
+		{"v1.10", "v1.9", false},
+		{"release-2", "release-10", true},
+		{"v1.0", "v1.0", false},
+		{"v1", "v1.0", true},
+		{"alpha", "beta", true},
+		{"v01", "v1", true},
+		{"v99999999999999999999", "v100000000000000000000", true},
+	}
+	for _, test := range tests {
+		if got := naturalLess(test.a, test.b); got != test.want {
+			t.Errorf("naturalLess(%q, %q) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestResolveRef(t *testing.T) {
+	origin := t.TempDir()
+	first := commitFile(t, origin, "version", "1")
+	second := commitFile(t, origin, "version", "2")
+	repo, err := git.PlainOpen(origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tagger := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	for tag, target := range map[string]string{"v1.9.0": first, "v1.10.0": second, "v2.0.0-rc1": second} {
+		if _, err := repo.CreateTag(tag, plumbing.NewHash(target), nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	annotated, err := repo.CreateTag("v1.0.0", plumbing.NewHash(first), &git.CreateTagOptions{Tagger: tagger, Message: "v1.0.0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.CreateBranch(&config.Branch{Name: "release"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(plumbing.NewBranchReferenceName("release"), plumbing.NewHash(first))); err != nil {
+		t.Fatal(err)
+	}
+	repoURL := "file://" + origin
+
+	tests := []struct {
+		spec string
+		want ResolvedRef
+	}{
+		{"", ResolvedRef{Name: "master", Reference: plumbing.NewBranchReferenceName("master"), CommitSHA: second}},
+		{RefDefault, ResolvedRef{Name: "master", Reference: plumbing.NewBranchReferenceName("master"), CommitSHA: second}},
+		{RefLatestTag, ResolvedRef{Name: "v2.0.0-rc1", Reference: plumbing.NewTagReferenceName("v2.0.0-rc1"), CommitSHA: second}},
+		{RefLatestSemver, ResolvedRef{Name: "v1.10.0", Reference: plumbing.NewTagReferenceName("v1.10.0"), CommitSHA: second}},
+		{"release", ResolvedRef{Name: "release", Reference: plumbing.NewBranchReferenceName("release"), CommitSHA: first}},
+		{"refs/heads/release", ResolvedRef{Name: "release", Reference: plumbing.NewBranchReferenceName("release"), CommitSHA: first}},
+		{"v1.9.0", ResolvedRef{Name: "v1.9.0", Reference: plumbing.NewTagReferenceName("v1.9.0"), CommitSHA: first}},
+		// Annotated tags resolve to the commit, not to the tag object
+		{"v1.0.0", ResolvedRef{Name: "v1.0.0", Reference: plumbing.NewTagReferenceName("v1.0.0"), CommitSHA: first}},
+		{first, ResolvedRef{Name: first, CommitSHA: first}},
+	}
+	for _, test := range tests {
+		got, err := ResolveRef(context.Background(), repoURL, test.spec, nil)
+		if err != nil {
+			t.Errorf("ResolveRef(%q) failed: %v", test.spec, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("ResolveRef(%q) = %+v, want %+v", test.spec, got, test.want)
+		}
+	}
+	if annotated.Hash().String() == first {
+		t.Fatal("v1.0.0 is not an annotated tag")
+	}
+
+	_, err = ResolveRef(context.Background(), repoURL, "missing", nil)
+	var retryErr *retry.Error
+	if !errors.As(err, &retryErr) || retry.ClassOf(err) != retry.ClassNotFound {
+		t.Errorf("ResolveRef of a missing ref = %v, want a not_found error", err)
+	}
+}
@@ -0,0 +1,214 @@
+package csv
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Selection is a named, frozen list of repository URLs produced by a filter
+type Selection struct {
+	Name      string
+	Filter    string
+	Snapshot  string
+	CreatedAt string
+	RepoURLs  []string
+}
+
+// SelectionDiff describes the differences between two selections
+type SelectionDiff struct {
+	Added   []string // URLs present only in the second selection
+	Removed []string // URLs present only in the first selection
+	Common  int      // Number of URLs present in both selections
+}
+
+// CreateSelectionsTable creates the selections table if it does not exist
+func CreateSelectionsTable(db *sql.DB) error {
+	createTableStmt := `
+	CREATE TABLE IF NOT EXISTS selections (
+		name TEXT PRIMARY KEY,
+		filter TEXT,
+		snapshot TEXT,
+		created_at TEXT,
+		repo_urls TEXT
+	);
+	`
+	_, err := db.Exec(createTableStmt)
+	if err != nil {
+		return fmt.Errorf("failed to create selections table: %w", err)
+	}
+	return nil
+}
+
+// FormatFilterCriteria renders filter criteria back into the 'field:operator:value' form
+func FormatFilterCriteria(criteria []FilterCriteria) string {
+	parts := make([]string, 0, len(criteria))
+	for _, criterion := range criteria {
+		parts = append(parts, fmt.Sprintf("%s:%s:%s", criterion.Field, criterion.Operator, criterion.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+// FormatFilterOptions renders filter options as their criteria followed by the ordering, skipped
+// records and maximum results that decide which repositories were selected
+func FormatFilterOptions(options FilterOptions) string {
+	orderBy := options.OrderBy
+	if orderBy == "" {
+		orderBy = "default_score DESC"
+	}
+	description := fmt.Sprintf("%s (order by %s", FormatFilterCriteria(options.Criteria), orderBy)
+	if options.SkipRecords > 0 {
+		description += fmt.Sprintf(", skip %d", options.SkipRecords)
+	}
+	if options.MaxResults > 0 {
+		description += fmt.Sprintf(", max results %d", options.MaxResults)
+	}
+	return description + ")"
+}
+
+// CurrentSnapshot returns an identifier for the data currently loaded in the repos table
+func CurrentSnapshot(db *sql.DB) (string, error) {
+	var collectionDate sql.NullString
+	var count int
+	err := db.QueryRow("SELECT MAX(collection_date), COUNT(*) FROM repos").Scan(&collectionDate, &count)
+	if err != nil {
+		return "", fmt.Errorf("failed to read repos snapshot: %w", err)
+	}
+	return fmt.Sprintf("%s (%d repos)", HandleNullString(collectionDate), count), nil
+}
+
+// SaveSelection stores the ordered repository URLs of the filtered data under the given name
+func SaveSelection(db *sql.DB, name string, options FilterOptions, repos []RepoData) (*Selection, error) {
+	if name == "" {
+		return nil, fmt.Errorf("selection name must not be empty")
+	}
+	if err := CreateSelectionsTable(db); err != nil {
+		return nil, err
+	}
+
+	snapshot, err := CurrentSnapshot(db)
+	if err != nil {
+		return nil, err
+	}
+
+	selection := &Selection{
+		Name:      name,
+		Filter:    FormatFilterOptions(options),
+		Snapshot:  snapshot,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339),
+		RepoURLs:  make([]string, 0, len(repos)),
+	}
+	for _, repo := range repos {
+		selection.RepoURLs = append(selection.RepoURLs, repo.RepoURL)
+	}
+
+	urlsJSON, err := json.Marshal(selection.RepoURLs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal repository URLs: %w", err)
+	}
+
+	_, err = db.Exec("INSERT INTO selections (name, filter, snapshot, created_at, repo_urls) VALUES (?, ?, ?, ?, ?)",
+		selection.Name, selection.Filter, selection.Snapshot, selection.CreatedAt, string(urlsJSON))
+	if err != nil {
+		return nil, fmt.Errorf("failed to save selection %s: %w", name, err)
+	}
+
+	return selection, nil
+}
+
+// GetSelection loads a selection by name
+func GetSelection(db *sql.DB, name string) (*Selection, error) {
+	if err := CreateSelectionsTable(db); err != nil {
+		return nil, err
+	}
+
+	var selection Selection
+	var filter, snapshot, createdAt, urlsJSON sql.NullString
+	err := db.QueryRow("SELECT name, filter, snapshot, created_at, repo_urls FROM selections WHERE name = ?", name).
+		Scan(&selection.Name, &filter, &snapshot, &createdAt, &urlsJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("selection not found: %s", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load selection %s: %w", name, err)
+	}
+
+	selection.Filter = HandleNullString(filter)
+	selection.Snapshot = HandleNullString(snapshot)
+	selection.CreatedAt = HandleNullString(createdAt)
+	if urlsJSON.Valid {
+		if err := json.Unmarshal([]byte(urlsJSON.String), &selection.RepoURLs); err != nil {
+			return nil, fmt.Errorf("failed to parse repository URLs of selection %s: %w", name, err)
+		}
+	}
+
+	return &selection, nil
+}
+
+// ListSelections returns all stored selections ordered by creation time
+func ListSelections(db *sql.DB) ([]Selection, error) {
+	if err := CreateSelectionsTable(db); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query("SELECT name FROM selections ORDER BY created_at, name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query selections: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan selection: %w", err)
+		}
+		names = append(names, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read selections: %w", err)
+	}
+
+	selections := make([]Selection, 0, len(names))
+	for _, name := range names {
+		selection, err := GetSelection(db, name)
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, *selection)
+	}
+
+	return selections, nil
+}
+
+// DiffSelections compares the repository URLs of two selections
+func DiffSelections(from, to *Selection) SelectionDiff {
+	var diff SelectionDiff
+
+	inFrom := make(map[string]bool, len(from.RepoURLs))
+	for _, repoURL := range from.RepoURLs {
+		inFrom[repoURL] = true
+	}
+	inTo := make(map[string]bool, len(to.RepoURLs))
+	for _, repoURL := range to.RepoURLs {
+		inTo[repoURL] = true
+	}
+
+	for _, repoURL := range from.RepoURLs {
+		if !inTo[repoURL] {
+			diff.Removed = append(diff.Removed, repoURL)
+		}
+	}
+	for _, repoURL := range to.RepoURLs {
+		if inFrom[repoURL] {
+			diff.Common++
+		} else {
+			diff.Added = append(diff.Added, repoURL)
+		}
+	}
+
+	return diff
+}
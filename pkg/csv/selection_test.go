@@ -0,0 +1,111 @@
+package csv
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// openReposDB returns a database with a repos table holding count repositories
+func openReposDB(t *testing.T, count int) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if _, err := db.Exec("CREATE TABLE repos (repo_url TEXT, repo_language TEXT, default_score REAL, collection_date TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		_, err := db.Exec("INSERT INTO repos VALUES (?, 'Go', ?, '2024-01-01')", repoURL(i), float64(i))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return db
+}
+
+func repoURL(i int) string {
+	return fmt.Sprintf("https://github.com/org/repo%d", i)
+}
+
+func TestGetReposByURL(t *testing.T) {
+	const count = 2*maxQueryParams + 10
+	db := openReposDB(t, count)
+
+	// Ask for every repository in reverse order, plus one that is no longer in the table
+	var repoURLs []string
+	for i := count - 1; i >= 0; i-- {
+		repoURLs = append(repoURLs, repoURL(i))
+	}
+	repoURLs = append(repoURLs, "https://github.com/org/removed")
+
+	repos, err := GetReposByURL(db, repoURLs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repos) != len(repoURLs) {
+		t.Fatalf("GetReposByURL returned %d repositories, want %d", len(repos), len(repoURLs))
+	}
+	for i, repo := range repos[:count] {
+		if repo.RepoURL != repoURLs[i] {
+			t.Fatalf("repository %d is %s, want %s", i, repo.RepoURL, repoURLs[i])
+		}
+		if repo.RepoLanguage != "Go" || repo.DefaultScore != float64(count-1-i) {
+			t.Errorf("repository %s was not read from the table: %+v", repo.RepoURL, repo)
+		}
+	}
+	if removed := repos[count]; removed != (RepoData{RepoURL: "https://github.com/org/removed"}) {
+		t.Errorf("repository no longer in the table returned as %+v", removed)
+	}
+
+	if repos, err := GetReposByURL(db, nil); err != nil || len(repos) != 0 {
+		t.Errorf("GetReposByURL(nil) = %v, %v", repos, err)
+	}
+}
+
+func TestSaveSelectionDescribesOptions(t *testing.T) {
+	db := openReposDB(t, 5)
+	criteria := []FilterCriteria{{Field: "repo_language", Operator: OperatorEqual, Value: "Go"}}
+	tests := []struct {
+		name    string
+		options FilterOptions
+		want    string
+	}{
+		{
+			name:    "filter only",
+			options: FilterOptions{Criteria: criteria},
+			want:    "repo_language:=:Go (order by default_score DESC)",
+		},
+		{
+			name:    "every option",
+			options: FilterOptions{Criteria: criteria, MaxResults: 2, SkipRecords: 1, OrderBy: "repo_url"},
+			want:    "repo_language:=:Go (order by repo_url, skip 1, max results 2)",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			repos, err := FilterSQLiteData(db, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := SaveSelection(db, test.name, test.options, repos); err != nil {
+				t.Fatal(err)
+			}
+			selection, err := GetSelection(db, test.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if selection.Filter != test.want {
+				t.Errorf("selection filter %q, want %q", selection.Filter, test.want)
+			}
+			if len(selection.RepoURLs) != len(repos) {
+				t.Errorf("selection has %d repositories, want %d", len(selection.RepoURLs), len(repos))
+			}
+		})
+	}
+}
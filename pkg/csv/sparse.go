@@ -0,0 +1,159 @@
+package csv
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// DefaultManifestPatterns are the package manifests and lock files SBOM generators read,
+// checked out by sparse clones unless other patterns are configured
+var DefaultManifestPatterns = []string{
+	// Go
+	"go.mod", "go.sum", "go.work",
+	// JavaScript
+	"package.json", "package-lock.json", "npm-shrinkwrap.json", "yarn.lock", "pnpm-lock.yaml",
+	// Rust
+	"Cargo.toml", "Cargo.lock",
+	// Java and Kotlin
+	"pom.xml", "build.gradle", "build.gradle.kts", "gradle.lockfile", "*.jar",
+	// Python
+	"requirements*.txt", "setup.py", "setup.cfg", "pyproject.toml", "Pipfile", "Pipfile.lock", "poetry.lock", "uv.lock",
+	// Ruby
+	"Gemfile", "Gemfile.lock", "*.gemspec",
+	// PHP
+	"composer.json", "composer.lock",
+	// .NET
+	"*.csproj", "packages.config", "packages.lock.json", "*.deps.json",
+	// Swift and Objective-C
+	"Package.swift", "Package.resolved", "Podfile.lock",
+	// Elixir, Erlang, Dart, Haskell and C/C++
+	"mix.lock", "rebar.lock", "pubspec.lock", "cabal.project.freeze", "stack.yaml.lock", "conan.lock", "vcpkg.json",
+}
+
+// MatchManifest reports whether a slash separated repository path matches one of the patterns.
+// Patterns without a slash match the file name in any directory, others match the whole path.
+func MatchManifest(patterns []string, filePath string) bool {
+	name := path.Base(filePath)
+	for _, pattern := range patterns {
+		subject := name
+		if strings.Contains(pattern, "/") {
+			subject = filePath
+		}
+		if matched, _ := path.Match(pattern, subject); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// checkoutSparse writes the files of a commit that match the patterns to the worktree at dir
+func checkoutSparse(repo *git.Repository, dir, commitSHA string, patterns []string) error {
+	commit, err := repo.CommitObject(plumbing.NewHash(commitSHA))
+	if err != nil {
+		return retry.Classify(retry.ClassNotFound, fmt.Errorf("commit %s: %w", commitSHA, err))
+	}
+	tree, err := commit.Tree()
+	if err != nil {
+		return fmt.Errorf("failed to read tree of commit %s: %w", commitSHA, err)
+	}
+
+	count := 0
+	err = tree.Files().ForEach(func(file *object.File) error {
+		if file.Mode == filemode.Symlink || !MatchManifest(patterns, file.Name) {
+			return nil
+		}
+		reader, err := file.Reader()
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+		defer reader.Close()
+
+		mode := fs.FileMode(0o644)
+		if file.Mode == filemode.Executable {
+			mode = 0o755
+		}
+		if err := writeFile(dir, file.Name, reader, mode); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("sparse checkout failed: %w", err)
+	}
+	slog.Debug("sparse checkout", "commit", commitSHA, "files", count)
+	return nil
+}
+
+// CopyManifests copies the files below srcDir matching the patterns to dstDir,
+// leaving out the .git directory, and returns the number of files copied
+func CopyManifests(srcDir, dstDir string, patterns []string) (int, error) {
+	count := 0
+	err := filepath.WalkDir(srcDir, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == git.GitDirName {
+			return filepath.SkipDir
+		}
+		relPath, err := filepath.Rel(srcDir, filePath)
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() || !MatchManifest(patterns, filepath.ToSlash(relPath)) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		if err := writeFile(dstDir, filepath.ToSlash(relPath), file, info.Mode().Perm()); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, fmt.Errorf("failed to copy manifests: %w", err)
+	}
+	return count, nil
+}
+
+// writeFile writes a file at a slash separated path below dir, refusing paths that leave dir
+func writeFile(dir, name string, content io.Reader, mode fs.FileMode) error {
+	if !filepath.IsLocal(filepath.FromSlash(name)) {
+		return fmt.Errorf("refusing to write %s outside of %s", name, dir)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, content); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,125 @@
+package csv
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+)
+
+func TestMatchManifest(t *testing.T) {
+	patterns := []string{"go.mod", "requirements*.txt", "*.csproj", "tools/*.lock"}
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"go.mod", true},
+		{"cmd/app/go.mod", true},
+		{"go.mod.orig", false},
+		{"requirements.txt", true},
+		{"docs/requirements-dev.txt", true},
+		{"src/App/App.csproj", true},
+		// Patterns with a slash match the whole path
+		{"tools/deps.lock", true},
+		{"web/tools/deps.lock", false},
+		{"deps.lock", false},
+		{"README.md", false},
+	}
+	for _, test := range tests {
+		if got := MatchManifest(patterns, test.path); got != test.want {
+			t.Errorf("MatchManifest(%q) = %t, want %t", test.path, got, test.want)
+		}
+	}
+	if MatchManifest(nil, "go.mod") {
+		t.Error("go.mod matched without patterns")
+	}
+}
+
+func TestCheckoutSparse(t *testing.T) {
+	origin := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(origin, "web"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, origin, "README.md", "readme")
+	commitFile(t, origin, "main.go", "package main")
+	commitFile(t, origin, "web/package.json", "{}")
+	// Symlinks are not followed, so they cannot expose files outside of the checkout
+	if err := os.Symlink("/etc/passwd", filepath.Join(origin, "go.sum")); err != nil {
+		t.Fatal(err)
+	}
+	commitFile(t, origin, "go.mod", "module example.com/app")
+	repo, err := git.PlainOpen(origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("go.sum"); err != nil {
+		t.Fatal(err)
+	}
+	head := commitFile(t, origin, "main.go", "package main // changed")
+
+	dir := t.TempDir()
+	if err := checkoutSparse(repo, dir, head, DefaultManifestPatterns); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listFiles(t, dir), []string{"go.mod", "web/package.json"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("sparse checkout has %v, want %v", got, want)
+	}
+	content, err := os.ReadFile(filepath.Join(dir, "go.mod"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != "module example.com/app" {
+		t.Errorf("go.mod = %q", content)
+	}
+
+	if err := checkoutSparse(repo, t.TempDir(), "0123456789012345678901234567890123456789", DefaultManifestPatterns); err == nil {
+		t.Error("checked out a missing commit")
+	}
+}
+
+func TestCopyManifests(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"go.mod", "main.go", ".git/config", "vendor/modules.txt", "web/package.json"} {
+		path := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := t.TempDir()
+	count, err := CopyManifests(src, dst, []string{"go.mod", "package.json", "config"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := listFiles(t, dst), []string{"go.mod", "web/package.json"}; count != 2 || !reflect.DeepEqual(got, want) {
+		t.Errorf("CopyManifests copied %d files %v, want %v", count, got, want)
+	}
+}
+
+// listFiles returns the slash separated paths of the files below dir
+func listFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		files = append(files, filepath.ToSlash(rel))
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	return files
+}
@@ -0,0 +1,51 @@
+package disk
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// units maps size suffixes to their number of bytes, decimal and binary
+var units = []struct {
+	suffix string
+	bytes  float64
+}{
+	{"tib", 1 << 40}, {"gib", 1 << 30}, {"mib", 1 << 20}, {"kib", 1 << 10},
+	{"tb", 1e12}, {"gb", 1e9}, {"mb", 1e6}, {"kb", 1e3},
+	{"t", 1e12}, {"g", 1e9}, {"m", 1e6}, {"k", 1e3},
+	{"b", 1},
+}
+
+// ParseSize parses a size such as "500MB", "2GiB" or "1048576" into bytes
+func ParseSize(size string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(size))
+	multiplier := 1.0
+	for _, unit := range units {
+		if strings.HasSuffix(value, unit.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix))
+			multiplier = unit.bytes
+			break
+		}
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected a number with an optional unit such as 500MB or 2GiB", size)
+	}
+	return int64(number * multiplier), nil
+}
+
+// FormatSize formats a number of bytes for humans
+func FormatSize(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GiB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MiB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KiB", float64(bytes)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", bytes)
+	}
+}
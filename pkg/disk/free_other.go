@@ -0,0 +1,13 @@
+//go:build !unix && !windows
+
+package disk
+
+import "errors"
+
+// ErrUnsupported is returned by Free on platforms where free space cannot be determined
+var ErrUnsupported = errors.New("free space cannot be determined on this platform")
+
+// Free is not supported on this platform
+func Free(_ string) (int64, error) {
+	return 0, ErrUnsupported
+}
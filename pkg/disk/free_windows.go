@@ -0,0 +1,22 @@
+//go:build windows
+
+package disk
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// Free returns the number of bytes available to the current user on the volume containing path
+func Free(path string) (int64, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, fmt.Errorf("invalid path %s: %w", path, err)
+	}
+	var available, total, free uint64
+	if err := windows.GetDiskFreeSpaceEx(pathPtr, &available, &total, &free); err != nil {
+		return 0, fmt.Errorf("failed to get free space of %s: %w", path, err)
+	}
+	return int64(available), nil
+}
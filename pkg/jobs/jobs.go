@@ -0,0 +1,531 @@
+package jobs
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// Status is the state of an SBOM generation job
+type Status string
+
+const (
+	StatusPending   Status = "pending"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusSkipped   Status = "skipped"
+	StatusTimedOut  Status = "timed_out"
+)
+
+// Commands that record jobs, so each resumes only its own runs
+const (
+	CommandDownloadSBOM = "download-sbom"
+	CommandScanLocal    = "scan-local"
+)
+
+// Job is a single repository processed by an SBOM generation run
+type Job struct {
+	ID               int64
+	RunID            string
+	Command          string
+	RepoURL          string
+	Status           Status
+	Attempts         int
+	Error            string
+	ErrorClass       retry.Class
+	Duration         time.Duration
+	CommitSHA        string
+	Ref              string
+	OutputPaths      []string
+	Generator        string
+	GeneratorVersion string
+	CreatedAt        string
+	UpdatedAt        string
+}
+
+// Result holds the outcome of a succeeded job
+type Result struct {
+	Duration         time.Duration
+	CommitSHA        string
+	Ref              string
+	OutputPaths      []string
+	Generator        string
+	GeneratorVersion string
+}
+
+// columns lists the columns added to sbom_jobs after its initial version
+var columns = []struct{ name, definition string }{
+	{"generator", "TEXT"},
+	{"generator_version", "TEXT"},
+	{"error_class", "TEXT"},
+	{"ref", "TEXT"},
+	{"command", "TEXT"}, // NULL for jobs of download-sbom recorded before scan-local existed
+}
+
+// CreateTable creates the sbom_jobs table if it does not exist
+func CreateTable(db *sql.DB) error {
+	createTableStmt := `
+	CREATE TABLE IF NOT EXISTS sbom_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id TEXT NOT NULL,
+		repo_url TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		duration_ms INTEGER,
+		commit_sha TEXT,
+		output_path TEXT,
+		created_at TEXT,
+		updated_at TEXT
+	);
+	CREATE INDEX IF NOT EXISTS sbom_jobs_run_id ON sbom_jobs (run_id);
+	CREATE INDEX IF NOT EXISTS sbom_jobs_repo_url ON sbom_jobs (repo_url);
+	`
+	_, err := db.Exec(createTableStmt)
+	if err != nil {
+		return fmt.Errorf("failed to create sbom_jobs table: %w", err)
+	}
+	if err := addMissingColumns(db); err != nil {
+		return err
+	}
+	return createOutputsTable(db)
+}
+
+// createOutputsTable creates the sbom_outputs table, which records the job that last wrote each
+// output path so that the writer of a file is found by its path. Tables created by an upgrade
+// are filled from the output paths of earlier jobs.
+func createOutputsTable(db *sql.DB) error {
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'sbom_outputs'").Scan(&count)
+	if err != nil {
+		return fmt.Errorf("failed to read sbom_outputs schema: %w", err)
+	}
+	if count > 0 {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to create sbom_outputs table: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // Rollback after Commit is a no-op
+	_, err = tx.Exec(`
+	CREATE TABLE sbom_outputs (
+		path TEXT PRIMARY KEY,
+		job_id INTEGER NOT NULL,
+		repo_url TEXT NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("failed to create sbom_outputs table: %w", err)
+	}
+
+	rows, err := tx.Query("SELECT id, output_path FROM sbom_jobs WHERE status IN (?, ?) AND output_path IS NOT NULL ORDER BY id",
+		StatusSucceeded, StatusSkipped)
+	if err != nil {
+		return fmt.Errorf("failed to read output paths: %w", err)
+	}
+	outputs := make(map[int64][]string)
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var outputPath string
+		if err := rows.Scan(&id, &outputPath); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan output paths: %w", err)
+		}
+		ids = append(ids, id)
+		outputs[id] = decodePaths(outputPath)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read output paths: %w", err)
+	}
+	for _, id := range ids {
+		if err := recordOutputs(tx, id, outputs[id]); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create sbom_outputs table: %w", err)
+	}
+	return nil
+}
+
+// addMissingColumns upgrades sbom_jobs tables created by earlier versions
+func addMissingColumns(db *sql.DB) error {
+	rows, err := db.Query("PRAGMA table_info(sbom_jobs)")
+	if err != nil {
+		return fmt.Errorf("failed to read sbom_jobs schema: %w", err)
+	}
+	defer rows.Close()
+
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var cid, notNull, primaryKey int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &primaryKey); err != nil {
+			return fmt.Errorf("failed to scan column: %w", err)
+		}
+		existing[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read columns: %w", err)
+	}
+	rows.Close()
+
+	for _, column := range columns {
+		if existing[column.name] {
+			continue
+		}
+		if _, err := db.Exec(fmt.Sprintf("ALTER TABLE sbom_jobs ADD COLUMN %s %s", column.name, column.definition)); err != nil {
+			return fmt.Errorf("failed to add column %s to sbom_jobs: %w", column.name, err)
+		}
+	}
+	return nil
+}
+
+// NewRunID returns an identifier for a new SBOM generation run
+func NewRunID() string {
+	return time.Now().UTC().Format("20060102T150405.000Z")
+}
+
+func now() string {
+	return time.Now().UTC().Format(time.RFC3339)
+}
+
+// Enqueue records a pending job for every repository URL of a run of the command
+func Enqueue(db *sql.DB, runID, command string, repoURLs []string) ([]Job, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // Rollback after Commit is a no-op
+
+	stmt, err := tx.Prepare("INSERT INTO sbom_jobs (run_id, command, repo_url, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	created := now()
+	jobs := make([]Job, 0, len(repoURLs))
+	for _, repoURL := range repoURLs {
+		result, err := stmt.Exec(runID, command, repoURL, StatusPending, created, created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert job for %s: %w", repoURL, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job id for %s: %w", repoURL, err)
+		}
+		jobs = append(jobs, Job{
+			ID:        id,
+			RunID:     runID,
+			Command:   command,
+			RepoURL:   repoURL,
+			Status:    StatusPending,
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// Expand turns a job into one job per ref of its repository, for runs that generate an SBOM per release.
+// The job itself takes the first ref and a pending job is added for every other ref.
+func Expand(db *sql.DB, job Job, refs []string) ([]Job, error) {
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no refs to expand job %d into", job.ID)
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback() //nolint:errcheck // Rollback after Commit is a no-op
+
+	created := now()
+	if _, err := tx.Exec("UPDATE sbom_jobs SET ref = ?, updated_at = ? WHERE id = ?", refs[0], created, job.ID); err != nil {
+		return nil, fmt.Errorf("failed to expand job %d: %w", job.ID, err)
+	}
+	job.Ref = refs[0]
+	jobs := []Job{job}
+
+	stmt, err := tx.Prepare("INSERT INTO sbom_jobs (run_id, command, repo_url, ref, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare insert statement: %w", err)
+	}
+	defer stmt.Close()
+
+	for _, ref := range refs[1:] {
+		result, err := stmt.Exec(job.RunID, job.Command, job.RepoURL, ref, StatusPending, created, created)
+		if err != nil {
+			return nil, fmt.Errorf("failed to insert job for %s at %s: %w", job.RepoURL, ref, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get job id for %s at %s: %w", job.RepoURL, ref, err)
+		}
+		jobs = append(jobs, Job{
+			ID:        id,
+			RunID:     job.RunID,
+			Command:   job.Command,
+			RepoURL:   job.RepoURL,
+			Ref:       ref,
+			Status:    StatusPending,
+			CreatedAt: created,
+			UpdatedAt: created,
+		})
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit jobs: %w", err)
+	}
+	return jobs, nil
+}
+
+// LatestRunID returns the identifier of the most recent run of the command
+func LatestRunID(db *sql.DB, command string) (string, error) {
+	var runID string
+	err := db.QueryRow("SELECT run_id FROM sbom_jobs WHERE COALESCE(command, ?) = ? ORDER BY id DESC LIMIT 1",
+		CommandDownloadSBOM, command).Scan(&runID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("no previous %s run found", command)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find the latest run: %w", err)
+	}
+	return runID, nil
+}
+
+// Resumable returns the jobs of a run that did not succeed.
+// Running jobs are included since they were interrupted before finishing,
+// failed jobs are left out if their error class is permanent.
+func Resumable(db *sql.DB, runID string) ([]Job, error) {
+	args := []interface{}{runID, StatusPending, StatusRunning, StatusFailed, StatusTimedOut, StatusFailed}
+	placeholders := make([]string, 0, len(retry.PermanentClasses))
+	for _, class := range retry.PermanentClasses {
+		placeholders = append(placeholders, "?")
+		args = append(args, class)
+	}
+	return query(db, fmt.Sprintf(`WHERE run_id = ? AND status IN (?, ?, ?, ?)
+		AND NOT (status = ? AND COALESCE(error_class, '') IN (%s)) ORDER BY id`, strings.Join(placeholders, ", ")), args...)
+}
+
+// ForRun returns all jobs of a run
+func ForRun(db *sql.DB, runID string) ([]Job, error) {
+	return query(db, "WHERE run_id = ? ORDER BY id", runID)
+}
+
+// LatestSucceeded returns the most recent succeeded job for a repository at a ref, or nil if there is none.
+// Jobs recorded before refs were tracked match any ref.
+func LatestSucceeded(db *sql.DB, repoURL, ref string) (*Job, error) {
+	found, err := query(db, "WHERE repo_url = ? AND status = ? AND (ref = ? OR ref IS NULL) ORDER BY id DESC LIMIT 1",
+		repoURL, StatusSucceeded, ref)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return &found[0], nil
+}
+
+// PermanentFailure returns the most recent job of a repository outside the given run if it failed
+// with a permanent error class, or nil if it did not. Skipped jobs are passed over, so a repository
+// stays skipped until a job of it succeeds or fails with another class.
+func PermanentFailure(db *sql.DB, repoURL, runID string) (*Job, error) {
+	found, err := query(db, "WHERE repo_url = ? AND run_id != ? AND status IN (?, ?, ?) ORDER BY id DESC LIMIT 1",
+		repoURL, runID, StatusSucceeded, StatusFailed, StatusTimedOut)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) == 0 || found[0].Status != StatusFailed || !found[0].ErrorClass.Permanent() {
+		return nil, nil
+	}
+	return &found[0], nil
+}
+
+// OutputOwner returns the repository URL of the most recent succeeded or skipped job that
+// recorded the output path, or an empty string if no job did
+func OutputOwner(db *sql.DB, outputPath string) (string, error) {
+	var repoURL string
+	err := db.QueryRow("SELECT repo_url FROM sbom_outputs WHERE path = ?", outputPath).Scan(&repoURL)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to find the job that wrote %s: %w", outputPath, err)
+	}
+	return repoURL, nil
+}
+
+// recordOutputs records a job as the last writer of its output paths
+func recordOutputs(tx *sql.Tx, id int64, outputPaths []string) error {
+	for _, outputPath := range outputPaths {
+		_, err := tx.Exec("INSERT OR REPLACE INTO sbom_outputs (path, job_id, repo_url) SELECT ?, id, repo_url FROM sbom_jobs WHERE id = ?",
+			outputPath, id)
+		if err != nil {
+			return fmt.Errorf("failed to record output %s of job %d: %w", outputPath, id, err)
+		}
+	}
+	return nil
+}
+
+// Start marks a job as running and increments its attempt count
+func Start(db *sql.DB, id int64) error {
+	_, err := db.Exec("UPDATE sbom_jobs SET status = ?, attempts = attempts + 1, error = NULL, error_class = NULL, updated_at = ? WHERE id = ?",
+		StatusRunning, now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to start job %d: %w", id, err)
+	}
+	return nil
+}
+
+// Succeed marks a job as succeeded
+func Succeed(db *sql.DB, id int64, result Result) error {
+	err := withOutputs(db, id, result.OutputPaths, func(tx *sql.Tx) error {
+		_, err := tx.Exec(`UPDATE sbom_jobs SET status = ?, error = NULL, error_class = NULL, duration_ms = ?, commit_sha = ?, ref = ?,
+			output_path = ?, generator = ?, generator_version = ?, updated_at = ? WHERE id = ?`,
+			StatusSucceeded, result.Duration.Milliseconds(), result.CommitSHA, result.Ref, encodePaths(result.OutputPaths),
+			result.Generator, result.GeneratorVersion, now(), id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to complete job %d: %w", id, err)
+	}
+	return nil
+}
+
+// Skip marks a job as skipped because its SBOM is already up to date
+func Skip(db *sql.DB, id int64, commitSHA, ref string, outputPaths []string, reason string) error {
+	err := withOutputs(db, id, outputPaths, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE sbom_jobs SET status = ?, error = ?, commit_sha = ?, ref = ?, output_path = ?, updated_at = ? WHERE id = ?",
+			StatusSkipped, reason, commitSHA, ref, encodePaths(outputPaths), now(), id)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to skip job %d: %w", id, err)
+	}
+	return nil
+}
+
+// withOutputs runs update and records the job as the writer of its output paths in one transaction
+func withOutputs(db *sql.DB, id int64, outputPaths []string, update func(tx *sql.Tx) error) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() //nolint:errcheck // Rollback after Commit is a no-op
+	if err := update(tx); err != nil {
+		return err
+	}
+	if err := recordOutputs(tx, id, outputPaths); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Interrupt marks a job as pending again because its run was interrupted while it was being processed
+func Interrupt(db *sql.DB, id int64) error {
+	_, err := db.Exec("UPDATE sbom_jobs SET status = ?, error = ?, error_class = NULL, updated_at = ? WHERE id = ?",
+		StatusPending, "interrupted", now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to record interrupted job %d: %w", id, err)
+	}
+	return nil
+}
+
+// Fail marks a job as failed with the given error, recording its class so that
+// permanent failures are not retried by later runs
+func Fail(db *sql.DB, id int64, duration time.Duration, jobErr error) error {
+	return finish(db, id, StatusFailed, duration, jobErr)
+}
+
+// TimeOut marks a job as timed out so it can be retried with a larger time budget
+func TimeOut(db *sql.DB, id int64, duration time.Duration, jobErr error) error {
+	return finish(db, id, StatusTimedOut, duration, jobErr)
+}
+
+func finish(db *sql.DB, id int64, status Status, duration time.Duration, jobErr error) error {
+	_, err := db.Exec("UPDATE sbom_jobs SET status = ?, error = ?, error_class = ?, duration_ms = ?, updated_at = ? WHERE id = ?",
+		status, jobErr.Error(), retry.ClassOf(jobErr), duration.Milliseconds(), now(), id)
+	if err != nil {
+		return fmt.Errorf("failed to record %s job %d: %w", status, id, err)
+	}
+	return nil
+}
+
+// encodePaths stores the output paths of a job in the output_path column as a JSON array,
+// so paths may contain any character
+func encodePaths(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(paths) // Encoding strings cannot fail
+	return string(data)
+}
+
+// decodePaths reads the output_path column. Earlier versions stored a single path, which is
+// returned as is.
+func decodePaths(value string) []string {
+	if value == "" {
+		return nil
+	}
+	var paths []string
+	if strings.HasPrefix(value, "[") && json.Unmarshal([]byte(value), &paths) == nil {
+		return paths
+	}
+	return []string{value}
+}
+
+func query(db *sql.DB, where string, args ...interface{}) ([]Job, error) {
+	selected := []string{"id", "run_id", "command", "repo_url", "status", "attempts", "error", "error_class", "duration_ms", "commit_sha", "ref", "output_path",
+		"generator", "generator_version", "created_at", "updated_at"}
+	rows, err := db.Query(fmt.Sprintf("SELECT %s FROM sbom_jobs %s", strings.Join(selected, ", "), where), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var job Job
+		var command, jobErr, errorClass, commitSHA, ref, outputPath, generator, genVersion, createdAt, updatedAt sql.NullString
+		var durationMS sql.NullInt64
+		if err := rows.Scan(&job.ID, &job.RunID, &command, &job.RepoURL, &job.Status, &job.Attempts,
+			&jobErr, &errorClass, &durationMS, &commitSHA, &ref, &outputPath, &generator, &genVersion, &createdAt, &updatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		job.Command = command.String
+		if !command.Valid {
+			job.Command = CommandDownloadSBOM
+		}
+		job.Error = jobErr.String
+		job.ErrorClass = retry.Class(errorClass.String)
+		job.Duration = time.Duration(durationMS.Int64) * time.Millisecond
+		job.CommitSHA = commitSHA.String
+		job.Ref = ref.String
+		job.OutputPaths = decodePaths(outputPath.String)
+		job.Generator = generator.String
+		job.GeneratorVersion = genVersion.String
+		job.CreatedAt = createdAt.String
+		job.UpdatedAt = updatedAt.String
+		jobs = append(jobs, job)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read jobs: %w", err)
+	}
+
+	return jobs, nil
+}
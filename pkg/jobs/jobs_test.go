@@ -0,0 +1,311 @@
+package jobs
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func TestOutputOwner(t *testing.T) {
+	db := openTestDB(t)
+	if err := CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+	queued, err := Enqueue(db, NewRunID(), CommandDownloadSBOM, []string{"https://github.com/org/a", "https://github.com/org/b", "https://github.com/org/c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Succeed(db, queued[0].ID, Result{OutputPaths: []string{"sbom/org_a.cdx.json", "sbom/org_a.spdx.json"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Skip(db, queued[1].ID, "", "", []string{"sbom/org_b.cdx.json"}, "up to date"); err != nil {
+		t.Fatal(err)
+	}
+	// A later job writing the same file becomes its owner
+	if err := Succeed(db, queued[2].ID, Result{OutputPaths: []string{"sbom/org_a.spdx.json"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"sbom/org_a.cdx.json", "https://github.com/org/a"},
+		{"sbom/org_a.spdx.json", "https://github.com/org/c"},
+		{"sbom/org_b.cdx.json", "https://github.com/org/b"},
+		// Paths are matched exactly, not as substrings of recorded paths
+		{"org_a.cdx.json", ""},
+		{"sbom/org_a", ""},
+		{"sbom/org_c.cdx.json", ""},
+	}
+	for _, test := range tests {
+		got, err := OutputOwner(db, test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("OutputOwner(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+// Databases of earlier versions only recorded the output paths of jobs in sbom_jobs
+func TestCreateTableRecordsEarlierOutputs(t *testing.T) {
+	db := openTestDB(t)
+	_, err := db.Exec(`
+	CREATE TABLE sbom_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id TEXT NOT NULL,
+		repo_url TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		duration_ms INTEGER,
+		commit_sha TEXT,
+		output_path TEXT,
+		created_at TEXT,
+		updated_at TEXT
+	);
+	INSERT INTO sbom_jobs (run_id, repo_url, status, output_path) VALUES
+		('1', 'https://github.com/org/a', 'succeeded', 'sbom/org_a.sbom.json'),
+		('1', 'https://github.com/org/b', 'failed', 'sbom/org_b.sbom.json'),
+		('2', 'https://github.com/org/c', 'succeeded', '["sbom/org_c.sbom.json","sbom/org_a.sbom.json"]'),
+		('2', 'https://github.com/org/d', 'skipped', 'sbom/org_d.sbom.json');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+
+	for path, want := range map[string]string{
+		"sbom/org_a.sbom.json": "https://github.com/org/c",
+		"sbom/org_b.sbom.json": "",
+		"sbom/org_c.sbom.json": "https://github.com/org/c",
+		"sbom/org_d.sbom.json": "https://github.com/org/d",
+	} {
+		got, err := OutputOwner(db, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("OutputOwner(%q) = %q, want %q", path, got, want)
+		}
+	}
+
+	// Creating the table again does not record the outputs twice
+	if err := CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM sbom_outputs").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 {
+		t.Errorf("sbom_outputs has %d rows, want 3", count)
+	}
+}
+
+func TestOutputPaths(t *testing.T) {
+	db := openTestDB(t)
+	if err := CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+	tests := [][]string{
+		nil,
+		{"sbom/org_a.cdx.json"},
+		// Paths may contain the list separator of any platform
+		{"C:\\sbom\\org_a.cdx.json", "sbom/org:a;b.cdx.json", "sbom/[org].cdx.json"},
+	}
+	for _, paths := range tests {
+		queued, err := Enqueue(db, NewRunID(), CommandDownloadSBOM, []string{"https://github.com/org/a", "https://github.com/org/b"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := Succeed(db, queued[0].ID, Result{OutputPaths: paths}); err != nil {
+			t.Fatal(err)
+		}
+		if err := Skip(db, queued[1].ID, "", "", paths, "up to date"); err != nil {
+			t.Fatal(err)
+		}
+		recorded, err := ForRun(db, queued[0].RunID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, job := range recorded {
+			if !reflect.DeepEqual(job.OutputPaths, paths) {
+				t.Errorf("%s job recorded output paths %q, want %q", job.Status, job.OutputPaths, paths)
+			}
+		}
+	}
+}
+
+func TestDecodePaths(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"", nil},
+		{`["sbom/org_a.cdx.json","sbom/org:a.spdx.json"]`, []string{"sbom/org_a.cdx.json", "sbom/org:a.spdx.json"}},
+		// Values written by earlier versions
+		{"sbom/org_a.sbom.json", []string{"sbom/org_a.sbom.json"}},
+		{"[org]/a.sbom.json", []string{"[org]/a.sbom.json"}},
+	}
+	for _, test := range tests {
+		if got := decodePaths(test.value); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("decodePaths(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestPermanentFailure(t *testing.T) {
+	const (
+		missing   = "https://github.com/org/missing"
+		flaky     = "https://github.com/org/flaky"
+		recovered = "https://github.com/org/recovered"
+	)
+	db := openTestDB(t)
+	if err := CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+	first, err := Enqueue(db, "first", CommandDownloadSBOM, []string{missing, flaky, recovered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fail := func(job Job, class retry.Class) {
+		t.Helper()
+		if err := Fail(db, job.ID, 0, retry.Classify(class, errors.New(string(class)))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fail(first[0], retry.ClassNotFound)
+	fail(first[1], retry.ClassTransient)
+	fail(first[2], retry.ClassAuth)
+
+	second, err := Enqueue(db, "second", CommandDownloadSBOM, []string{missing, recovered})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Skipping a repository because it failed before does not clear the failure
+	if err := Skip(db, second[0].ID, "", "", nil, "failed before"); err != nil {
+		t.Fatal(err)
+	}
+	if err := Succeed(db, second[1].ID, Result{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		repoURL string
+		runID   string
+		wantRun string
+	}{
+		{missing, "third", "first"},
+		// Jobs of the run itself are not earlier failures
+		{missing, "first", ""},
+		{flaky, "third", ""},
+		{recovered, "third", ""},
+		{recovered, "second", "first"},
+		{"https://github.com/org/unknown", "third", ""},
+	}
+	for _, test := range tests {
+		got, err := PermanentFailure(db, test.repoURL, test.runID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch {
+		case test.wantRun == "" && got != nil:
+			t.Errorf("PermanentFailure(%s, %s) = job %d of run %s, want none", test.repoURL, test.runID, got.ID, got.RunID)
+		case test.wantRun != "" && (got == nil || got.RunID != test.wantRun):
+			t.Errorf("PermanentFailure(%s, %s) = %+v, want the job of run %s", test.repoURL, test.runID, got, test.wantRun)
+		}
+	}
+}
+
+func TestLatestRunIDByCommand(t *testing.T) {
+	db := openTestDB(t)
+	// Jobs of earlier versions have no command and were recorded by download-sbom
+	if _, err := db.Exec(`CREATE TABLE sbom_jobs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		run_id TEXT NOT NULL,
+		repo_url TEXT NOT NULL,
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT,
+		duration_ms INTEGER,
+		commit_sha TEXT,
+		output_path TEXT,
+		created_at TEXT,
+		updated_at TEXT
+	);
+	INSERT INTO sbom_jobs (run_id, repo_url, status) VALUES ('old', 'https://github.com/org/a', 'pending')`); err != nil {
+		t.Fatal(err)
+	}
+	if err := CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LatestRunID(db, CommandScanLocal); err == nil {
+		t.Error("found a scan-local run before any was recorded")
+	}
+	checkLatest := func(command, want string) {
+		t.Helper()
+		got, err := LatestRunID(db, command)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("LatestRunID(%s) = %s, want %s", command, got, want)
+		}
+	}
+	checkLatest(CommandDownloadSBOM, "old")
+
+	download, err := Enqueue(db, "download", CommandDownloadSBOM, []string{"https://github.com/org/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Enqueue(db, "local", CommandScanLocal, []string{"https://github.com/org/b"}); err != nil {
+		t.Fatal(err)
+	}
+	// Releases of a job belong to the same command
+	if _, err := Expand(db, download[0], []string{"v1", "v2"}); err != nil {
+		t.Fatal(err)
+	}
+	checkLatest(CommandDownloadSBOM, "download")
+	checkLatest(CommandScanLocal, "local")
+
+	resumable, err := Resumable(db, "download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumable) != 2 {
+		t.Fatalf("run has %d resumable jobs, want 2", len(resumable))
+	}
+	for _, job := range resumable {
+		if job.Command != CommandDownloadSBOM {
+			t.Errorf("job %d of %s has command %q", job.ID, job.Ref, job.Command)
+		}
+	}
+	old, err := Resumable(db, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(old) != 1 || old[0].Command != CommandDownloadSBOM {
+		t.Errorf("job of an earlier version read as %+v", old)
+	}
+}
@@ -0,0 +1,191 @@
+// Package layout maps the SBOMs of repositories to file paths below the output directory.
+package layout
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// Fields are the values a layout is expanded with.
+type Fields struct {
+	RepoURL    string      // URL of the repository
+	Ref        string      // Branch, tag or commit the SBOM was generated for
+	DefaultRef bool        // Ref is the default branch, omitted by {@ref}
+	Format     sbom.Format // Format of the SBOM file
+	Extension  string      // File extension including the dot, the extension of Format if empty
+}
+
+// Layout is a template of the SBOM paths, e.g. {host}/{owner}/{repo}/{ref}.{format}.
+type Layout struct {
+	template string
+	history  string              // Template of the SBOMs of past releases
+	escape   func(string) string // Escapes values, Escape if nil
+}
+
+// Named lists the built-in layouts by name.
+var Named = map[string]*Layout{
+	// Every SBOM in one directory
+	"flat": {template: "{owner}_{repo}{@ref}.{format}", history: "{owner}_{repo}/{ref}.{format}"},
+	// The flat layout with the names of earlier versions, which keep "_" and "@" and may collide
+	"legacy": {template: "{owner}_{repo}{@ref}.{format}", history: "{owner}_{repo}/{ref}.{format}", escape: url.PathEscape},
+	// One directory per host, owner and repository
+	"nested": {template: "{host}/{owner}/{repo}/{ref}.{format}", history: "{host}/{owner}/{repo}/{ref}.{format}"},
+	// The flat layout spread over 256 directories by a hash of the repository URL
+	"sharded": {template: "{shard}/{owner}_{repo}{@ref}.{format}", history: "{shard}/{owner}_{repo}/{ref}.{format}"},
+}
+
+// DefaultName is the name of the layout used when none is selected.
+const DefaultName = "flat"
+
+// Default is the layout used when none is selected.
+var Default = Named[DefaultName]
+
+var placeholderRegexp = regexp.MustCompile(`\{[^{}]*\}`)
+
+var placeholders = map[string]bool{
+	"{host}": true, "{owner}": true, "{repo}": true, "{path}": true, "{ref}": true, "{@ref}": true, "{shard}": true, "{format}": true,
+}
+
+// Parse returns the layout with the given name, or a layout using spec as its template.
+// Templates must contain {format} and identify the repository with {repo} or {path}.
+func Parse(spec string) (*Layout, error) {
+	if named, ok := Named[spec]; ok {
+		return named, nil
+	}
+	if !strings.Contains(spec, "{") {
+		return nil, fmt.Errorf("unknown layout %q (available: %s, or a template)", spec, strings.Join(Names(), ", "))
+	}
+
+	for _, placeholder := range placeholderRegexp.FindAllString(spec, -1) {
+		if !placeholders[placeholder] {
+			return nil, fmt.Errorf("unknown placeholder %s in layout %q", placeholder, spec)
+		}
+	}
+	if strings.ContainsAny(placeholderRegexp.ReplaceAllString(spec, ""), "{}\\") {
+		return nil, fmt.Errorf("invalid layout %q: unbalanced braces or backslash", spec)
+	}
+	if !strings.Contains(spec, "{format}") {
+		return nil, fmt.Errorf("layout %q does not contain {format}", spec)
+	}
+	if !strings.Contains(spec, "{repo}") && !strings.Contains(spec, "{path}") {
+		return nil, fmt.Errorf("layout %q does not contain {repo} or {path}", spec)
+	}
+	if strings.HasPrefix(spec, "/") {
+		return nil, fmt.Errorf("layout %q must be relative to the SBOM directory", spec)
+	}
+	for _, segment := range strings.Split(spec, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return nil, fmt.Errorf("layout %q contains an empty, . or .. path segment", spec)
+		}
+	}
+	return &Layout{template: spec, history: spec}, nil
+}
+
+// Names returns the names of the built-in layouts.
+func Names() []string {
+	names := make([]string, 0, len(Named))
+	for name := range Named {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// String returns the template of the layout.
+func (l *Layout) String() string {
+	return l.template
+}
+
+// HasRef reports whether the layout names SBOMs after their ref, so SBOMs of several releases
+// of a repository do not replace each other.
+func (l *Layout) HasRef() bool {
+	return strings.Contains(l.history, "{ref}") || strings.Contains(l.history, "{@ref}")
+}
+
+// Path returns the slash-separated path of an SBOM relative to the output directory.
+func (l *Layout) Path(fields Fields) (string, error) {
+	return l.expand(l.template, fields)
+}
+
+// HistoryPath returns the slash-separated path of the SBOM of a past release relative to the output directory.
+func (l *Layout) HistoryPath(fields Fields) (string, error) {
+	return l.expand(l.history, fields)
+}
+
+func (l *Layout) expand(template string, fields Fields) (string, error) {
+	escape := l.escape
+	if escape == nil {
+		escape = Escape
+	}
+	parsedURL, err := url.Parse(fields.RepoURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse URL %s: %w", fields.RepoURL, err)
+	}
+	segments := strings.Split(strings.Trim(parsedURL.Path, "/"), "/")
+	if len(segments) < 2 {
+		return "", fmt.Errorf("invalid repository URL format: %s", fields.RepoURL)
+	}
+	if fields.Ref == "" && (strings.Contains(template, "{ref}") || !fields.DefaultRef && strings.Contains(template, "{@ref}")) {
+		return "", fmt.Errorf("no ref to name the SBOM of %s after", fields.RepoURL)
+	}
+
+	escaped := make([]string, 0, len(segments))
+	for _, segment := range segments {
+		escaped = append(escaped, escape(segment))
+	}
+	host := parsedURL.Host
+	if host == "" {
+		host = parsedURL.Scheme
+	}
+	atRef := ""
+	if !fields.DefaultRef {
+		atRef = "@" + escape(fields.Ref)
+	}
+	shard := sha256.Sum256([]byte(strings.ToLower(fields.RepoURL)))
+	extension := fields.Extension
+	if extension == "" {
+		extension = fields.Format.Extension()
+	}
+
+	replacer := strings.NewReplacer(
+		"{host}", escape(strings.ToLower(host)),
+		// Owners are everything before the repository name, including the subgroups of GitLab
+		"{owner}", escape(strings.Join(segments[:len(segments)-1], "/")),
+		"{repo}", escaped[len(escaped)-1],
+		"{path}", strings.Join(escaped, "/"),
+		"{ref}", escape(fields.Ref),
+		"{@ref}", atRef,
+		"{shard}", hex.EncodeToString(shard[:1]),
+		"{format}", strings.TrimPrefix(extension, "."),
+	)
+	return path.Clean(replacer.Replace(template)), nil
+}
+
+// Escape encodes a value for use in a file name. Only letters, digits and "-", ".", "+" and "~"
+// are kept, every other byte is percent-encoded, including the "_", "@" and "/" separating values
+// in layouts and a leading "." that would hide the file. Distinct values therefore never produce
+// the same name, and names never contain separators of their own. The legacy layout escapes with
+// url.PathEscape instead, which keeps "_" and "@", so that SBOMs keep the names of earlier versions.
+func Escape(value string) string {
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '+', c == '~':
+			escaped.WriteByte(c)
+		case c == '.' && i > 0:
+			escaped.WriteByte(c)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", c)
+		}
+	}
+	return escaped.String()
+}
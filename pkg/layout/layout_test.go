@@ -0,0 +1,222 @@
+package layout
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+func TestPath(t *testing.T) {
+	tests := []struct {
+		name    string
+		layout  string
+		fields  Fields
+		want    string
+		history string
+	}{
+		{
+			name:    "flat default branch",
+			layout:  "flat",
+			fields:  Fields{RepoURL: "https://github.com/org/repo", Ref: "main", DefaultRef: true},
+			want:    "org_repo.cdx.json",
+			history: "org_repo/main.cdx.json",
+		},
+		{
+			name:    "flat escapes separators",
+			layout:  "flat",
+			fields:  Fields{RepoURL: "https://github.com/my_org/.dotfiles", Ref: "release/v1.2.3"},
+			want:    "my%5Forg_%2Edotfiles@release%2Fv1.2.3.cdx.json",
+			history: "my%5Forg_%2Edotfiles/release%2Fv1.2.3.cdx.json",
+		},
+		{
+			name:   "flat subgroup",
+			layout: "flat",
+			fields: Fields{RepoURL: "https://gitlab.com/group/sub/project", Ref: "main", DefaultRef: true},
+			want:   "group%2Fsub_project.cdx.json",
+		},
+		{
+			name:    "legacy keeps the names of earlier versions",
+			layout:  "legacy",
+			fields:  Fields{RepoURL: "https://github.com/my_org/.dotfiles", Ref: "release/v1.2.3"},
+			want:    "my_org_.dotfiles@release%2Fv1.2.3.cdx.json",
+			history: "my_org_.dotfiles/release%2Fv1.2.3.cdx.json",
+		},
+		{
+			name:    "nested",
+			layout:  "nested",
+			fields:  Fields{RepoURL: "https://GitHub.com/org/repo", Ref: "v1.0.0"},
+			want:    "github.com/org/repo/v1.0.0.cdx.json",
+			history: "github.com/org/repo/v1.0.0.cdx.json",
+		},
+		{
+			name:   "nested escapes separators",
+			layout: "nested",
+			fields: Fields{RepoURL: "https://gitlab.com/group/sub/my_project", Ref: "feature/x"},
+			want:   "gitlab.com/group%2Fsub/my%5Fproject/feature%2Fx.cdx.json",
+		},
+		{
+			name:   "sharded",
+			layout: "sharded",
+			fields: Fields{RepoURL: "https://github.com/org/repo", Ref: "main", DefaultRef: true},
+			want:   "bd/org_repo.cdx.json",
+		},
+		{
+			name:   "template with path",
+			layout: "{host}/{path}{@ref}.{format}",
+			fields: Fields{RepoURL: "https://gitlab.com/group/sub/project", Ref: "v2", Format: sbom.FormatSPDXJSON},
+			want:   "gitlab.com/group/sub/project@v2.spdx.json",
+		},
+		{
+			name:   "template hides no files",
+			layout: "{repo}.{format}",
+			fields: Fields{RepoURL: "https://github.com/org/.github", Ref: "main", DefaultRef: true},
+			want:   "%2Egithub.cdx.json",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout, err := Parse(test.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if test.fields.Format == "" {
+				test.fields.Format = sbom.DefaultFormat
+			}
+			got, err := layout.Path(test.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("Path() = %q, want %q", got, test.want)
+			}
+			if test.history == "" {
+				return
+			}
+			got, err = layout.HistoryPath(test.fields)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.history {
+				t.Errorf("HistoryPath() = %q, want %q", got, test.history)
+			}
+		})
+	}
+}
+
+func TestPathErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout string
+		fields Fields
+	}{
+		{"repository without owner", "flat", Fields{RepoURL: "https://github.com/repo", DefaultRef: true}},
+		{"unparsable URL", "flat", Fields{RepoURL: "https://github.com/%zz/repo", DefaultRef: true}},
+		{"no ref for {ref}", "nested", Fields{RepoURL: "https://github.com/org/repo", DefaultRef: true}},
+		{"no ref for {@ref}", "flat", Fields{RepoURL: "https://github.com/org/repo"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			layout, err := Parse(test.layout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			test.fields.Format = sbom.DefaultFormat
+			if got, err := layout.Path(test.fields); err == nil {
+				t.Errorf("Path() = %q, want an error", got)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		wantErr string
+	}{
+		{spec: "flat"},
+		{spec: "{owner}/{repo}/{ref}.{format}"},
+		{spec: "{path}.{format}"},
+		{spec: "tree", wantErr: "unknown layout"},
+		{spec: "{org}/{repo}.{format}", wantErr: "unknown placeholder {org}"},
+		{spec: "{repo}}.{format}", wantErr: "unbalanced braces"},
+		{spec: "{repo}", wantErr: "does not contain {format}"},
+		{spec: "{owner}.{format}", wantErr: "does not contain {repo} or {path}"},
+		{spec: "/sbom/{repo}.{format}", wantErr: "must be relative"},
+		{spec: "../{repo}.{format}", wantErr: "empty, . or .. path segment"},
+		{spec: "{owner}//{repo}.{format}", wantErr: "empty, . or .. path segment"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.spec)
+		switch {
+		case test.wantErr == "" && err != nil:
+			t.Errorf("Parse(%q) failed: %v", test.spec, err)
+		case test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)):
+			t.Errorf("Parse(%q) = %v, want an error containing %q", test.spec, err, test.wantErr)
+		}
+	}
+}
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"repo", "repo"},
+		{"Repo-1.2+3~x", "Repo-1.2+3~x"},
+		{"a_b", "a%5Fb"},
+		{"feature/x", "feature%2Fx"},
+		{"v1@2", "v1%402"},
+		{".github", "%2Egithub"},
+		{"100%", "100%25"},
+		{"ü", "%C3%BC"},
+	}
+	for _, test := range tests {
+		if got := Escape(test.value); got != test.want {
+			t.Errorf("Escape(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+// Repositories whose names differ only in where "_" and "@" appear get distinct names
+func TestEscapeKeepsRepositoriesApart(t *testing.T) {
+	pairs := [][2]string{
+		{"https://github.com/a_b/c", "https://github.com/a/b_c"},
+		{"https://gitlab.com/a/b/c", "https://gitlab.com/a_b/c"},
+		{"https://github.com/org/repo@v1", "https://github.com/org/repo"},
+	}
+	layouts := map[string]*Layout{"default": Default, "sharded": Named["sharded"]}
+	template, err := Parse("{owner}_{repo}{@ref}.{format}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	layouts["template"] = template
+	for name, layout := range layouts {
+		for _, pair := range pairs {
+			paths := make([]string, 2)
+			for i, repoURL := range pair {
+				if paths[i], err = layout.Path(Fields{RepoURL: repoURL, Ref: "v1", Format: sbom.DefaultFormat}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if paths[0] == paths[1] {
+				t.Errorf("%s layout names %s and %s alike: %s", name, pair[0], pair[1], paths[0])
+			}
+		}
+	}
+
+	// legacy keeps the names of earlier versions, which collide
+	fields := Fields{RepoURL: pairs[0][0], DefaultRef: true, Format: sbom.DefaultFormat}
+	a, err := Named["legacy"].Path(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields.RepoURL = pairs[0][1]
+	b, err := Named["legacy"].Path(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a != "a_b_c.cdx.json" || b != a {
+		t.Errorf("legacy names %s and %s, earlier versions named both a_b_c.cdx.json", a, b)
+	}
+}
@@ -0,0 +1,179 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// Manifest describes the outcome of an SBOM generation run
+type Manifest struct {
+	RunID            string       `json:"run_id"`
+	StartedAt        time.Time    `json:"started_at"`
+	FinishedAt       time.Time    `json:"finished_at"`
+	DurationMS       int64        `json:"duration_ms"`
+	Generator        string       `json:"generator"`
+	GeneratorVersion string       `json:"generator_version"`
+	Totals           Totals       `json:"totals"`
+	Repositories     []Repository `json:"repositories"`
+}
+
+// Totals counts the repositories of a run by status
+type Totals struct {
+	Repositories int `json:"repositories"`
+	Succeeded    int `json:"succeeded"`
+	Skipped      int `json:"skipped"`
+	Failed       int `json:"failed"`
+	TimedOut     int `json:"timed_out"`
+	Pending      int `json:"pending"`
+}
+
+// Repository is the outcome for a single repository of a run
+type Repository struct {
+	RepoURL          string      `json:"repo_url"`
+	Status           jobs.Status `json:"status"`
+	Error            string      `json:"error,omitempty"`
+	ErrorClass       string      `json:"error_class,omitempty"`
+	Attempts         int         `json:"attempts"`
+	DurationMS       int64       `json:"duration_ms"`
+	CommitSHA        string      `json:"commit_sha,omitempty"`
+	Ref              string      `json:"ref,omitempty"`
+	Generator        string      `json:"generator,omitempty"`
+	GeneratorVersion string      `json:"generator_version,omitempty"`
+	Files            []File      `json:"files,omitempty"`
+}
+
+// File is an SBOM file written for a repository
+type File struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size"`
+	SHA256     string `json:"sha256"`
+	Components *int   `json:"components,omitempty"` // Omitted if the SBOM could not be parsed
+	Error      string `json:"error,omitempty"`      // Set if the file could not be read
+}
+
+// Build creates the manifest of a run from its jobs, inspecting every SBOM file that was written
+func Build(runID string, runJobs []jobs.Job, startedAt, finishedAt time.Time) *Manifest {
+	manifest := &Manifest{
+		RunID:        runID,
+		StartedAt:    startedAt.UTC(),
+		FinishedAt:   finishedAt.UTC(),
+		DurationMS:   finishedAt.Sub(startedAt).Milliseconds(),
+		Repositories: make([]Repository, 0, len(runJobs)),
+	}
+
+	for _, job := range runJobs {
+		repository := Repository{
+			RepoURL:          job.RepoURL,
+			Status:           job.Status,
+			Error:            job.Error,
+			ErrorClass:       string(job.ErrorClass),
+			Attempts:         job.Attempts,
+			DurationMS:       job.Duration.Milliseconds(),
+			CommitSHA:        job.CommitSHA,
+			Ref:              job.Ref,
+			Generator:        job.Generator,
+			GeneratorVersion: job.GeneratorVersion,
+		}
+		if job.Status == jobs.StatusSucceeded || job.Status == jobs.StatusSkipped {
+			for _, path := range job.OutputPaths {
+				repository.Files = append(repository.Files, inspect(path))
+			}
+		}
+		if job.Generator != "" && manifest.Generator == "" {
+			manifest.Generator = job.Generator
+			manifest.GeneratorVersion = job.GeneratorVersion
+		}
+		manifest.Totals.add(job.Status)
+		manifest.Repositories = append(manifest.Repositories, repository)
+	}
+
+	return manifest
+}
+
+func (t *Totals) add(status jobs.Status) {
+	t.Repositories++
+	switch status {
+	case jobs.StatusSucceeded:
+		t.Succeeded++
+	case jobs.StatusSkipped:
+		t.Skipped++
+	case jobs.StatusFailed:
+		t.Failed++
+	case jobs.StatusTimedOut:
+		t.TimedOut++
+	default:
+		t.Pending++
+	}
+}
+
+// inspect returns the size, checksum and component count of an SBOM file
+func inspect(path string) File {
+	file := File{Path: path}
+
+	f, err := os.Open(path)
+	if err != nil {
+		file.Error = err.Error()
+		return file
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		file.Error = err.Error()
+		return file
+	}
+	file.Size = size
+	file.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	if components, err := sbom.CountComponents(path); err == nil {
+		file.Components = &components
+	}
+	return file
+}
+
+// FileName returns the name of the manifest of a run written to the SBOM directory
+func FileName(runID string) string {
+	return "manifest-" + runID + ".json"
+}
+
+// fileNamePattern matches the names FileName gives manifests, with run IDs from jobs.NewRunID
+var fileNamePattern = regexp.MustCompile(`^manifest-\d{8}T\d{6}\.\d{3}Z\.json$`)
+
+// IsManifest reports whether a file has the name of a run manifest, so that readers of the
+// SBOM directory can skip it. SBOMs of owners named like manifest-foo are not manifests.
+func IsManifest(path string) bool {
+	return fileNamePattern.MatchString(filepath.Base(path))
+}
+
+// Write saves the manifest as indented JSON, creating the parent directory if needed
+func (m *Manifest) Write(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil { //nolint:gosec // the manifest is not secret
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	return nil
+}
+
+// Summary returns a one-line description of the totals
+func (t Totals) Summary() string {
+	return fmt.Sprintf("%d repositories: %d succeeded, %d skipped, %d failed, %d timed out, %d pending",
+		t.Repositories, t.Succeeded, t.Skipped, t.Failed, t.TimedOut, t.Pending)
+}
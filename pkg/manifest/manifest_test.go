@@ -0,0 +1,156 @@
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+const cycloneDXJSON = `{"bomFormat": "CycloneDX", "specVersion": "1.5", "version": 1,
+"metadata": {"component": {"type": "application", "bom-ref": "source", "name": "github.com/org/a"}}, "components": [
+	{"type": "library", "bom-ref": "a", "name": "a", "version": "1.0.0", "purl": "pkg:golang/example.com/a@1.0.0"},
+	{"type": "library", "bom-ref": "b", "name": "b", "version": "2.0.0", "purl": "pkg:golang/example.com/b@2.0.0"}
+]}`
+
+func TestBuild(t *testing.T) {
+	dir := t.TempDir()
+	sbomPath := filepath.Join(dir, "org_a.cdx.json")
+	if err := os.WriteFile(sbomPath, []byte(cycloneDXJSON), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	invalidPath := filepath.Join(dir, "org_b.cdx.json")
+	if err := os.WriteFile(invalidPath, []byte("not an SBOM"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	missingPath := filepath.Join(dir, "org_c.cdx.json")
+
+	startedAt := time.Date(2024, 1, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	finishedAt := startedAt.Add(90 * time.Second)
+	runJobs := []jobs.Job{
+		{RepoURL: "https://github.com/org/a", Status: jobs.StatusSucceeded, Attempts: 1, Duration: 2 * time.Second,
+			CommitSHA: "abc", Ref: "main", OutputPaths: []string{sbomPath, invalidPath}, Generator: "syft", GeneratorVersion: "1.0.0"},
+		{RepoURL: "https://github.com/org/c", Status: jobs.StatusSkipped, OutputPaths: []string{missingPath}},
+		{RepoURL: "https://github.com/org/d", Status: jobs.StatusFailed, Attempts: 3, Error: "clone failed",
+			ErrorClass: retry.ClassTransient, OutputPaths: []string{sbomPath}},
+		{RepoURL: "https://github.com/org/e", Status: jobs.StatusTimedOut},
+		{RepoURL: "https://github.com/org/f", Status: jobs.StatusPending},
+		{RepoURL: "https://github.com/org/g", Status: jobs.StatusRunning},
+	}
+
+	manifest := Build("20240101T110000.000Z", runJobs, startedAt, finishedAt)
+
+	if manifest.StartedAt.Location() != time.UTC || !manifest.StartedAt.Equal(startedAt) || manifest.DurationMS != 90000 {
+		t.Errorf("manifest runs from %s for %d ms, want %s in UTC for 90000 ms", manifest.StartedAt, manifest.DurationMS, startedAt)
+	}
+	if manifest.Generator != "syft" || manifest.GeneratorVersion != "1.0.0" {
+		t.Errorf("manifest generator is %s %s, want syft 1.0.0", manifest.Generator, manifest.GeneratorVersion)
+	}
+	wantTotals := Totals{Repositories: 6, Succeeded: 1, Skipped: 1, Failed: 1, TimedOut: 1, Pending: 2}
+	if manifest.Totals != wantTotals {
+		t.Errorf("totals are %+v, want %+v", manifest.Totals, wantTotals)
+	}
+	if len(manifest.Repositories) != len(runJobs) {
+		t.Fatalf("manifest lists %d repositories, want %d", len(manifest.Repositories), len(runJobs))
+	}
+
+	checksum := sha256.Sum256([]byte(cycloneDXJSON))
+	components := 2
+	tests := []struct {
+		repository Repository
+		want       []File
+	}{
+		{manifest.Repositories[0], []File{
+			{Path: sbomPath, Size: int64(len(cycloneDXJSON)), SHA256: hex.EncodeToString(checksum[:]), Components: &components},
+			{Path: invalidPath, Size: int64(len("not an SBOM")), SHA256: fileChecksum(t, invalidPath)},
+		}},
+		{manifest.Repositories[1], []File{{Path: missingPath, Error: manifest.Repositories[1].Files[0].Error}}},
+		// Files of failed jobs may be left over from earlier runs and are not inspected
+		{manifest.Repositories[2], nil},
+	}
+	for _, test := range tests {
+		if !reflect.DeepEqual(test.repository.Files, test.want) {
+			t.Errorf("%s files are %+v, want %+v", test.repository.RepoURL, test.repository.Files, test.want)
+		}
+	}
+	if manifest.Repositories[1].Files[0].Error == "" {
+		t.Error("missing file has no error")
+	}
+	failed := manifest.Repositories[2]
+	if failed.Error != "clone failed" || failed.ErrorClass != string(retry.ClassTransient) || failed.Attempts != 3 {
+		t.Errorf("failed repository is %+v", failed)
+	}
+}
+
+func fileChecksum(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum := sha256.Sum256(data)
+	return hex.EncodeToString(checksum[:])
+}
+
+func TestSummary(t *testing.T) {
+	totals := Totals{Repositories: 10, Succeeded: 4, Skipped: 3, Failed: 1, TimedOut: 1, Pending: 1}
+	want := "10 repositories: 4 succeeded, 3 skipped, 1 failed, 1 timed out, 1 pending"
+	if got := totals.Summary(); got != want {
+		t.Errorf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reports", FileName("20240101T110000.000Z"))
+	manifest := &Manifest{
+		RunID:        "20240101T110000.000Z",
+		Totals:       Totals{Repositories: 1, Succeeded: 1},
+		Repositories: []Repository{{RepoURL: "https://github.com/org/a", Status: jobs.StatusSucceeded, Attempts: 1}},
+	}
+	if err := manifest.Write(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read Manifest
+	if err := json.Unmarshal(data, &read); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&read, manifest) {
+		t.Errorf("read back %+v, want %+v", read, manifest)
+	}
+	if !IsManifest(path) {
+		t.Errorf("%s is not recognized as a manifest", path)
+	}
+}
+
+func TestIsManifest(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{FileName("20240101T110000.000Z"), true},
+		{"sbom_files/manifest-20240101T110000.000Z.json", true},
+		{FileName(jobs.NewRunID()), true},
+		// SBOMs of owners named manifest-... in the flat layout
+		{"manifest-foo_repo.sbom.json", false},
+		{"manifest-1.json", false},
+		{"manifest-20240101T110000.000Z.json.gz", false},
+		{"org_manifest-20240101T110000.000Z.json", false},
+		{"manifest-20240101T110000.000Z.cdx.json", false},
+	}
+	for _, test := range tests {
+		if got := IsManifest(test.path); got != test.want {
+			t.Errorf("IsManifest(%q) = %v, want %v", test.path, got, test.want)
+		}
+	}
+}
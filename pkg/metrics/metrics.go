@@ -0,0 +1,98 @@
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "bomfactory"
+
+// Metrics holds the Prometheus metrics of the SBOM worker pool
+type Metrics struct {
+	registry *prometheus.Registry
+
+	Jobs            *prometheus.CounterVec   // Finished jobs by status
+	CloneDuration   prometheus.Histogram     // Time spent cloning a repository
+	ScanDuration    *prometheus.HistogramVec // Time spent generating the SBOMs of a repository, by generator
+	BytesCloned     prometheus.Counter       // Size of all cloned working trees
+	ActiveWorkers   prometheus.Gauge         // Workers currently processing a repository
+	GeneratorErrors *prometheus.CounterVec   // Failed clone and scan attempts by error class
+}
+
+// durationBuckets range from half a second to about half an hour
+var durationBuckets = prometheus.ExponentialBuckets(0.5, 2, 13)
+
+// New creates the metrics in a registry of their own, together with the Go runtime and process collectors
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		Jobs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "sbom_jobs_total",
+			Help:      "Number of finished SBOM jobs by status.",
+		}, []string{"status"}),
+		CloneDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "clone_duration_seconds",
+			Help:      "Time spent cloning a repository.",
+			Buckets:   durationBuckets,
+		}),
+		ScanDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "scan_duration_seconds",
+			Help:      "Time spent generating the SBOMs of a repository.",
+			Buckets:   durationBuckets,
+		}, []string{"generator"}),
+		BytesCloned: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "cloned_bytes_total",
+			Help:      "Total size of the cloned working trees.",
+		}),
+		ActiveWorkers: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_workers",
+			Help:      "Number of workers currently processing a repository.",
+		}),
+		GeneratorErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "generator_errors_total",
+			Help:      "Number of failed clone and scan attempts by error class.",
+		}, []string{"class"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.Jobs, m.CloneDuration, m.ScanDuration, m.BytesCloned, m.ActiveWorkers, m.GeneratorErrors,
+	)
+	return m
+}
+
+// Serve exposes the metrics on /metrics at addr until the returned server is closed.
+// The Addr of the server holds the address listened on, e.g. the port chosen for ":0"
+func (m *Metrics) Serve(addr string) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Addr: listener.Addr().String(), Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", "error", err)
+		}
+	}()
+	slog.Info("serving metrics", "addr", server.Addr)
+	return server, nil
+}
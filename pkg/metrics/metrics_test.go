@@ -0,0 +1,52 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServe(t *testing.T) {
+	m := New()
+	m.Jobs.WithLabelValues("succeeded").Add(2)
+	m.Jobs.WithLabelValues("failed").Inc()
+	m.GeneratorErrors.WithLabelValues("scanner").Inc()
+	m.CloneDuration.Observe(0.7)
+	m.ScanDuration.WithLabelValues("syft-lib").Observe(3)
+
+	server, err := m.Serve("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	resp, err := http.Get("http://" + server.Addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{
+		`bomfactory_sbom_jobs_total{status="succeeded"} 2`,
+		`bomfactory_sbom_jobs_total{status="failed"} 1`,
+		`bomfactory_generator_errors_total{class="scanner"} 1`,
+		`bomfactory_clone_duration_seconds_bucket{le="1"} 1`,
+		`bomfactory_clone_duration_seconds_count 1`,
+		`bomfactory_scan_duration_seconds_sum{generator="syft-lib"} 3`,
+		`bomfactory_active_workers 0`,
+		`bomfactory_cloned_bytes_total 0`,
+		"go_goroutines ",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("metrics do not contain %q", want)
+		}
+	}
+
+	if _, err := m.Serve(server.Addr); err == nil {
+		t.Error("serving twice on the same address succeeded")
+	}
+}
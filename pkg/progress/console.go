@@ -0,0 +1,61 @@
+package progress
+
+import (
+	"io"
+	"os"
+	"sync"
+
+	"golang.org/x/term"
+)
+
+// Console is a writer that keeps a status line below everything written to it.
+// Log output written through the console moves the status line down instead of overwriting it.
+type Console struct {
+	mu       sync.Mutex
+	w        io.Writer
+	terminal bool
+	status   string
+}
+
+// NewConsole returns a console writing to f
+func NewConsole(f *os.File) *Console {
+	return &Console{w: f, terminal: term.IsTerminal(int(f.Fd()))}
+}
+
+// IsTerminal reports whether the console writes to a terminal and can display a live status line
+func (c *Console) IsTerminal() bool {
+	return c.terminal
+}
+
+// Write writes p above the status line
+func (c *Console) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clearStatus()
+	n, err := c.w.Write(p)
+	c.drawStatus()
+	return n, err
+}
+
+// SetStatus replaces the status line, an empty status removes it
+func (c *Console) SetStatus(status string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.clearStatus()
+	c.status = status
+	c.drawStatus()
+}
+
+func (c *Console) clearStatus() {
+	if c.status != "" {
+		_, _ = io.WriteString(c.w, "\r\033[K")
+	}
+}
+
+func (c *Console) drawStatus() {
+	if c.status != "" {
+		_, _ = io.WriteString(c.w, c.status)
+	}
+}
@@ -0,0 +1,273 @@
+package progress
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// Mode selects how progress is reported
+type Mode string
+
+const (
+	ModeAuto Mode = "auto" // Live status line if stdout and the console are terminals, log lines otherwise
+	ModeLive Mode = "live" // Live status line
+	ModeLog  Mode = "log"  // Periodic log lines
+	ModeNone Mode = "none" // No progress reporting
+)
+
+// ParseMode parses a progress mode name
+func ParseMode(name string) (Mode, error) {
+	switch mode := Mode(strings.ToLower(name)); mode {
+	case ModeAuto, ModeLive, ModeLog, ModeNone:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown progress mode %q (available: auto, live, log, none)", name)
+	}
+}
+
+// Outcome is the result of a finished item
+type Outcome int
+
+const (
+	Succeeded Outcome = iota
+	Failed
+	Skipped
+	Interrupted // Not counted as finished, the item will be processed again
+)
+
+// stdoutIsTerminal reports whether stdout is a terminal. Output piped to a file or another program
+// gets log lines, even though the status line itself is drawn on the console.
+var stdoutIsTerminal = func() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// liveInterval is how often the live status line is redrawn
+const liveInterval = 250 * time.Millisecond
+
+// Tracker counts finished and in-flight items of a long running operation
+// and reports throughput and the estimated time remaining
+type Tracker struct {
+	label    string
+	unit     string
+	total    int
+	console  *Console
+	mode     Mode
+	interval time.Duration
+
+	mu        sync.Mutex
+	started   time.Time
+	succeeded int
+	failed    int
+	skipped   int
+	inFlight  int
+	fraction  float64 // Set for operations whose total is not known in items
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a tracker for total items of unit, 0 if the number of items is unknown.
+// In log mode a line is logged every interval.
+func New(label, unit string, total int, console *Console, mode Mode, interval time.Duration) *Tracker {
+	if mode == ModeAuto {
+		mode = ModeLog
+		if console.IsTerminal() && stdoutIsTerminal() {
+			mode = ModeLive
+		}
+	}
+	return &Tracker{
+		label:    label,
+		unit:     unit,
+		total:    total,
+		console:  console,
+		mode:     mode,
+		interval: interval,
+	}
+}
+
+// Start starts reporting progress until Stop is called
+func (t *Tracker) Start() {
+	t.mu.Lock()
+	t.started = time.Now()
+	t.mu.Unlock()
+
+	if t.mode == ModeNone {
+		return
+	}
+
+	interval := t.interval
+	if t.mode == ModeLive {
+		interval = liveInterval
+	}
+	t.stop = make(chan struct{})
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				t.report()
+			}
+		}
+	}()
+}
+
+// Stop stops reporting and logs the final progress
+func (t *Tracker) Stop() {
+	if t.stop == nil {
+		return
+	}
+	close(t.stop)
+	<-t.done
+	t.stop = nil
+
+	if t.mode == ModeLive {
+		t.console.SetStatus("")
+	}
+	slog.Info(t.label+" finished", t.attrs()...)
+}
+
+// Begin records that an item is being processed
+func (t *Tracker) Begin() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight++
+}
+
+// Finish records that an item started with Begin has finished
+func (t *Tracker) Finish(outcome Outcome) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.inFlight--
+	t.count(outcome, 1)
+}
+
+// Add records n items that finished without being started with Begin
+func (t *Tracker) Add(outcome Outcome, n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.count(outcome, n)
+}
+
+// SetFraction sets the completed fraction of an operation whose total is not known in items
+func (t *Tracker) SetFraction(fraction float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.fraction = fraction
+}
+
+func (t *Tracker) count(outcome Outcome, n int) {
+	switch outcome {
+	case Succeeded:
+		t.succeeded += n
+	case Failed:
+		t.failed += n
+	case Skipped:
+		t.skipped += n
+	}
+}
+
+func (t *Tracker) report() {
+	if t.mode == ModeLive {
+		t.console.SetStatus(t.String())
+		return
+	}
+	slog.Info(t.label, t.attrs()...)
+}
+
+// snapshot holds the values derived from the counters at one point in time
+type snapshot struct {
+	finished int
+	fraction float64 // Completed fraction, negative if unknown
+	rate     float64 // Finished items per second
+	eta      time.Duration
+	elapsed  time.Duration
+}
+
+func (t *Tracker) snapshot() snapshot {
+	s := snapshot{
+		finished: t.succeeded + t.failed + t.skipped,
+		fraction: -1,
+		elapsed:  time.Since(t.started),
+	}
+	if seconds := s.elapsed.Seconds(); seconds > 0 {
+		s.rate = float64(s.finished) / seconds
+	}
+
+	switch {
+	case t.total > 0:
+		s.fraction = float64(s.finished) / float64(t.total)
+	case t.fraction > 0:
+		s.fraction = t.fraction
+	}
+	if s.fraction > 0 && s.fraction < 1 {
+		s.eta = time.Duration(float64(s.elapsed) * (1 - s.fraction) / s.fraction)
+	}
+	return s
+}
+
+// String formats the progress as a single line
+func (t *Tracker) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.snapshot()
+
+	var b strings.Builder
+	b.WriteString(t.label + ": ")
+	if t.total > 0 {
+		fmt.Fprintf(&b, "%d/%d %s", s.finished, t.total, t.unit)
+	} else {
+		fmt.Fprintf(&b, "%d %s", s.finished, t.unit)
+	}
+	if s.fraction >= 0 {
+		fmt.Fprintf(&b, " (%.0f%%)", s.fraction*100)
+	}
+	if t.failed > 0 || t.skipped > 0 {
+		fmt.Fprintf(&b, ", %d failed, %d skipped", t.failed, t.skipped)
+	}
+	if t.inFlight > 0 {
+		fmt.Fprintf(&b, ", %d in flight", t.inFlight)
+	}
+	b.WriteString(", " + formatRate(s.rate, t.unit))
+	if s.eta > 0 {
+		fmt.Fprintf(&b, ", ETA %s", s.eta.Round(time.Second))
+	}
+	return b.String()
+}
+
+func (t *Tracker) attrs() []any {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	s := t.snapshot()
+
+	attrs := []any{"finished", s.finished, "succeeded", t.succeeded, "failed", t.failed, "skipped", t.skipped,
+		"in_flight", t.inFlight, "elapsed", s.elapsed.Round(time.Second).String(), "rate", formatRate(s.rate, t.unit)}
+	if t.total > 0 {
+		attrs = append(attrs, "total", t.total)
+	}
+	if s.fraction >= 0 {
+		attrs = append(attrs, "percent", fmt.Sprintf("%.1f", s.fraction*100))
+	}
+	if s.eta > 0 {
+		attrs = append(attrs, "eta", s.eta.Round(time.Second).String())
+	}
+	return attrs
+}
+
+// formatRate formats a per-second rate, switching to per minute for slow operations
+func formatRate(perSecond float64, unit string) string {
+	if perSecond > 0 && perSecond < 1 {
+		return fmt.Sprintf("%.1f %s/min", perSecond*60, unit)
+	}
+	return fmt.Sprintf("%.1f %s/s", perSecond, unit)
+}
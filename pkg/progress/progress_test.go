@@ -0,0 +1,37 @@
+package progress
+
+import (
+	"io"
+	"testing"
+	"time"
+)
+
+func TestNewAutoMode(t *testing.T) {
+	tests := []struct {
+		stdoutTerminal  bool
+		consoleTerminal bool
+		want            Mode
+	}{
+		{true, true, ModeLive},
+		{false, true, ModeLog},
+		{true, false, ModeLog},
+		{false, false, ModeLog},
+	}
+	defer func(isTerminal func() bool) { stdoutIsTerminal = isTerminal }(stdoutIsTerminal)
+	for _, test := range tests {
+		stdoutIsTerminal = func() bool { return test.stdoutTerminal }
+		console := &Console{w: io.Discard, terminal: test.consoleTerminal}
+		if got := New("scan", "repos", 1, console, ModeAuto, time.Second).mode; got != test.want {
+			t.Errorf("auto mode with stdout terminal %v and console terminal %v = %s, want %s",
+				test.stdoutTerminal, test.consoleTerminal, got, test.want)
+		}
+	}
+
+	stdoutIsTerminal = func() bool { return false }
+	console := &Console{w: io.Discard}
+	for _, mode := range []Mode{ModeLive, ModeLog, ModeNone} {
+		if got := New("scan", "repos", 1, console, mode, time.Second).mode; got != mode {
+			t.Errorf("mode %s changed to %s", mode, got)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Class classifies why an operation failed
+type Class string
+
+const (
+	ClassTransient Class = "transient" // Network hiccups and server errors, worth retrying right away
+	ClassNotFound  Class = "not_found" // The repository was deleted or never existed
+	ClassAuth      Class = "auth"      // Authentication is required or was refused
+	ClassTimeout   Class = "timeout"   // The operation ran out of its time budget
+	ClassScanner   Class = "scanner"   // The SBOM generator failed or crashed
+	ClassPermanent Class = "permanent" // Any other failure that will not go away by retrying
+	ClassUnknown   Class = "unknown"   // The failure was not classified
+)
+
+// Retryable reports whether an operation failing with this class should be retried within a run
+func (c Class) Retryable() bool {
+	return c == ClassTransient
+}
+
+// Permanent reports whether a job failing with this class should not be retried by later runs
+func (c Class) Permanent() bool {
+	return c == ClassNotFound || c == ClassAuth || c == ClassPermanent
+}
+
+// PermanentClasses lists every class for which Permanent is true
+var PermanentClasses = []Class{ClassNotFound, ClassAuth, ClassPermanent}
+
+// Error is an error annotated with its class
+type Error struct {
+	Class Class
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Classify annotates err with a class. It returns nil if err is nil.
+func Classify(class Class, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Class: class, Err: err}
+}
+
+// ClassOf returns the class of err, or ClassUnknown if it was not classified
+func ClassOf(err error) Class {
+	var classified *Error
+	if errors.As(err, &classified) {
+		return classified.Class
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ClassTimeout
+	}
+	return ClassUnknown
+}
+
+// Policy retries operations failing with a retryable class using exponential backoff
+type Policy struct {
+	MaxAttempts int           // Total number of attempts, including the first one
+	BaseDelay   time.Duration // Delay before the first retry, doubled for every further retry
+	MaxDelay    time.Duration // Upper bound of the delay between attempts, 0 means no bound
+}
+
+// DefaultPolicy is the policy used when none is configured
+var DefaultPolicy = Policy{
+	MaxAttempts: 3,
+	BaseDelay:   2 * time.Second,
+	MaxDelay:    time.Minute,
+}
+
+// Delay returns the time to wait before the given retry (1 for the first retry)
+func (p Policy) Delay(retry int) time.Duration {
+	delay := p.BaseDelay
+	// Doubling stops at the bound, or before the delay overflows when there is none
+	for i := 1; i < retry && delay < math.MaxInt64/4 && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	// Add up to 20% jitter so workers that failed together do not retry together
+	if delay > 0 {
+		delay += time.Duration(rand.Int63n(int64(delay)/5 + 1)) //nolint:gosec // jitter does not need a secure random source
+	}
+	return delay
+}
+
+// Do calls fn until it succeeds, fails with a class that is not retryable, the attempts are used up,
+// or ctx is done. attempt is 1 for the first call. It returns the error of the last attempt.
+func (p Policy) Do(ctx context.Context, fn func(attempt int) error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+
+	var err error
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		err = fn(attempt)
+		if err == nil || !ClassOf(err).Retryable() || attempt == maxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(p.Delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPolicyDelay(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		retry  int
+		want   time.Duration // Delay before jitter
+	}{
+		{"first retry", Policy{BaseDelay: time.Second, MaxDelay: time.Minute}, 1, time.Second},
+		{"doubled", Policy{BaseDelay: time.Second, MaxDelay: time.Minute}, 4, 8 * time.Second},
+		{"bounded", Policy{BaseDelay: time.Second, MaxDelay: time.Minute}, 10, time.Minute},
+		{"base above bound", Policy{BaseDelay: 5 * time.Minute, MaxDelay: time.Minute}, 1, time.Minute},
+		{"no bound", Policy{BaseDelay: time.Second}, 10, 512 * time.Second},
+		{"no bound many retries", Policy{BaseDelay: time.Second}, 100, time.Second << 32},
+		{"no delay", Policy{MaxDelay: time.Minute}, 3, 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			for i := 0; i < 20; i++ {
+				got := test.policy.Delay(test.retry)
+				if got < test.want || got > test.want+test.want/5 {
+					t.Fatalf("Delay(%d) = %s, want %s plus up to 20%% jitter", test.retry, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPolicyDo(t *testing.T) {
+	transient := Classify(ClassTransient, errors.New("connection reset"))
+	notFound := Classify(ClassNotFound, errors.New("repository not found"))
+	tests := []struct {
+		name         string
+		errs         []error // Error of every attempt, the last one repeats
+		wantAttempts int
+		wantErr      error
+	}{
+		{"success", []error{nil}, 1, nil},
+		{"transient then success", []error{transient, transient, nil}, 3, nil},
+		{"attempts used up", []error{transient}, 3, transient},
+		{"not retryable", []error{transient, notFound}, 2, notFound},
+	}
+	policy := Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			attempts := 0
+			err := policy.Do(context.Background(), func(attempt int) error {
+				attempts++
+				if attempt != attempts {
+					t.Errorf("attempt %d reported as %d", attempts, attempt)
+				}
+				return test.errs[min(attempt, len(test.errs))-1]
+			})
+			if !errors.Is(err, test.wantErr) {
+				t.Errorf("Do = %v, want %v", err, test.wantErr)
+			}
+			if attempts != test.wantAttempts {
+				t.Errorf("Do made %d attempts, want %d", attempts, test.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestPolicyDoCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	attempts := 0
+	policy := Policy{MaxAttempts: 5, BaseDelay: time.Hour}
+	err := policy.Do(ctx, func(int) error {
+		attempts++
+		return Classify(ClassTransient, errors.New("connection reset"))
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("Do = %v after %d attempts, want the first error without waiting to retry", err, attempts)
+	}
+}
@@ -0,0 +1,142 @@
+package sbom
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Format is an SBOM output format.
+type Format string
+
+const (
+	FormatCycloneDXJSON15 Format = "cyclonedx-json@1.5"
+	FormatCycloneDXJSON16 Format = "cyclonedx-json@1.6"
+	FormatCycloneDXXML    Format = "cyclonedx-xml@1.5"
+	FormatSPDXJSON        Format = "spdx-json@2.3"
+	FormatSPDXTagValue    Format = "spdx-tag-value@2.3"
+)
+
+// DefaultFormat is the format used when none is selected.
+const DefaultFormat = FormatCycloneDXJSON15
+
+// LegacyExtension is the file extension of SBOMs in the default format when no format is selected,
+// which keeps the names earlier versions gave them.
+const LegacyExtension = ".sbom.json"
+
+// Formats lists all supported output formats.
+var Formats = []Format{
+	FormatCycloneDXJSON15,
+	FormatCycloneDXJSON16,
+	FormatCycloneDXXML,
+	FormatSPDXJSON,
+	FormatSPDXTagValue,
+}
+
+// formatAliases maps short format names to their default version.
+var formatAliases = map[string]Format{
+	"cyclonedx-json": FormatCycloneDXJSON15,
+	"cyclonedx":      FormatCycloneDXJSON15,
+	"cdx":            FormatCycloneDXJSON15,
+	"cyclonedx-xml":  FormatCycloneDXXML,
+	"spdx-json":      FormatSPDXJSON,
+	"spdx":           FormatSPDXJSON,
+	"spdx-tag-value": FormatSPDXTagValue,
+	"spdx-tv":        FormatSPDXTagValue,
+}
+
+// ParseFormat parses a format name such as "spdx-json" or "cyclonedx-json@1.6".
+func ParseFormat(name string) (Format, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if format, ok := formatAliases[name]; ok {
+		return format, nil
+	}
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+
+	names := make([]string, 0, len(Formats))
+	for _, format := range Formats {
+		names = append(names, string(format))
+	}
+	return "", fmt.Errorf("unknown SBOM format %q (available: %s)", name, strings.Join(names, ", "))
+}
+
+// ParseFormats parses a list of format names, rejecting formats that would be written to the same file.
+func ParseFormats(names []string) ([]Format, error) {
+	var formats []Format
+	byExtension := make(map[string]Format)
+	for _, name := range names {
+		format, err := ParseFormat(name)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := byExtension[format.Extension()]; ok {
+			if other == format {
+				continue
+			}
+			return nil, fmt.Errorf("formats %s and %s cannot be generated together, both use the %s extension", other, format, format.Extension())
+		}
+		byExtension[format.Extension()] = format
+		formats = append(formats, format)
+	}
+	if len(formats) == 0 {
+		formats = append(formats, DefaultFormat)
+	}
+	return formats, nil
+}
+
+// Extension returns the file extension used for SBOMs in the format.
+func (f Format) Extension() string {
+	switch f {
+	case FormatCycloneDXJSON15, FormatCycloneDXJSON16:
+		return ".cdx.json"
+	case FormatCycloneDXXML:
+		return ".cdx.xml"
+	case FormatSPDXJSON:
+		return ".spdx.json"
+	case FormatSPDXTagValue:
+		return ".spdx"
+	default:
+		return ".sbom"
+	}
+}
+
+// Readable reports whether Components can read SBOMs in the format.
+func (f Format) Readable() bool {
+	return f == FormatCycloneDXJSON15 || f == FormatSPDXJSON
+}
+
+// Output is a single SBOM file to write.
+type Output struct {
+	Format Format
+	File   string
+}
+
+// unsupportedFormats returns the formats that are not in supported.
+func unsupportedFormats(formats, supported []Format) []Format {
+	var unsupported []Format
+	for _, format := range formats {
+		found := false
+		for _, s := range supported {
+			if format == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unsupported = append(unsupported, format)
+		}
+	}
+	return unsupported
+}
+
+// CheckFormats returns an error if the generator cannot produce all formats.
+func CheckFormats(generator Generator, formats []Format) error {
+	unsupported := unsupportedFormats(formats, generator.Formats())
+	if len(unsupported) > 0 {
+		return fmt.Errorf("%s does not support the format(s) %v (supported: %v)", generator.Name(), unsupported, generator.Formats())
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package sbom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// DefaultTimeout is the maximum time a single SBOM generation may take.
+const DefaultTimeout = 2 * time.Minute
+
+// DefaultGenerator is the generator used when none is selected.
+const DefaultGenerator = "syft-lib"
+
+// Request describes a single SBOM generation.
+type Request struct {
+	Directory     string   // Directory to scan
+	SourceName    string   // Name of the scanned source recorded in the SBOM
+	SourceVersion string   // Version of the scanned source, such as a tag, recorded if not empty
+	Outputs       []Output // SBOM files to write, one per format
+
+	// OnWarning is called for non-fatal problems found during the scan, if the generator reports them.
+	OnWarning func(Warning)
+}
+
+// Generator generates SBOMs for a directory using an SBOM tool.
+type Generator interface {
+	// Name returns the name of the tool.
+	Name() string
+	// Version returns the version of the tool.
+	Version(ctx context.Context) (string, error)
+	// Formats returns the output formats the tool can produce.
+	Formats() []Format
+	// Generate scans the requested directory and writes an SBOM for every requested output.
+	Generate(ctx context.Context, req Request) error
+}
+
+var generators = map[string]func() Generator{
+	"syft-lib": func() Generator { return &SyftLibrary{} },
+	"syft":     func() Generator { return &Syft{} },
+	"cdxgen":   func() Generator { return &Cdxgen{} },
+	"trivy":    func() Generator { return &Trivy{} },
+}
+
+// GeneratorNames returns the names of all available generators.
+func GeneratorNames() []string {
+	names := make([]string, 0, len(generators))
+	for name := range generators {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewGenerator returns the generator with the given name.
+func NewGenerator(name string) (Generator, error) {
+	newGenerator, ok := generators[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown generator %q (available: %s)", name, strings.Join(GeneratorNames(), ", "))
+	}
+	return newGenerator(), nil
+}
+
+// Syft generates SBOMs with the syft binary.
+type Syft struct {
+	version toolVersion
+}
+
+// Name returns the name of the tool.
+func (s *Syft) Name() string {
+	return "syft"
+}
+
+// Version returns the version of the syft binary.
+func (s *Syft) Version(ctx context.Context) (string, error) {
+	return s.version.get(ctx, "syft", "version")
+}
+
+// Formats returns the output formats syft can produce.
+func (s *Syft) Formats() []Format {
+	return Formats
+}
+
+// Generate scans the requested directory with syft, writing all outputs from a single scan.
+func (s *Syft) Generate(ctx context.Context, req Request) error {
+	args := []string{"scan", req.Directory, "--source-name", req.SourceName}
+	if req.SourceVersion != "" {
+		args = append(args, "--source-version", req.SourceVersion)
+	}
+	for _, output := range req.Outputs {
+		args = append(args, "-o", fmt.Sprintf("%s=%s", output.Format, output.File))
+	}
+	return runTool(ctx, "syft", args...)
+}
+
+// Cdxgen generates SBOMs with the cdxgen binary.
+type Cdxgen struct {
+	version toolVersion
+}
+
+// Name returns the name of the tool.
+func (c *Cdxgen) Name() string {
+	return "cdxgen"
+}
+
+// Version returns the version of the cdxgen binary.
+func (c *Cdxgen) Version(ctx context.Context) (string, error) {
+	return c.version.get(ctx, "cdxgen", "--version")
+}
+
+// Formats returns the output formats cdxgen can produce.
+func (c *Cdxgen) Formats() []Format {
+	return []Format{FormatCycloneDXJSON15, FormatCycloneDXJSON16}
+}
+
+// Generate scans the requested directory with cdxgen, once per output since it writes a single spec version.
+func (c *Cdxgen) Generate(ctx context.Context, req Request) error {
+	for _, output := range req.Outputs {
+		specVersion := strings.TrimPrefix(string(output.Format), "cyclonedx-json@")
+		args := []string{"-r", "--spec-version", specVersion, "--project-name", req.SourceName, "-o", output.File, req.Directory}
+		if req.SourceVersion != "" {
+			args = append(args, "--project-version", req.SourceVersion)
+		}
+		err := runTool(ctx, "cdxgen", args...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runTool runs an SBOM tool, returning its output on failure.
+func runTool(ctx context.Context, tool string, args ...string) error {
+	// Check if the tool is installed
+	if _, err := exec.LookPath(tool); err != nil {
+		return retry.Classify(retry.ClassScanner, fmt.Errorf("%s is not installed or not in PATH: %w", tool, err))
+	}
+
+	cmd := exec.CommandContext(ctx, tool, args...)
+	// Do not wait forever for subprocesses of the tool that keep its output open after it was killed
+	cmd.WaitDelay = 10 * time.Second
+	slog.Debug("executing command", "command", cmd.String())
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return timedOut(tool)
+	}
+	if err != nil {
+		return retry.Classify(retry.ClassScanner, fmt.Errorf("error generating SBOM with %s: %w\nOutput: %s", tool, err, output))
+	}
+
+	return nil
+}
+
+var versionRegexp = regexp.MustCompile(`v?(\d+\.\d+\.\d+[0-9A-Za-z.+-]*)`)
+
+// toolVersion looks up and caches the version of an SBOM tool.
+type toolVersion struct {
+	once    sync.Once
+	version string
+	err     error
+}
+
+func (v *toolVersion) get(ctx context.Context, tool string, args ...string) (string, error) {
+	v.once.Do(func() {
+		if _, err := exec.LookPath(tool); err != nil {
+			v.err = fmt.Errorf("%s is not installed or not in PATH: %w", tool, err)
+			return
+		}
+		output, err := exec.CommandContext(ctx, tool, args...).Output()
+		if err != nil {
+			v.err = fmt.Errorf("failed to get %s version: %w", tool, err)
+			return
+		}
+		match := versionRegexp.FindStringSubmatch(string(output))
+		if match == nil {
+			v.err = fmt.Errorf("failed to parse %s version from %q", tool, strings.TrimSpace(string(output)))
+			return
+		}
+		v.version = match[1]
+	})
+	return v.version, v.err
+}
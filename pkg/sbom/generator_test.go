@@ -0,0 +1,261 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	cyclonedx "github.com/CycloneDX/cyclonedx-go"
+	spdxjson "github.com/spdx/tools-golang/json"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/tagvalue"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// fakeTool installs a shell script as the named tool in front of PATH
+func fakeTool(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestParseFormats(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    []Format
+		wantErr string
+	}{
+		{names: nil, want: []Format{DefaultFormat}},
+		{names: []string{"spdx-json"}, want: []Format{FormatSPDXJSON}},
+		{names: []string{" CycloneDX-JSON@1.6 ", "spdx-tv"}, want: []Format{FormatCycloneDXJSON16, FormatSPDXTagValue}},
+		{names: []string{"cdx", "cyclonedx-xml", "spdx"}, want: []Format{FormatCycloneDXJSON15, FormatCycloneDXXML, FormatSPDXJSON}},
+		// Aliases of the same format are written once
+		{names: []string{"cdx", "cyclonedx-json@1.5"}, want: []Format{FormatCycloneDXJSON15}},
+		{names: []string{"cyclonedx-json@1.5", "cyclonedx-json@1.6"}, wantErr: "both use the .cdx.json extension"},
+		{names: []string{"spdx-json", "swid"}, wantErr: `unknown SBOM format "swid"`},
+	}
+	for _, test := range tests {
+		got, err := ParseFormats(test.names)
+		switch {
+		case test.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("ParseFormats(%q) = %v, %v, want an error containing %q", test.names, got, err, test.wantErr)
+			}
+		case err != nil:
+			t.Errorf("ParseFormats(%q) failed: %v", test.names, err)
+		case !reflect.DeepEqual(got, test.want):
+			t.Errorf("ParseFormats(%q) = %v, want %v", test.names, got, test.want)
+		}
+	}
+}
+
+func TestCheckFormats(t *testing.T) {
+	tests := []struct {
+		generator string
+		formats   []Format
+		wantErr   bool
+	}{
+		{"syft-lib", Formats, false},
+		{"syft", Formats, false},
+		{"cdxgen", []Format{FormatCycloneDXJSON15, FormatCycloneDXJSON16}, false},
+		{"cdxgen", []Format{FormatSPDXJSON}, true},
+		{"cdxgen", []Format{FormatCycloneDXXML}, true},
+		{"trivy", []Format{FormatCycloneDXJSON15, FormatCycloneDXJSON16, FormatSPDXJSON, FormatSPDXTagValue}, false},
+		{"trivy", []Format{FormatSPDXJSON, FormatCycloneDXXML}, true},
+	}
+	for _, test := range tests {
+		generator, err := NewGenerator(test.generator)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = CheckFormats(generator, test.formats)
+		if (err != nil) != test.wantErr {
+			t.Errorf("CheckFormats(%s, %v) = %v, want an error: %v", test.generator, test.formats, err, test.wantErr)
+		}
+	}
+}
+
+func TestNewGenerator(t *testing.T) {
+	for _, name := range GeneratorNames() {
+		generator, err := NewGenerator(name)
+		if err != nil {
+			t.Fatalf("NewGenerator(%q) failed: %v", name, err)
+		}
+		if generator.Name() != name && !(name == "syft-lib" && generator.Name() == "syft") {
+			t.Errorf("generator %s is named %s", name, generator.Name())
+		}
+		if len(generator.Formats()) == 0 {
+			t.Errorf("generator %s supports no formats", name)
+		}
+	}
+	if _, err := NewGenerator("scancode"); err == nil || !strings.Contains(err.Error(), "available: cdxgen, syft, syft-lib, trivy") {
+		t.Errorf("NewGenerator of an unknown generator = %v, want an error listing the generators", err)
+	}
+}
+
+func TestRunTool(t *testing.T) {
+	fakeTool(t, "fake-scanner", `case "$1" in
+fail) echo "cannot parse go.mod" >&2; exit 3 ;;
+hang) exec sleep 10 ;;
+esac
+`)
+	ctx := context.Background()
+
+	if err := runTool(ctx, "fake-scanner", "ok"); err != nil {
+		t.Errorf("runTool of a succeeding tool failed: %v", err)
+	}
+
+	err := runTool(ctx, "fake-scanner", "fail")
+	if retry.ClassOf(err) != retry.ClassScanner || !strings.Contains(err.Error(), "cannot parse go.mod") {
+		t.Errorf("runTool of a failing tool = %v, want a scanner error with its output", err)
+	}
+
+	timeoutCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	started := time.Now()
+	err = runTool(timeoutCtx, "fake-scanner", "hang")
+	if !errors.Is(err, ErrTimeout) || retry.ClassOf(err) != retry.ClassTimeout {
+		t.Errorf("runTool of a hanging tool = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 5*time.Second {
+		t.Errorf("runTool returned %s after the timeout", elapsed)
+	}
+
+	err = runTool(ctx, "missing-scanner")
+	if retry.ClassOf(err) != retry.ClassScanner || !strings.Contains(err.Error(), "not installed") {
+		t.Errorf("runTool of a missing tool = %v, want a scanner error", err)
+	}
+}
+
+func TestToolVersion(t *testing.T) {
+	fakeTool(t, "trivy", `echo "Version: 0.56.2"
+echo "Vulnerability DB: Version: 2"
+`)
+	version, err := (&Trivy{}).Version(context.Background())
+	if err != nil || version != "0.56.2" {
+		t.Errorf("Version() = %q, %v, want 0.56.2", version, err)
+	}
+}
+
+// trivyOutputs are SBOMs as trivy writes them by format name, named after the scanned directory
+var trivyOutputs = map[string]string{
+	"cyclonedx": `{"bomFormat": "CycloneDX", "specVersion": "1.6", "version": 1,
+"metadata": {"component": {"type": "application", "bom-ref": "root", "name": "/tmp/clone-123"}},
+"components": [{"type": "library", "bom-ref": "lib", "name": "lib", "version": "1.0.0", "purl": "pkg:golang/example.com/lib@1.0.0"}]}`,
+	"spdx-json": `{"spdxVersion": "SPDX-2.3", "dataLicense": "CC0-1.0", "SPDXID": "SPDXRef-DOCUMENT", "name": "/tmp/clone-123",
+"documentNamespace": "http://trivy.dev/filesystem/clone-123", "creationInfo": {"creators": ["Tool: trivy-0.56.2"], "created": "2024-01-01T00:00:00Z"},
+"packages": [{"name": "/tmp/clone-123", "SPDXID": "SPDXRef-Filesystem-1", "downloadLocation": "NONE"},
+{"name": "lib", "SPDXID": "SPDXRef-Package-2", "versionInfo": "1.0.0", "downloadLocation": "NONE"}],
+"relationships": [{"spdxElementId": "SPDXRef-DOCUMENT", "relatedSpdxElement": "SPDXRef-Filesystem-1", "relationshipType": "DESCRIBES"},
+{"spdxElementId": "SPDXRef-Filesystem-1", "relatedSpdxElement": "SPDXRef-Package-2", "relationshipType": "CONTAINS"}]}`,
+	"spdx": `SPDXVersion: SPDX-2.3
+DataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+DocumentName: /tmp/clone-123
+DocumentNamespace: http://trivy.dev/filesystem/clone-123
+Creator: Tool: trivy-0.56.2
+Created: 2024-01-01T00:00:00Z
+
+PackageName: /tmp/clone-123
+SPDXID: SPDXRef-Filesystem-1
+PackageDownloadLocation: NONE
+
+PackageName: lib
+SPDXID: SPDXRef-Package-2
+PackageVersion: 1.0.0
+PackageDownloadLocation: NONE
+
+Relationship: SPDXRef-DOCUMENT DESCRIBES SPDXRef-Filesystem-1
+Relationship: SPDXRef-Filesystem-1 CONTAINS SPDXRef-Package-2
+`,
+}
+
+func TestTrivyGenerate(t *testing.T) {
+	fixtures := t.TempDir()
+	for format, data := range trivyOutputs {
+		if err := os.WriteFile(filepath.Join(fixtures, format), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// trivy fs --quiet --format <format> --output <file> <dir>
+	fakeTool(t, "trivy", `cp "`+fixtures+`/$4" "$6"`)
+
+	dir := t.TempDir()
+	outputs := []Output{
+		{Format: FormatCycloneDXJSON15, File: filepath.Join(dir, "widget.cdx.json")},
+		{Format: FormatSPDXJSON, File: filepath.Join(dir, "widget.spdx.json")},
+		{Format: FormatSPDXTagValue, File: filepath.Join(dir, "widget.spdx")},
+	}
+	req := Request{Directory: "/tmp/clone-123", SourceName: "github.com/acme/widget", SourceVersion: "v1.2.3", Outputs: outputs}
+	if err := (&Trivy{}).Generate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	// CycloneDX is written in the requested spec version rather than the one of the trivy release
+	var bom cyclonedx.BOM
+	if err := cyclonedx.NewBOMDecoder(bytes.NewReader(readFile(t, outputs[0].File)), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+		t.Fatal(err)
+	}
+	if bom.SpecVersion != cyclonedx.SpecVersion1_5 {
+		t.Errorf("CycloneDX spec version is %s, want 1.5", bom.SpecVersion)
+	}
+	if root := bom.Metadata.Component; root.Name != req.SourceName || root.Version != req.SourceVersion {
+		t.Errorf("CycloneDX source is %s %s, want %s %s", root.Name, root.Version, req.SourceName, req.SourceVersion)
+	}
+	if bom.Components == nil || len(*bom.Components) != 1 {
+		t.Errorf("CycloneDX components are %v, want lib", bom.Components)
+	}
+
+	spdxJSON, err := spdxjson.Read(bytes.NewReader(readFile(t, outputs[1].File)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	spdxTagValue, err := tagvalue.Read(bytes.NewReader(readFile(t, outputs[2].File)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		format   Format
+		name     string
+		packages map[string]string
+	}{
+		{FormatSPDXJSON, spdxJSON.DocumentName, packageVersions(spdxJSON.Packages)},
+		{FormatSPDXTagValue, spdxTagValue.DocumentName, packageVersions(spdxTagValue.Packages)},
+	} {
+		if test.name != req.SourceName {
+			t.Errorf("%s document is named %s, want %s", test.format, test.name, req.SourceName)
+		}
+		want := map[string]string{req.SourceName: req.SourceVersion, "lib": "1.0.0"}
+		if !reflect.DeepEqual(test.packages, want) {
+			t.Errorf("%s packages are %v, want %v", test.format, test.packages, want)
+		}
+	}
+}
+
+// packageVersions returns the versions of SPDX packages by name
+func packageVersions(packages []*spdx.Package) map[string]string {
+	versions := make(map[string]string, len(packages))
+	for _, pkg := range packages {
+		versions[pkg.PackageName] = pkg.PackageVersion
+	}
+	return versions
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -2,11 +2,13 @@ package sbom
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
 	"strings"
 
 	"github.com/package-url/packageurl-go"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
 )
 
 type SPDX struct {
@@ -39,18 +41,42 @@ type ExternalRef struct {
 	ReferenceLocator  string `json:"referenceLocator"`
 }
 
+// ErrNotSPDX is returned when adding PURLs to a document that is not an SPDX JSON document.
+var ErrNotSPDX = errors.New("not an SPDX JSON document")
+
+// UpdateSPDXWithPURLs adds PURLs to the packages of an SPDX JSON file, which may be compressed.
 func UpdateSPDXWithPURLs(filePath string) error {
-	// Read the SPDX JSON file
-	file, err := os.ReadFile(filePath)
+	// Read the SPDX JSON file, which may be compressed
+	file, algorithm, err := compress.ReadFile(filePath)
 	if err != nil {
 		return fmt.Errorf("error reading file: %w", err)
 	}
 
+	updatedFile, err := AddPURLs(file)
+	if err != nil {
+		return err
+	}
+
+	// Write the updated document back to the file with the same compression
+	err = compress.WriteFile(filePath, updatedFile, algorithm, 0o600)
+	if err != nil {
+		return fmt.Errorf("error writing file: %w", err)
+	}
+
+	return nil
+}
+
+// AddPURLs returns the SPDX JSON document with package URLs added to its packages.
+func AddPURLs(file []byte) ([]byte, error) {
 	// Parse the JSON into a Go struct
 	var spdx SPDX
-	err = json.Unmarshal(file, &spdx)
+	err := json.Unmarshal(file, &spdx)
 	if err != nil {
-		return fmt.Errorf("error parsing JSON: %w", err)
+		return nil, fmt.Errorf("error parsing JSON: %w", err)
+	}
+	// Other documents such as CycloneDX SBOMs would lose their contents
+	if spdx.SpdxVersion == "" {
+		return nil, ErrNotSPDX
 	}
 
 	// Update the struct to include PURLs
@@ -354,16 +380,9 @@ func UpdateSPDXWithPURLs(filePath string) error {
 		})
 	}
 
-	// Write the updated struct back to the JSON file
 	updatedFile, err := json.MarshalIndent(spdx, "", "  ")
 	if err != nil {
-		return fmt.Errorf("error marshalling JSON: %w", err)
+		return nil, fmt.Errorf("error marshalling JSON: %w", err)
 	}
-
-	err = os.WriteFile(filePath, updatedFile, 0o600)
-	if err != nil {
-		return fmt.Errorf("error writing file: %w", err)
-	}
-
-	return nil
+	return updatedFile, nil
 }
@@ -1,44 +1,105 @@
 package sbom
 
 import (
-	"context"
+	"bytes"
 	"fmt"
-	"os/exec"
-	"time"
+	"strings"
 
+	cyclonedx "github.com/CycloneDX/cyclonedx-go"
 	proto "github.com/protobom/protobom/pkg/reader"
+	protosbom "github.com/protobom/protobom/pkg/sbom"
+	"github.com/spdx/tools-golang/tagvalue"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
 )
 
-// ValidateSBOM validates the SBOM file.
+// ValidateSBOM validates the SBOM file, which may be gzip or zstd compressed.
 func ValidateSBOM(sbom string) error {
-	sbomReader := proto.New()
-	_, err := sbomReader.ParseFile(sbom)
+	data, _, err := compress.ReadFile(sbom)
 	if err != nil {
-		return fmt.Errorf("error parsing SBOM: %w", err)
+		return err
+	}
+	return ValidateSBOMData(compress.TrimExtension(sbom), data)
+}
+
+// ValidateSBOMData validates an uncompressed SBOM stored under name. CycloneDX XML and SPDX
+// tag-value SBOMs are recognized by the extension of their format, all others are read as JSON.
+func ValidateSBOMData(name string, data []byte) error {
+	switch {
+	case strings.HasSuffix(name, FormatCycloneDXXML.Extension()):
+		var bom cyclonedx.BOM
+		if err := cyclonedx.NewBOMDecoder(bytes.NewReader(data), cyclonedx.BOMFileFormatXML).Decode(&bom); err != nil {
+			return fmt.Errorf("error parsing CycloneDX XML SBOM: %w", err)
+		}
+		if !strings.HasPrefix(bom.XMLNS, "http://cyclonedx.org/schema/bom/") {
+			return fmt.Errorf("error parsing CycloneDX XML SBOM: unknown namespace %q", bom.XMLNS)
+		}
+		return nil
+	case strings.HasSuffix(name, FormatSPDXTagValue.Extension()):
+		if _, err := tagvalue.Read(bytes.NewReader(data)); err != nil {
+			return fmt.Errorf("error parsing SPDX tag-value SBOM: %w", err)
+		}
+		return nil
+	default:
+		_, err := parse(data)
+		return err
 	}
-	return nil
 }
 
-// GenerateSBOMWithCycloneDX generates an SBOM using the cdxgen binary.
-func GenerateSBOMWithCycloneDX(directory, outputFile, repo string) error {
-	// Check if cdxgen is installed
-	_, err := exec.LookPath("syft")
+// parseFile parses an SBOM file, decompressing it if needed.
+func parseFile(sbom string) (*protosbom.Document, error) {
+	data, _, err := compress.ReadFile(sbom)
 	if err != nil {
-		return fmt.Errorf("syft is not installed or not in PATH: %w", err)
+		return nil, err
 	}
-	// Create a context with a 2-minute timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
+	return parse(data)
+}
 
-	cmd := exec.CommandContext(ctx, "syft", "scan", directory, "-o", "cyclonedx-json@1.5", "--source-name", repo, "--file", outputFile)
-	fmt.Println("Executing command: for the repo", repo, cmd.String())
-	output, err := cmd.CombinedOutput()
-	if ctx.Err() == context.DeadlineExceeded {
-		return fmt.Errorf("command timed out")
+func parse(data []byte) (*protosbom.Document, error) {
+	document, err := proto.New().ParseStream(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing SBOM: %w", err)
 	}
+	return document, nil
+}
+
+// CountComponents returns the number of components described by the SBOM file,
+// not counting the root elements describing the scanned source.
+func CountComponents(sbom string) (int, error) {
+	components, err := Components(sbom)
 	if err != nil {
-		return fmt.Errorf("error generating SBOM with cdxgen: %w\nOutput: %s", err, output)
+		return 0, err
 	}
+	return len(components), nil
+}
 
-	return nil
+// Components returns the packages described by the SBOM file, not counting the root elements
+// describing the scanned source. Components are identified by their package URL if they have one,
+// by name and version otherwise.
+func Components(sbom string) ([]string, error) {
+	document, err := parseFile(sbom)
+	if err != nil {
+		return nil, err
+	}
+	if document.GetNodeList() == nil {
+		return nil, nil
+	}
+
+	roots := make(map[string]bool, len(document.GetNodeList().GetRootElements()))
+	for _, id := range document.GetNodeList().GetRootElements() {
+		roots[id] = true
+	}
+	var components []string
+	for _, node := range document.GetNodeList().GetNodes() {
+		// Files listed by SPDX SBOMs are not components
+		if roots[node.GetId()] || node.GetType() == protosbom.Node_FILE {
+			continue
+		}
+		if purl := node.GetIdentifiers()[int32(protosbom.SoftwareIdentifierType_PURL)]; purl != "" {
+			components = append(components, purl)
+			continue
+		}
+		components = append(components, node.GetName()+"@"+node.GetVersion())
+	}
+	return components, nil
 }
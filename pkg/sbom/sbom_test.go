@@ -0,0 +1,111 @@
+package sbom
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bit-bom/bom-factory/pkg/compress"
+)
+
+const (
+	cycloneDXJSON = `{"bomFormat": "CycloneDX", "specVersion": "1.5", "version": 1, "components": []}`
+	cycloneDXXML  = `<?xml version="1.0" encoding="UTF-8"?>
+<bom xmlns="http://cyclonedx.org/schema/bom/1.5" version="1"><components></components></bom>`
+	spdxTagValue = `SPDXVersion: SPDX-2.3
+DataLicense: CC0-1.0
+SPDXID: SPDXRef-DOCUMENT
+DocumentName: example
+DocumentNamespace: https://example.com/example
+Creator: Tool: bomfactory
+Created: 2024-01-01T00:00:00Z
+`
+)
+
+func TestValidateSBOMData(t *testing.T) {
+	tests := []struct {
+		name  string
+		file  string
+		data  string
+		valid bool
+	}{
+		{"CycloneDX JSON", "org_repo.cdx.json", cycloneDXJSON, true},
+		{"CycloneDX JSON under the default name", "org_repo.sbom.json", cycloneDXJSON, true},
+		{"invalid JSON", "org_repo.cdx.json", `{"bomFormat": `, false},
+		{"CycloneDX XML", "org_repo.cdx.xml", cycloneDXXML, true},
+		{"XML of another schema", "org_repo.cdx.xml", `<bom xmlns="http://example.com/bom"></bom>`, false},
+		{"XML with another root", "org_repo.cdx.xml", `<project xmlns="http://cyclonedx.org/schema/bom/1.5"></project>`, false},
+		{"JSON named as XML", "org_repo.cdx.xml", cycloneDXJSON, false},
+		{"SPDX tag-value", "org_repo.spdx", spdxTagValue, true},
+		{"empty tag-value", "org_repo.spdx", "", false},
+		{"JSON named as tag-value", "org_repo.spdx", cycloneDXJSON, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateSBOMData(test.file, []byte(test.data))
+			if test.valid && err != nil {
+				t.Errorf("ValidateSBOMData failed: %v", err)
+			}
+			if !test.valid && err == nil {
+				t.Error("ValidateSBOMData succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestValidateSBOMCompressed(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "org_repo.cdx.xml")
+	if err := os.WriteFile(file, []byte(cycloneDXXML), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSBOM(file); err != nil {
+		t.Fatal(err)
+	}
+	// The format is recognized by the name without the compression extension
+	compressed := filepath.Join(dir, "org_repo.spdx.gz")
+	if err := compress.WriteFile(compressed, []byte(spdxTagValue), compress.Gzip, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateSBOM(compressed); err != nil {
+		t.Fatal(err)
+	}
+}
+
+const spdxJSONWithFiles = `{
+  "spdxVersion": "SPDX-2.3",
+  "dataLicense": "CC0-1.0",
+  "SPDXID": "SPDXRef-DOCUMENT",
+  "name": "github.com/org/app",
+  "documentNamespace": "https://example.com/app",
+  "creationInfo": {"created": "2024-01-01T00:00:00Z", "creators": ["Tool: bomfactory"]},
+  "packages": [
+    {"name": "github.com/org/app", "SPDXID": "SPDXRef-DocumentRoot", "downloadLocation": "NOASSERTION"},
+    {"name": "golang.org/x/text", "SPDXID": "SPDXRef-Package-text", "versionInfo": "v0.14.0", "downloadLocation": "NOASSERTION",
+      "externalRefs": [{"referenceCategory": "PACKAGE-MANAGER", "referenceType": "purl", "referenceLocator": "pkg:golang/golang.org/x/text@v0.14.0"}]},
+    {"name": "zlib", "SPDXID": "SPDXRef-Package-zlib", "versionInfo": "1.3", "downloadLocation": "NOASSERTION"}
+  ],
+  "files": [
+    {"fileName": "/go.mod", "SPDXID": "SPDXRef-File-go.mod", "checksums": [{"algorithm": "SHA1", "checksumValue": "0000000000000000000000000000000000000000"}]}
+  ],
+  "relationships": [
+    {"spdxElementId": "SPDXRef-DOCUMENT", "relationshipType": "DESCRIBES", "relatedSpdxElement": "SPDXRef-DocumentRoot"}
+  ]
+}`
+
+func TestComponents(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "org_app.spdx.json")
+	if err := os.WriteFile(file, []byte(spdxJSONWithFiles), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	components, err := Components(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The root package and the file are left out
+	want := []string{"pkg:golang/golang.org/x/text@v0.14.0", "zlib@1.3"}
+	if !reflect.DeepEqual(components, want) {
+		t.Errorf("Components = %v, want %v", components, want)
+	}
+}
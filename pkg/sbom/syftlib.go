@@ -0,0 +1,264 @@
+package sbom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime/debug"
+	"sort"
+	"strings"
+
+	"github.com/anchore/syft/syft"
+	"github.com/anchore/syft/syft/cataloging/pkgcataloging"
+	"github.com/anchore/syft/syft/file"
+	"github.com/anchore/syft/syft/format"
+	syftsbom "github.com/anchore/syft/syft/sbom"
+	"github.com/anchore/syft/syft/source"
+	"github.com/anchore/syft/syft/source/directorysource"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+const syftModulePath = "github.com/anchore/syft"
+
+// ScanError is returned when a stage of an in-process scan fails.
+type ScanError struct {
+	Stage string // "source", "catalog" or "encode"
+	Err   error
+}
+
+func (e *ScanError) Error() string {
+	return fmt.Sprintf("syft %s failed: %v", e.Stage, e.Err)
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// scanFailed returns a ScanError classified as a scanner failure.
+func scanFailed(stage string, err error) error {
+	return retry.Classify(retry.ClassScanner, &ScanError{Stage: stage, Err: err})
+}
+
+// Warning is a non-fatal problem reported while scanning, such as a file a cataloger could not parse.
+type Warning struct {
+	Location string
+	Message  string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s: %s", w.Location, w.Message)
+}
+
+// SyftLibrary generates SBOMs in-process using syft as a Go library,
+// so no syft binary is needed.
+type SyftLibrary struct {
+	// Catalogers selects catalogers using syft's expressions, e.g. "+sbom-cataloger" or "-go-module-binary-cataloger".
+	Catalogers []string
+}
+
+// Name returns the name of the generator.
+func (s *SyftLibrary) Name() string {
+	return "syft-lib"
+}
+
+// Version returns the version of the syft library compiled into bomfactory.
+func (s *SyftLibrary) Version(_ context.Context) (string, error) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", fmt.Errorf("failed to read build information")
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == syftModulePath {
+			if dep.Replace != nil {
+				return strings.TrimPrefix(dep.Replace.Version, "v"), nil
+			}
+			return strings.TrimPrefix(dep.Version, "v"), nil
+		}
+	}
+	return "", fmt.Errorf("%s is not part of the build", syftModulePath)
+}
+
+// Formats returns the output formats the syft library can produce.
+func (s *SyftLibrary) Formats() []Format {
+	return Formats
+}
+
+// Generate scans the requested directory in-process, writing all outputs from a single scan.
+func (s *SyftLibrary) Generate(ctx context.Context, req Request) error {
+	encoders := format.NewEncoderCollection(format.Encoders()...)
+	selected := make([]syftsbom.FormatEncoder, 0, len(req.Outputs))
+	for _, output := range req.Outputs {
+		encoder := encoders.GetByString(string(output.Format))
+		if encoder == nil {
+			return scanFailed("encode", fmt.Errorf("no encoder for format %s", output.Format))
+		}
+		selected = append(selected, encoder)
+	}
+
+	dirSource, err := directorysource.New(directorysource.Config{
+		Path:  req.Directory,
+		Alias: source.Alias{Name: req.SourceName, Version: req.SourceVersion},
+	})
+	if err != nil {
+		return scanFailed("source", err)
+	}
+	defer dirSource.Close()
+	src := cancelableSource{Source: dirSource, ctx: ctx}
+
+	cfg := syft.DefaultCreateSBOMConfig()
+	if version, err := s.Version(ctx); err == nil {
+		cfg = cfg.WithTool("syft", version)
+	}
+	if len(s.Catalogers) > 0 {
+		cfg = cfg.WithCatalogerSelection(pkgcataloging.NewSelectionRequest().WithExpression(s.Catalogers...))
+	}
+
+	// Once the context is done the source fails every file access, so the catalogers still running
+	// return early. The scan is waited for, since the source and directory are removed afterwards.
+	result, err := syft.CreateSBOM(ctx, src, cfg)
+	if ctx.Err() != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return timedOut("syft")
+		}
+		return scanFailed("catalog", ctx.Err())
+	}
+	if err != nil {
+		return scanFailed("catalog", err)
+	}
+
+	if req.OnWarning != nil {
+		for _, warning := range unknownsToWarnings(result) {
+			req.OnWarning(warning)
+		}
+	}
+
+	for i, output := range req.Outputs {
+		if err := writeEncoded(output.File, selected[i], result); err != nil {
+			return scanFailed("encode", err)
+		}
+	}
+
+	return nil
+}
+
+// cancelableSource is a source whose files can no longer be found or read once ctx is done. syft
+// does not check for cancellation between catalogers, but they all access files through the source.
+type cancelableSource struct {
+	source.Source
+	ctx context.Context
+}
+
+func (s cancelableSource) FileResolver(scope source.Scope) (file.Resolver, error) {
+	resolver, err := s.Source.FileResolver(scope)
+	if err != nil {
+		return nil, err
+	}
+	return cancelableResolver{Resolver: resolver, ctx: s.ctx}, nil
+}
+
+type cancelableResolver struct {
+	file.Resolver
+	ctx context.Context
+}
+
+func (r cancelableResolver) FileContentsByLocation(location file.Location) (io.ReadCloser, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Resolver.FileContentsByLocation(location)
+}
+
+func (r cancelableResolver) FileMetadataByLocation(location file.Location) (file.Metadata, error) {
+	if err := r.ctx.Err(); err != nil {
+		return file.Metadata{}, err
+	}
+	return r.Resolver.FileMetadataByLocation(location)
+}
+
+func (r cancelableResolver) HasPath(path string) bool {
+	return r.ctx.Err() == nil && r.Resolver.HasPath(path)
+}
+
+func (r cancelableResolver) FilesByPath(paths ...string) ([]file.Location, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Resolver.FilesByPath(paths...)
+}
+
+func (r cancelableResolver) FilesByGlob(patterns ...string) ([]file.Location, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Resolver.FilesByGlob(patterns...)
+}
+
+func (r cancelableResolver) FilesByMIMEType(types ...string) ([]file.Location, error) {
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return r.Resolver.FilesByMIMEType(types...)
+}
+
+func (r cancelableResolver) RelativeFileByPath(location file.Location, path string) *file.Location {
+	if r.ctx.Err() != nil {
+		return nil
+	}
+	return r.Resolver.RelativeFileByPath(location, path)
+}
+
+func (r cancelableResolver) AllLocations(ctx context.Context) <-chan file.Location {
+	// The resolver stops listing locations once either context is done. Locations it lists
+	// while noticing are dropped, so none are passed on after the scan was canceled.
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(r.ctx, cancel)
+	locations := make(chan file.Location)
+	go func() {
+		defer close(locations)
+		defer cancel()
+		defer stop()
+		for location := range r.Resolver.AllLocations(ctx) {
+			if ctx.Err() != nil || r.ctx.Err() != nil {
+				continue
+			}
+			select {
+			case locations <- location:
+			case <-ctx.Done():
+			case <-r.ctx.Done():
+			}
+		}
+	}()
+	return locations
+}
+
+func writeEncoded(path string, encoder syftsbom.FormatEncoder, s *syftsbom.SBOM) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create SBOM file: %w", err)
+	}
+	if err := encoder.Encode(file, *s); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode %s: %w", encoder.ID(), err)
+	}
+	return file.Close()
+}
+
+// unknownsToWarnings converts the cataloging errors syft recorded per file into warnings.
+func unknownsToWarnings(s *syftsbom.SBOM) []Warning {
+	var warnings []Warning
+	for coordinates, messages := range s.Artifacts.Unknowns {
+		for _, message := range messages {
+			warnings = append(warnings, Warning{Location: coordinates.RealPath, Message: message})
+		}
+	}
+	sort.Slice(warnings, func(i, j int) bool {
+		if warnings[i].Location != warnings[j].Location {
+			return warnings[i].Location < warnings[j].Location
+		}
+		return warnings[i].Message < warnings[j].Message
+	})
+	return warnings
+}
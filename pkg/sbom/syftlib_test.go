@@ -0,0 +1,225 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	cyclonedx "github.com/CycloneDX/cyclonedx-go"
+	"github.com/anchore/syft/syft/file"
+	syftsbom "github.com/anchore/syft/syft/sbom"
+	"github.com/anchore/syft/syft/source"
+	"github.com/anchore/syft/syft/source/directorysource"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+const fixtureGoMod = `module example.com/app
+
+go 1.22
+
+require (
+	github.com/google/uuid v1.6.0
+	golang.org/x/text v0.14.0
+)
+`
+
+// goModuleFixture writes a directory holding a go.mod with two dependencies
+func goModuleFixture(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(fixtureGoMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestSyftLibraryGenerate(t *testing.T) {
+	dir, outDir := goModuleFixture(t), t.TempDir()
+	generator := &SyftLibrary{}
+	req := Request{Directory: dir, SourceName: "github.com/org/app", SourceVersion: "v1.2.3"}
+	for _, format := range generator.Formats() {
+		req.Outputs = append(req.Outputs, Output{Format: format, File: filepath.Join(outDir, strings.ReplaceAll(string(format), "@", "-"))})
+	}
+	if err := generator.Generate(context.Background(), req); err != nil {
+		t.Fatal(err)
+	}
+
+	wantComponents := []string{"pkg:golang/github.com/google/uuid@v1.6.0", "pkg:golang/golang.org/x/text@v0.14.0"}
+	for _, output := range req.Outputs {
+		t.Run(string(output.Format), func(t *testing.T) {
+			data := readFile(t, output.File)
+			if !bytes.Contains(data, []byte(req.SourceName)) || !bytes.Contains(data, []byte(req.SourceVersion)) {
+				t.Errorf("SBOM does not name the source %s %s", req.SourceName, req.SourceVersion)
+			}
+			if !bytes.Contains(data, []byte("golang.org/x/text")) {
+				t.Error("SBOM does not list the dependencies")
+			}
+			if output.Format.Readable() {
+				components, err := Components(output.File)
+				if err != nil {
+					t.Fatal(err)
+				}
+				sort.Strings(components)
+				if !reflect.DeepEqual(components, wantComponents) {
+					t.Errorf("components = %v, want %v", components, wantComponents)
+				}
+			}
+			if output.Format == FormatCycloneDXJSON16 {
+				var bom cyclonedx.BOM
+				if err := cyclonedx.NewBOMDecoder(bytes.NewReader(data), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+					t.Fatal(err)
+				}
+				if bom.SpecVersion != cyclonedx.SpecVersion1_6 {
+					t.Errorf("spec version = %s, want 1.6", bom.SpecVersion)
+				}
+			}
+		})
+	}
+}
+
+func TestSyftLibraryGenerateUnknownFormat(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "app.sbom")
+	err := (&SyftLibrary{}).Generate(context.Background(), Request{
+		Directory: goModuleFixture(t),
+		Outputs:   []Output{{Format: "cyclonedx-json@0.1", File: output}},
+	})
+	var scanErr *ScanError
+	if !errors.As(err, &scanErr) || scanErr.Stage != "encode" {
+		t.Fatalf("Generate = %v, want an encode error", err)
+	}
+	if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Error("output was written although its format is unknown")
+	}
+}
+
+func TestSyftLibraryGenerateCanceled(t *testing.T) {
+	dir := goModuleFixture(t)
+	// Enough files that a scan ignoring the cancellation would be noticeably slower
+	for i := 0; i < 200; i++ {
+		module := filepath.Join(dir, "modules", fmt.Sprintf("m%d", i))
+		if err := os.MkdirAll(module, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(module, "go.mod"), []byte(fixtureGoMod), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithTimeout(context.Background(), -time.Second)
+	defer cancelExpired()
+
+	tests := []struct {
+		name      string
+		ctx       context.Context
+		wantClass retry.Class
+	}{
+		{name: "canceled", ctx: canceled, wantClass: retry.ClassScanner},
+		{name: "deadline exceeded", ctx: expired, wantClass: retry.ClassTimeout},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "app.cdx.json")
+			start := time.Now()
+			err := (&SyftLibrary{}).Generate(test.ctx, Request{
+				Directory: dir,
+				Outputs:   []Output{{Format: DefaultFormat, File: output}},
+			})
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Generate returned after %s", elapsed)
+			}
+			if err == nil || retry.ClassOf(err) != test.wantClass {
+				t.Fatalf("Generate = %v (%s), want a %s error", err, retry.ClassOf(err), test.wantClass)
+			}
+			if test.wantClass == retry.ClassTimeout && !errors.Is(err, ErrTimeout) {
+				t.Errorf("Generate = %v, want ErrTimeout", err)
+			}
+			if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+				t.Error("output was written although the scan was canceled")
+			}
+		})
+	}
+}
+
+func TestCancelableResolver(t *testing.T) {
+	dirSource, err := directorysource.New(directorysource.Config{Path: goModuleFixture(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dirSource.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	resolver, err := cancelableSource{Source: dirSource, ctx: ctx}.FileResolver(source.SquashedScope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	locations, err := resolver.FilesByPath("/go.mod")
+	if err != nil || len(locations) != 1 || !resolver.HasPath("/go.mod") {
+		t.Fatalf("FilesByPath = %v, %v before cancellation", locations, err)
+	}
+	contents, err := resolver.FileContentsByLocation(locations[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents.Close()
+
+	cancel()
+	if _, err := resolver.FilesByPath("/go.mod"); !errors.Is(err, context.Canceled) {
+		t.Errorf("FilesByPath = %v after cancellation", err)
+	}
+	if _, err := resolver.FilesByGlob("**/go.mod"); !errors.Is(err, context.Canceled) {
+		t.Errorf("FilesByGlob = %v after cancellation", err)
+	}
+	if _, err := resolver.FileContentsByLocation(locations[0]); !errors.Is(err, context.Canceled) {
+		t.Errorf("FileContentsByLocation = %v after cancellation", err)
+	}
+	if _, err := resolver.FileMetadataByLocation(locations[0]); !errors.Is(err, context.Canceled) {
+		t.Errorf("FileMetadataByLocation = %v after cancellation", err)
+	}
+	if resolver.HasPath("/go.mod") || resolver.RelativeFileByPath(locations[0], "/go.mod") != nil {
+		t.Error("files are found after cancellation")
+	}
+	for location := range resolver.AllLocations(context.Background()) {
+		t.Errorf("AllLocations listed %s after cancellation", location.RealPath)
+	}
+}
+
+func TestUnknownsToWarnings(t *testing.T) {
+	var s syftsbom.SBOM
+	if warnings := unknownsToWarnings(&s); warnings != nil {
+		t.Errorf("warnings without unknowns = %v", warnings)
+	}
+	s.Artifacts.Unknowns = map[file.Coordinates][]string{
+		{RealPath: "/web/package-lock.json"}: {"unable to parse lock file"},
+		{RealPath: "/go.mod"}:                {"unknown directive", "invalid version"},
+	}
+	want := []Warning{
+		{Location: "/go.mod", Message: "invalid version"},
+		{Location: "/go.mod", Message: "unknown directive"},
+		{Location: "/web/package-lock.json", Message: "unable to parse lock file"},
+	}
+	if got := unknownsToWarnings(&s); !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownsToWarnings = %v, want %v", got, want)
+	}
+}
+
+func TestSyftLibraryVersion(t *testing.T) {
+	version, err := (&SyftLibrary{}).Version(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The version of the syft module in go.mod
+	if version != "1.14.2" {
+		t.Errorf("Version = %q, want 1.14.2", version)
+	}
+}
@@ -0,0 +1,40 @@
+package sbom
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// ErrTimeout is returned when an SBOM generation exceeds its time budget.
+var ErrTimeout = errors.New("SBOM generation timed out")
+
+// timedOut returns the error for a tool that exceeded its time budget.
+func timedOut(tool string) error {
+	return retry.Classify(retry.ClassTimeout, fmt.Errorf("%w: %s did not finish in time", ErrTimeout, tool))
+}
+
+// TimeoutPolicy decides the time budget of an SBOM generation.
+type TimeoutPolicy struct {
+	Default   time.Duration            // Timeout used when no language specific timeout applies
+	PerMB     time.Duration            // Additional time per MB of the scanned directory
+	Languages map[string]time.Duration // Timeouts by lower case repository language
+}
+
+// Timeout returns the time budget for scanning a repository of the given language and size in bytes.
+func (p TimeoutPolicy) Timeout(language string, size int64) time.Duration {
+	timeout := p.Default
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	if languageTimeout := p.Languages[strings.ToLower(language)]; languageTimeout > 0 {
+		timeout = languageTimeout
+	}
+	if p.PerMB > 0 && size > 0 {
+		timeout += time.Duration(float64(p.PerMB) * float64(size) / (1 << 20))
+	}
+	return timeout
+}
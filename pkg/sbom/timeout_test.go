@@ -0,0 +1,40 @@
+package sbom
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeoutPolicy(t *testing.T) {
+	const mb = 1 << 20
+	policy := TimeoutPolicy{
+		Default:   5 * time.Minute,
+		PerMB:     time.Second,
+		Languages: map[string]time.Duration{"java": 10 * time.Minute, "go": 0},
+	}
+	tests := []struct {
+		name     string
+		policy   TimeoutPolicy
+		language string
+		size     int64
+		want     time.Duration
+	}{
+		{name: "fallback", want: DefaultTimeout},
+		{name: "fallback with a language", language: "Java", want: DefaultTimeout},
+		{name: "default", policy: policy, language: "Python", want: 5 * time.Minute},
+		{name: "per language", policy: policy, language: "java", want: 10 * time.Minute},
+		{name: "language of another case", policy: policy, language: "JAVA", want: 10 * time.Minute},
+		{name: "zero language timeout", policy: policy, language: "Go", want: 5 * time.Minute},
+		{name: "per MB", policy: policy, size: 30 * mb, want: 5*time.Minute + 30*time.Second},
+		{name: "per MB of a fraction", policy: policy, size: mb / 2, want: 5*time.Minute + 500*time.Millisecond},
+		{name: "per MB with a language", policy: policy, language: "Java", size: 60 * mb, want: 11 * time.Minute},
+		{name: "per MB without a policy", policy: TimeoutPolicy{PerMB: time.Second}, size: 10 * mb, want: DefaultTimeout + 10*time.Second},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.policy.Timeout(test.language, test.size); got != test.want {
+				t.Errorf("Timeout(%q, %d) = %s, want %s", test.language, test.size, got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package sbom
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	cyclonedx "github.com/CycloneDX/cyclonedx-go"
+	spdxjson "github.com/spdx/tools-golang/json"
+	"github.com/spdx/tools-golang/spdx"
+	"github.com/spdx/tools-golang/spdx/v2/common"
+	"github.com/spdx/tools-golang/tagvalue"
+
+	"github.com/bit-bom/bom-factory/pkg/retry"
+)
+
+// Trivy generates SBOMs with the trivy binary.
+type Trivy struct {
+	version toolVersion
+}
+
+// Name returns the name of the tool.
+func (t *Trivy) Name() string {
+	return "trivy"
+}
+
+// Version returns the version of the trivy binary.
+func (t *Trivy) Version(ctx context.Context) (string, error) {
+	return t.version.get(ctx, "trivy", "--version")
+}
+
+// trivyFormats maps output formats to trivy's format names.
+var trivyFormats = map[Format]string{
+	FormatCycloneDXJSON15: "cyclonedx",
+	FormatCycloneDXJSON16: "cyclonedx",
+	FormatSPDXJSON:        "spdx-json",
+	FormatSPDXTagValue:    "spdx",
+}
+
+// cycloneDXSpecVersions maps the CycloneDX formats to their spec versions.
+var cycloneDXSpecVersions = map[Format]cyclonedx.SpecVersion{
+	FormatCycloneDXJSON15: cyclonedx.SpecVersion1_5,
+	FormatCycloneDXJSON16: cyclonedx.SpecVersion1_6,
+}
+
+// Formats returns the output formats trivy can produce.
+func (t *Trivy) Formats() []Format {
+	return []Format{FormatCycloneDXJSON15, FormatCycloneDXJSON16, FormatSPDXJSON, FormatSPDXTagValue}
+}
+
+// Generate scans the requested directory with trivy, once per output since it writes a single format.
+// Trivy names the SBOM after the scanned directory, so every output is rewritten with the source name
+// and version of the request.
+func (t *Trivy) Generate(ctx context.Context, req Request) error {
+	for _, output := range req.Outputs {
+		err := runTool(ctx, "trivy", "fs", "--quiet", "--format", trivyFormats[output.Format], "--output", output.File, req.Directory)
+		if err != nil {
+			return err
+		}
+		if err := nameTrivyOutput(output, req.SourceName, req.SourceVersion); err != nil {
+			return retry.Classify(retry.ClassScanner, fmt.Errorf("failed to rewrite SBOM written by trivy: %w", err))
+		}
+	}
+	return nil
+}
+
+// nameTrivyOutput records the source name and version in an SBOM written by trivy.
+// CycloneDX SBOMs are also written in the spec version of the format, since the version trivy
+// writes depends on its release.
+func nameTrivyOutput(output Output, sourceName, sourceVersion string) error {
+	data, err := os.ReadFile(output.File)
+	if err != nil {
+		return err
+	}
+
+	var rewritten bytes.Buffer
+	switch output.Format {
+	case FormatCycloneDXJSON15, FormatCycloneDXJSON16:
+		var bom cyclonedx.BOM
+		if err := cyclonedx.NewBOMDecoder(bytes.NewReader(data), cyclonedx.BOMFileFormatJSON).Decode(&bom); err != nil {
+			return err
+		}
+		if bom.Metadata == nil {
+			bom.Metadata = &cyclonedx.Metadata{}
+		}
+		if bom.Metadata.Component == nil {
+			bom.Metadata.Component = &cyclonedx.Component{Type: cyclonedx.ComponentTypeApplication}
+		}
+		bom.Metadata.Component.Name = sourceName
+		bom.Metadata.Component.Version = sourceVersion
+		encoder := cyclonedx.NewBOMEncoder(&rewritten, cyclonedx.BOMFileFormatJSON).SetPretty(true)
+		if err := encoder.EncodeVersion(&bom, cycloneDXSpecVersions[output.Format]); err != nil {
+			return err
+		}
+	case FormatSPDXJSON:
+		document, err := spdxjson.Read(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		nameSPDXDocument(document, sourceName, sourceVersion)
+		if err := spdxjson.Write(document, &rewritten, spdxjson.Indent("  ")); err != nil {
+			return err
+		}
+	case FormatSPDXTagValue:
+		document, err := tagvalue.Read(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		nameSPDXDocument(document, sourceName, sourceVersion)
+		if err := tagvalue.Write(document, &rewritten); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported format %s", output.Format)
+	}
+	return os.WriteFile(output.File, rewritten.Bytes(), 0o644) //nolint:gosec // SBOMs are not secret
+}
+
+// nameSPDXDocument names an SPDX document and the packages it describes after the source.
+func nameSPDXDocument(document *spdx.Document, sourceName, sourceVersion string) {
+	document.DocumentName = sourceName
+	described := make(map[common.ElementID]bool)
+	for _, relationship := range document.Relationships {
+		if relationship.RefA.ElementRefID == "DOCUMENT" && relationship.Relationship == common.TypeRelationshipDescribe {
+			described[relationship.RefB.ElementRefID] = true
+		}
+	}
+	for _, pkg := range document.Packages {
+		if described[pkg.PackageSPDXIdentifier] {
+			pkg.PackageName = sourceName
+			pkg.PackageVersion = sourceVersion
+		}
+	}
+}
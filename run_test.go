@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/manifest"
+	"github.com/bit-bom/bom-factory/pkg/metrics"
+	"github.com/bit-bom/bom-factory/pkg/progress"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// fakeGenerator writes an empty CycloneDX document for every output. Scans of sources listed in
+// block wait for their context to be done instead, after writing the outputs partially.
+type fakeGenerator struct {
+	block   map[string]bool
+	started chan string     // Receives the source name of every blocked scan once it started
+	fail    map[string]bool // Sources whose scans fail
+}
+
+func (g *fakeGenerator) Name() string {
+	return "fake"
+}
+
+func (g *fakeGenerator) Version(context.Context) (string, error) {
+	return "1.0.0", nil
+}
+
+func (g *fakeGenerator) Formats() []sbom.Format {
+	return sbom.Formats
+}
+
+func (g *fakeGenerator) Generate(ctx context.Context, req sbom.Request) error {
+	if g.fail[req.SourceName] {
+		return retry.Classify(retry.ClassScanner, errors.New("scanner crashed"))
+	}
+	for _, output := range req.Outputs {
+		content := `{"bomFormat": "CycloneDX", "specVersion": "1.5", "version": 1, "components": []}`
+		if g.block[req.SourceName] {
+			content = content[:20]
+		}
+		if err := os.WriteFile(output.File, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+	if g.block[req.SourceName] {
+		g.started <- req.SourceName
+		<-ctx.Done()
+		return retry.Classify(retry.ClassScanner, ctx.Err())
+	}
+	return nil
+}
+
+// newOrigin creates a repository with a single commit at dir/owner/name and returns its file URL
+func newOrigin(t *testing.T, dir, owner, name string) string {
+	t.Helper()
+	path := filepath.Join(dir, owner, name)
+	repo, err := git.PlainInit(path, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "go.mod"), []byte("module example.com/"+name), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := worktree.Add("go.mod"); err != nil {
+		t.Fatal(err)
+	}
+	signature := &object.Signature{Name: "test", Email: "test@example.com", When: time.Now()}
+	if _, err := worktree.Commit("add go.mod", &git.CommitOptions{Author: signature}); err != nil {
+		t.Fatal(err)
+	}
+	return "file://" + filepath.ToSlash(path)
+}
+
+// sbomFile returns the file the SBOM of a repository is written to in the default format
+func sbomFile(t *testing.T, repoURL string, options sbomOptions) string {
+	t.Helper()
+	outputs, err := sbomOutputs(&csv.RepoData{RepoURL: repoURL}, "", true, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return outputs[0].File
+}
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := jobs.CreateTable(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// testOptions returns the options of a run writing to temporary directories without progress reporting
+func testOptions(t *testing.T) sbomOptions {
+	t.Helper()
+	return sbomOptions{
+		Dir:         filepath.Join(t.TempDir(), "sbom"),
+		TempDir:     t.TempDir(),
+		Concurrency: 2,
+		Formats:     []sbom.Format{sbom.DefaultFormat},
+		Timeouts:    sbom.TimeoutPolicy{Default: time.Minute},
+		Retry:       retry.Policy{MaxAttempts: 1},
+		Progress:    progress.ModeNone,
+	}
+}
+
+// runSBOMs runs download-sbom for the repositories and returns the jobs of the run
+func runSBOMs(ctx context.Context, t *testing.T, db *sql.DB, options sbomOptions, repoURLs ...string) ([]jobs.Job, error) {
+	t.Helper()
+	repos := make([]csv.RepoData, 0, len(repoURLs))
+	for _, repoURL := range repoURLs {
+		repos = append(repos, csv.RepoData{RepoURL: repoURL})
+	}
+	tasks, err := newSBOMTasks(db, jobs.CommandDownloadSBOM, repos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runErr := generateSBOMs(ctx, db, tasks, options)
+	runJobs, err := jobs.ForRun(db, tasks[0].Job.RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return runJobs, runErr
+}
+
+func TestPermanentFailuresAreSkipped(t *testing.T) {
+	db := openTestDB(t)
+	missing := "file://" + filepath.ToSlash(filepath.Join(t.TempDir(), "org", "missing"))
+	options := testOptions(t)
+	// The clone fails before the generator runs
+	options.Generator = &sbom.SyftLibrary{}
+
+	checkRun := func(options sbomOptions, want jobs.Status) {
+		t.Helper()
+		runJobs, err := runSBOMs(context.Background(), t, db, options, missing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job := runJobs[0]; job.Status != want {
+			t.Errorf("job of %s is %s (%s), want %s", missing, job.Status, job.Error, want)
+		}
+	}
+	checkRun(options, jobs.StatusFailed)
+	// Later runs skip the repository, also when an earlier run skipped it already
+	checkRun(options, jobs.StatusSkipped)
+	checkRun(options, jobs.StatusSkipped)
+
+	options.Force = true
+	checkRun(options, jobs.StatusFailed)
+}
+
+func TestInterruptedRunLeavesJobsPending(t *testing.T) {
+	db := openTestDB(t)
+	origins := t.TempDir()
+	var repoURLs []string
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		repoURLs = append(repoURLs, newOrigin(t, origins, "org", name))
+	}
+	generator := &fakeGenerator{block: map[string]bool{}, started: make(chan string)}
+	for _, repoURL := range repoURLs[1:3] {
+		generator.block[repoURL] = true
+	}
+	options := testOptions(t)
+	options.Concurrency = 1
+	options.Generator = generator
+
+	// Interrupt the run once the first blocked scan started
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		<-generator.started
+		cancel()
+	}()
+	runJobs, err := runSBOMs(ctx, t, db, options, repoURLs...)
+	if err == nil || !strings.Contains(err.Error(), "was interrupted") {
+		t.Errorf("generateSBOMs = %v, want an interrupted run", err)
+	}
+
+	want := []jobs.Status{jobs.StatusSucceeded, jobs.StatusPending, jobs.StatusPending, jobs.StatusPending, jobs.StatusPending}
+	for i, job := range runJobs {
+		if job.Status != want[i] {
+			t.Errorf("job of %s is %s (%s), want %s", job.RepoURL, job.Status, job.Error, want[i])
+		}
+	}
+	if runJobs[1].Error != "interrupted" || runJobs[1].ErrorClass != "" {
+		t.Errorf("interrupted job recorded error %q of class %q", runJobs[1].Error, runJobs[1].ErrorClass)
+	}
+
+	// Only the SBOM of the finished job and the manifest are written
+	var files []string
+	err = filepath.WalkDir(options.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() {
+			files = append(files, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 || !manifest.IsManifest(files[0]) || files[1] != sbomFile(t, repoURLs[0], options) {
+		t.Errorf("SBOM directory holds %v, want the SBOM of %s and the manifest", files, repoURLs[0])
+	}
+
+	// Resuming the run finishes the pending jobs
+	if _, err := db.Exec("CREATE TABLE repos (repo_url TEXT, repo_language TEXT)"); err != nil {
+		t.Fatal(err)
+	}
+	resumed, err := resumeSBOMTasks(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resumed) != 4 {
+		t.Fatalf("resuming the run picks up %d jobs, want 4", len(resumed))
+	}
+	generator.block = nil
+	if err := generateSBOMs(context.Background(), db, resumed, options); err != nil {
+		t.Fatal(err)
+	}
+	finished, err := jobs.ForRun(db, runJobs[0].RunID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, job := range finished {
+		if job.Status != jobs.StatusSucceeded {
+			t.Errorf("resumed job of %s is %s (%s)", job.RepoURL, job.Status, job.Error)
+		}
+	}
+	if _, err := os.Stat(sbomFile(t, repoURLs[1], options)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRunMetrics(t *testing.T) {
+	db := openTestDB(t)
+	origins := t.TempDir()
+	succeeding, failing := newOrigin(t, origins, "org", "a"), newOrigin(t, origins, "org", "b")
+	missing := "file://" + filepath.ToSlash(filepath.Join(origins, "org", "missing"))
+	options := testOptions(t)
+	options.Generator = &fakeGenerator{fail: map[string]bool{failing: true}}
+	options.Retry = retry.Policy{MaxAttempts: 2}
+	options.Metrics = metrics.New()
+
+	if _, err := runSBOMs(context.Background(), t, db, options, succeeding, failing, missing); err != nil {
+		t.Fatal(err)
+	}
+
+	m := options.Metrics
+	counters := []struct {
+		name   string
+		metric prometheus.Collector
+		want   float64
+	}{
+		{"succeeded jobs", m.Jobs.WithLabelValues(string(jobs.StatusSucceeded)), 1},
+		// The missing repository fails to resolve its ref before any clone or scan is attempted
+		{"failed jobs", m.Jobs.WithLabelValues(string(jobs.StatusFailed)), 2},
+		{"skipped jobs", m.Jobs.WithLabelValues(string(jobs.StatusSkipped)), 0},
+		// Scanner failures are not retried, so a single failed attempt is counted
+		{"scanner errors", m.GeneratorErrors.WithLabelValues(string(retry.ClassScanner)), 1},
+		{"active workers", m.ActiveWorkers, 0},
+	}
+	for _, counter := range counters {
+		if got := testutil.ToFloat64(counter.metric); got != counter.want {
+			t.Errorf("%s = %v, want %v", counter.name, got, counter.want)
+		}
+	}
+	if got := testutil.ToFloat64(m.BytesCloned); got <= 0 {
+		t.Errorf("cloned bytes = %v, want the size of two clones", got)
+	}
+
+	histograms := []struct {
+		name      string
+		histogram prometheus.Observer
+		want      uint64
+	}{
+		{"clone duration", m.CloneDuration, 2},
+		{"scan duration", m.ScanDuration.WithLabelValues("fake"), 2},
+	}
+	for _, histogram := range histograms {
+		var metric dto.Metric
+		if err := histogram.histogram.(prometheus.Metric).Write(&metric); err != nil {
+			t.Fatal(err)
+		}
+		if got := metric.GetHistogram().GetSampleCount(); got != histogram.want {
+			t.Errorf("%s has %d samples, want %d", histogram.name, got, histogram.want)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bit-bom/bom-factory/pkg/bundle"
+	"github.com/bit-bom/bom-factory/pkg/compress"
+	"github.com/bit-bom/bom-factory/pkg/manifest"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+)
+
+// sbomExtensions end the names of SBOM files, the JSON formats share .json
+var sbomExtensions = []string{".json", sbom.FormatCycloneDXXML.Extension(), sbom.FormatSPDXTagValue.Extension()}
+
+// sbomFiles returns the SBOM files, which may be compressed, and the bundles below dir.
+// Run manifests and sparse checkout comparisons are not SBOMs and are left out.
+func sbomFiles(dir string) (files, bundles []string, err error) {
+	err = filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if bundle.IsBundle(file) {
+			bundles = append(bundles, file)
+		} else if isSBOMFile(file) {
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read directory: %w", err)
+	}
+	return files, bundles, nil
+}
+
+// isSBOMFile reports whether a file or bundle entry is an SBOM, which may be compressed
+func isSBOMFile(name string) bool {
+	name = path.Base(filepath.ToSlash(compress.TrimExtension(name)))
+	if manifest.IsManifest(name) || strings.HasSuffix(name, compareReportSuffix) {
+		return false
+	}
+	for _, extension := range sbomExtensions {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// isJSONSBOMFile reports whether a file or bundle entry is an SBOM in JSON, which may be compressed,
+// and may therefore be an SPDX JSON document to add PURLs to
+func isJSONSBOMFile(name string) bool {
+	return isSBOMFile(name) && strings.HasSuffix(compress.TrimExtension(name), ".json")
+}
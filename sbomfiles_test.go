@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSBOMFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"org_repo.cdx.json",
+		"org_repo.spdx.json.gz",
+		"org_repo.cdx.xml",
+		"org_repo.spdx",
+		// History writes a directory per repository, nested and sharded layouts deeper ones
+		"org_repo/v1.0.0.cdx.json",
+		"github.com/org/repo/main.cdx.json.zst",
+		"bd/org_repo.cdx.json",
+		"corpus.tar.zst",
+		"2024/corpus.tar.zst",
+		// Files written next to the SBOMs that are not SBOMs
+		"manifest-20240101T000000.000Z.json",
+		"org_repo.sparse-compare.json",
+		"org_repo.cdx.json.partial",
+		"README.md",
+	} {
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("{}"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, bundles, err := sbomFiles(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	relative := func(paths []string) []string {
+		rel := make([]string, 0, len(paths))
+		for _, file := range paths {
+			name, err := filepath.Rel(dir, file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rel = append(rel, filepath.ToSlash(name))
+		}
+		return rel
+	}
+	wantFiles := []string{
+		"bd/org_repo.cdx.json",
+		"github.com/org/repo/main.cdx.json.zst",
+		"org_repo/v1.0.0.cdx.json",
+		"org_repo.cdx.json",
+		"org_repo.cdx.xml",
+		"org_repo.spdx",
+		"org_repo.spdx.json.gz",
+	}
+	if got := relative(files); !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("sbomFiles found SBOMs %v, want %v", got, wantFiles)
+	}
+	wantBundles := []string{"2024/corpus.tar.zst", "corpus.tar.zst"}
+	if got := relative(bundles); !reflect.DeepEqual(got, wantBundles) {
+		t.Errorf("sbomFiles found bundles %v, want %v", got, wantBundles)
+	}
+
+	if _, _, err := sbomFiles(filepath.Join(dir, "missing")); err == nil {
+		t.Error("sbomFiles of a missing directory succeeded")
+	}
+}
+
+func TestIsSBOMFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		want     bool
+		wantJSON bool
+	}{
+		{"org_repo.sbom.json", true, true},
+		{"org_repo.cdx.json", true, true},
+		{"org/repo/v1.cdx.json.gz", true, true},
+		{"org_repo.cdx.xml", true, false},
+		{"org_repo.spdx.zst", true, false},
+		{"manifest-20240101T000000.000Z.json", false, false},
+		{"org/manifest-20240101T000000.000Z.json.zst", false, false},
+		{"manifest-foo_repo.sbom.json", true, true},
+		{"org_repo.sparse-compare.json", false, false},
+		{"org_repo.txt", false, false},
+		{"org_repo.xml", false, false},
+	}
+	for _, test := range tests {
+		if got := isSBOMFile(test.name); got != test.want {
+			t.Errorf("isSBOMFile(%q) = %v, want %v", test.name, got, test.want)
+		}
+		if got := isJSONSBOMFile(test.name); got != test.wantJSON {
+			t.Errorf("isJSONSBOMFile(%q) = %v, want %v", test.name, got, test.wantJSON)
+		}
+	}
+}
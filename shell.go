@@ -0,0 +1,366 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bit-bom/bom-factory/pkg/csv"
+	"github.com/bit-bom/bom-factory/pkg/jobs"
+	"github.com/bit-bom/bom-factory/pkg/retry"
+	"github.com/bit-bom/bom-factory/pkg/sbom"
+	"github.com/peterh/liner"
+	"github.com/urfave/cli/v2"
+)
+
+const historyFileName = ".bomfactory_history"
+
+// shellCommands maps every shell command to its usage and description
+var shellCommands = map[string][2]string{
+	"filter":  {"filter <field:operator:value>", "Add a filter criterion"},
+	"filters": {"filters", "Show the current filter criteria"},
+	"unset":   {"unset <n>", "Remove the n-th filter criterion (1-based)"},
+	"clear":   {"clear", "Remove all filter criteria"},
+	"limit":   {"limit <n>", "Set the maximum number of results"},
+	"skip":    {"skip <n>", "Set the number of records to skip"},
+	"run":     {"run", "Run the query and display the results"},
+	"columns": {"columns", "List the columns of the repos table"},
+	"save":    {"save <name>", "Save the current results as a named selection"},
+	"sbom":    {"sbom [dir]", "Generate SBOMs for the current results"},
+	"help":    {"help", "Show this help"},
+	"exit":    {"exit", "Leave the shell"},
+}
+
+// shell holds the state of an interactive query session
+type shell struct {
+	db         *sql.DB
+	columns    []string
+	filters    []csv.FilterCriteria
+	maxResults int
+	skip       int
+	results    []csv.RepoData
+	ran        bool // Whether results holds the results of the current query, which may be none
+	sbom       sbomOptions
+}
+
+func runShell(c *cli.Context) error {
+	db, err := sql.Open("sqlite3", c.String("db"))
+	if err != nil {
+		return fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	defer db.Close()
+
+	columns, err := csv.RepoColumns(db)
+	if err != nil {
+		return err
+	}
+	if len(columns) == 0 {
+		return fmt.Errorf("the repos table does not exist, load a CSV file first")
+	}
+
+	generator, err := sbom.NewGenerator(c.String("generator"))
+	if err != nil {
+		return err
+	}
+
+	cfg, err := loadConfig(c)
+	if err != nil {
+		return err
+	}
+
+	mode, interval, err := progressMode(c)
+	if err != nil {
+		return err
+	}
+
+	credentials, err := credentialsFromFlags(c)
+	if err != nil {
+		return err
+	}
+
+	sh := &shell{
+		db:         db,
+		columns:    columns,
+		maxResults: c.Int("max-results"),
+		sbom: sbomOptions{
+			Dir:         c.String("dir"),
+			TempDir:     c.String("temp-dir"),
+			Concurrency: c.Int("concurrent-downloads"),
+			Generator:   generator,
+			Formats:     []sbom.Format{sbom.DefaultFormat},
+			LegacyNames: true,
+			Timeouts: sbom.TimeoutPolicy{
+				Default:   cfg.Timeouts.Default,
+				PerMB:     cfg.Timeouts.PerMB,
+				Languages: cfg.Timeouts.Languages,
+			},
+			Retry:            retry.DefaultPolicy,
+			Credentials:      credentials,
+			Progress:         mode,
+			ProgressInterval: interval,
+			Config:           cfg,
+		},
+	}
+
+	line := liner.NewLiner()
+	defer line.Close()
+	line.SetCtrlCAborts(true)
+	line.SetTabCompletionStyle(liner.TabPrints)
+	line.SetWordCompleter(sh.complete)
+
+	historyPath := historyFilePath()
+	if f, err := os.Open(historyPath); err == nil {
+		_, _ = line.ReadHistory(f)
+		f.Close()
+	}
+	defer func() {
+		if f, err := os.Create(historyPath); err == nil {
+			_, _ = line.WriteHistory(f)
+			f.Close()
+		}
+	}()
+
+	// Ctrl-C interrupts the running command but not the shell
+	interactive.Store(true)
+	defer interactive.Store(false)
+
+	fmt.Println("bomfactory shell, type 'help' for a list of commands")
+	for {
+		input, err := line.Prompt("bomfactory> ")
+		if errors.Is(err, liner.ErrPromptAborted) || errors.Is(err, io.EOF) {
+			fmt.Println()
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read input: %w", err)
+		}
+
+		input = strings.TrimSpace(input)
+		if input == "" {
+			continue
+		}
+		line.AppendHistory(input)
+
+		command, args, _ := strings.Cut(input, " ")
+		if command == "exit" || command == "quit" {
+			return nil
+		}
+		ctx, stop := signal.NotifyContext(c.Context, os.Interrupt)
+		err = sh.execute(ctx, command, strings.TrimSpace(args))
+		stop()
+		if err := c.Context.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+		}
+	}
+}
+
+func historyFilePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return historyFileName
+	}
+	return filepath.Join(home, historyFileName)
+}
+
+func (sh *shell) execute(ctx context.Context, command, args string) error {
+	switch command {
+	case "filter":
+		criterion, err := csv.ParseFilterCriteria(args)
+		if err != nil {
+			return err
+		}
+		sh.filters = append(sh.filters, criterion)
+		sh.discardResults()
+		sh.printFilters()
+	case "filters":
+		sh.printFilters()
+	case "unset":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 1 || n > len(sh.filters) {
+			return fmt.Errorf("expected a filter number between 1 and %d", len(sh.filters))
+		}
+		sh.filters = append(sh.filters[:n-1], sh.filters[n:]...)
+		sh.discardResults()
+		sh.printFilters()
+	case "clear":
+		sh.filters = nil
+		sh.discardResults()
+	case "limit":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 0 {
+			return fmt.Errorf("expected a non-negative number: %s", args)
+		}
+		sh.maxResults = n
+		sh.discardResults()
+	case "skip":
+		n, err := strconv.Atoi(args)
+		if err != nil || n < 0 {
+			return fmt.Errorf("expected a non-negative number: %s", args)
+		}
+		sh.skip = n
+		sh.discardResults()
+	case "run":
+		return sh.run()
+	case "columns":
+		for _, column := range sh.columns {
+			fmt.Println(column)
+		}
+	case "save":
+		if args == "" {
+			return fmt.Errorf("a selection name must be provided")
+		}
+		if err := sh.ensureResults(); err != nil {
+			return err
+		}
+		selection, err := csv.SaveSelection(sh.db, args, sh.filterOptions(), sh.results)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Saved selection %s with %d repositories\n", selection.Name, len(selection.RepoURLs))
+	case "sbom":
+		if err := sh.ensureResults(); err != nil {
+			return err
+		}
+		options := sh.sbom
+		if args != "" {
+			options.Dir = args
+		}
+		version, err := options.Generator.Version(ctx)
+		if err != nil {
+			return err
+		}
+		options.GeneratorVersion = version
+		tasks, err := newSBOMTasks(sh.db, jobs.CommandDownloadSBOM, sh.results)
+		if err != nil {
+			return fmt.Errorf("failed to record jobs: %w", err)
+		}
+		return generateSBOMs(ctx, sh.db, tasks, options)
+	case "help":
+		sh.printHelp()
+	default:
+		return fmt.Errorf("unknown command %q, type 'help' for a list of commands", command)
+	}
+	return nil
+}
+
+func (sh *shell) filterOptions() csv.FilterOptions {
+	return csv.FilterOptions{
+		Criteria:    sh.filters,
+		MaxResults:  sh.maxResults,
+		SkipRecords: sh.skip,
+	}
+}
+
+func (sh *shell) run() error {
+	if len(sh.filters) == 0 {
+		return fmt.Errorf("add at least one filter before running the query")
+	}
+
+	results, err := csv.FilterSQLiteData(sh.db, sh.filterOptions())
+	if err != nil {
+		return fmt.Errorf("failed to filter SQLite data: %w", err)
+	}
+	sh.results, sh.ran = results, true
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tREPO\tLANGUAGE\tSTARS\tSCORE")
+	for i, repo := range results {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%.4f\n", i+1, repo.RepoURL, repo.RepoLanguage, repo.RepoStarCount, repo.DefaultScore)
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to display results: %w", err)
+	}
+
+	fmt.Printf("%d repositories\n", len(results))
+	return nil
+}
+
+// ensureResults runs the query if it has not been run since the filters last changed
+func (sh *shell) ensureResults() error {
+	if sh.ran {
+		return nil
+	}
+	return sh.run()
+}
+
+// discardResults forgets the results of the query after it changed
+func (sh *shell) discardResults() {
+	sh.results, sh.ran = nil, false
+}
+
+func (sh *shell) printFilters() {
+	if len(sh.filters) == 0 {
+		fmt.Println("No filters")
+		return
+	}
+	for i, criterion := range sh.filters {
+		fmt.Printf("%d: %s:%s:%s\n", i+1, criterion.Field, criterion.Operator, criterion.Value)
+	}
+}
+
+func (sh *shell) printHelp() {
+	names := make([]string, 0, len(shellCommands))
+	for name := range shellCommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", shellCommands[name][0], shellCommands[name][1])
+	}
+	_ = w.Flush()
+}
+
+// complete completes command names, column names and operators for the word under the cursor
+func (sh *shell) complete(line string, pos int) (head string, completions []string, tail string) {
+	head, tail = line[:pos], line[pos:]
+	wordStart := strings.LastIndex(head, " ") + 1
+	word := head[wordStart:]
+	head = head[:wordStart]
+
+	if wordStart == 0 {
+		for name := range shellCommands {
+			if strings.HasPrefix(name, word) {
+				completions = append(completions, name)
+			}
+		}
+		sort.Strings(completions)
+		return head, completions, tail
+	}
+
+	if !strings.HasPrefix(head, "filter ") {
+		return head, nil, tail
+	}
+
+	field, rest, hasOperator := strings.Cut(word, ":")
+	if !hasOperator {
+		for _, column := range sh.columns {
+			if strings.HasPrefix(column, field) {
+				completions = append(completions, column+":")
+			}
+		}
+		return head, completions, tail
+	}
+
+	if !strings.Contains(rest, ":") {
+		for _, operator := range csv.Operators {
+			if strings.HasPrefix(string(operator), strings.ToUpper(rest)) {
+				completions = append(completions, fmt.Sprintf("%s:%s:", field, operator))
+			}
+		}
+	}
+	return head, completions, tail
+}
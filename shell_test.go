@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// newTestShell returns a shell over three Go repositories and one Rust repository
+func newTestShell(t *testing.T) *shell {
+	t.Helper()
+	db := openTestDB(t)
+	_, err := db.Exec(`CREATE TABLE repos (repo_url TEXT, repo_language TEXT, collection_date TEXT, default_score REAL);
+	INSERT INTO repos VALUES
+		('https://github.com/org/a', 'Go', '2024-01-01', 0.3),
+		('https://github.com/org/b', 'Go', '2024-01-01', 0.2),
+		('https://github.com/org/c', 'Go', '2024-01-01', 0.1),
+		('https://github.com/org/d', 'Rust', '2024-01-01', 0.4)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &shell{db: db}
+}
+
+// captureStdout returns what fn prints to stdout
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestShellFilters(t *testing.T) {
+	sh := newTestShell(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		command string
+		args    string
+		wantErr bool
+		want    string // Output of the command
+	}{
+		{command: "filters", want: "No filters\n"},
+		{command: "run", wantErr: true},
+		{command: "filter", args: "repo_language", wantErr: true},
+		{command: "filter", args: "repo_language:=:Go", want: "1: repo_language:=:Go\n"},
+		{command: "filter", args: "default_score:>:0.15", want: "1: repo_language:=:Go\n2: default_score:>:0.15\n"},
+		{command: "filters", want: "1: repo_language:=:Go\n2: default_score:>:0.15\n"},
+		{command: "unset", args: "3", wantErr: true},
+		{command: "unset", args: "1", want: "1: default_score:>:0.15\n"},
+		{command: "clear"},
+		{command: "filters", want: "No filters\n"},
+	}
+	for _, test := range tests {
+		var err error
+		output := captureStdout(t, func() { err = sh.execute(ctx, test.command, test.args) })
+		if (err != nil) != test.wantErr {
+			t.Fatalf("%s %s: error = %v, want error %v", test.command, test.args, err, test.wantErr)
+		}
+		if output != test.want {
+			t.Errorf("%s %s printed %q, want %q", test.command, test.args, output, test.want)
+		}
+	}
+}
+
+func TestShellResults(t *testing.T) {
+	sh := newTestShell(t)
+	ctx := context.Background()
+	execute := func(command, args string) string {
+		t.Helper()
+		var err error
+		output := captureStdout(t, func() { err = sh.execute(ctx, command, args) })
+		if err != nil {
+			t.Fatalf("%s %s: %v", command, args, err)
+		}
+		return output
+	}
+
+	execute("filter", "repo_language:=:Go")
+	if output := execute("run", ""); !strings.Contains(output, "3 repositories") {
+		t.Errorf("run printed %q, want 3 repositories", output)
+	}
+	// Showing the filters keeps the results, changing them discards the results
+	execute("filters", "")
+	if !sh.ran || len(sh.results) != 3 {
+		t.Errorf("showing the filters discarded the results")
+	}
+	execute("clear", "")
+	if sh.ran || sh.results != nil || sh.filters != nil {
+		t.Errorf("clear kept filters %v and results %v", sh.filters, sh.results)
+	}
+
+	// A query without results is not run again until it changes
+	execute("filter", "repo_language:=:Python")
+	if output := execute("run", ""); !strings.Contains(output, "0 repositories") {
+		t.Errorf("run printed %q, want 0 repositories", output)
+	}
+	if _, err := sh.db.Exec("INSERT INTO repos VALUES ('https://github.com/org/e', 'Python', '2024-01-01', 0.5)"); err != nil {
+		t.Fatal(err)
+	}
+	if output := execute("save", "python"); !strings.Contains(output, "with 0 repositories") {
+		t.Errorf("save ran the query again: %q", output)
+	}
+	execute("limit", "10")
+	if output := execute("save", "python-limited"); !strings.Contains(output, "with 1 repositories") {
+		t.Errorf("save did not run the changed query: %q", output)
+	}
+}
+
+func TestShellQueryChangesDiscardResults(t *testing.T) {
+	sh := newTestShell(t)
+	ctx := context.Background()
+	if err := sh.execute(ctx, "filter", "repo_language:=:Go"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		command string
+		args    string
+		want    []string
+	}{
+		{"limit", "2", []string{"https://github.com/org/a", "https://github.com/org/b"}},
+		{"skip", "1", []string{"https://github.com/org/b", "https://github.com/org/c"}},
+		{"limit", "1", []string{"https://github.com/org/b"}},
+	}
+	for _, test := range tests {
+		if err := sh.execute(ctx, "run", ""); err != nil {
+			t.Fatal(err)
+		}
+		if err := sh.execute(ctx, test.command, test.args); err != nil {
+			t.Fatal(err)
+		}
+		if sh.results != nil {
+			t.Errorf("%s %s kept the results of the previous query", test.command, test.args)
+		}
+		// Saving runs the query again, so the selection holds the results of the changed query
+		name := test.command + test.args
+		if err := sh.execute(ctx, "save", name); err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, repo := range sh.results {
+			got = append(got, repo.RepoURL)
+		}
+		if len(got) != len(test.want) {
+			t.Fatalf("after %s %s the results are %v, want %v", test.command, test.args, got, test.want)
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("after %s %s the results are %v, want %v", test.command, test.args, got, test.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,58 @@
+//go:build unix
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestInterruptContext(t *testing.T) {
+	ctx, stop := interruptContext()
+	defer stop()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not canceled by SIGINT")
+	}
+}
+
+func TestInterruptContextInShell(t *testing.T) {
+	ctx, stop := interruptContext()
+	defer stop()
+	interactive.Store(true)
+	defer interactive.Store(false)
+
+	// SIGINT only stops the command the shell runs
+	command, stopCommand := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stopCommand()
+	if err := syscall.Kill(os.Getpid(), syscall.SIGINT); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-command.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("command was not canceled by SIGINT")
+	}
+	select {
+	case <-ctx.Done():
+		t.Fatal("context was canceled by SIGINT in the shell")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("context was not canceled by SIGTERM in the shell")
+	}
+}